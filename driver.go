@@ -4,6 +4,7 @@ package databasego
 //https://notes.eatonphil.com/database-basics-a-database-sql-driver.html
 //https://vyskocilm.github.io/blog/implement-sql-database-driver-in-100-lines-of-go/
 import (
+	"context"
 	"database/sql"
 	"database/sql/driver"
 	"errors"
@@ -43,54 +44,86 @@ func (d *Driver) Open(name string) (driver.Conn, error) {
 		d.bkd = tempdb
 	}
 
-	return &Conn{d.bkd}, nil
+	return &Conn{db: d.bkd}, nil
 }
 
 // Connection to the database
 type Conn struct {
 	db *Backend
+	tx *Tx //transaction statements run in, nil when autocommitting
 }
 
 func (c *Conn) Prepare(query string) (driver.Stmt, error) {
-	return nil, errors.New("Prepare not implemented")
+	ast, err := Parse(query) //check if query for tablename is too long must be less than 16bits
+	if err != nil {
+		return nil, fmt.Errorf("error while parsing: %s", err)
+	}
+	return &Stmt{conn: c, ast: ast}, nil
 }
 
 func (c *Conn) Begin() (driver.Tx, error) {
-	return nil, errors.New("Begin not implemented")
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// BeginTx stops waiting for the transaction writing once ctx is done, only the default isolation is supported
+func (c *Conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if c.tx != nil {
+		return nil, errors.New("transaction already in progress")
+	}
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) || opts.ReadOnly {
+		return nil, errors.New("only default transactions are supported")
+	}
+	tx, err := c.db.BeginContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.tx = &Tx{conn: c, tx: tx}
+	return c.tx, nil
 }
 
 func (c *Conn) Close() error {
 	fmt.Println("closing database")
+	if c.tx != nil {
+		return c.tx.Rollback()
+	}
 	return nil
 }
 
 func (c *Conn) Query(query string, args []driver.Value) (driver.Rows, error) {
-	if len(args) > 0 {
-		// TODO: support parameterization
-		panic("Parameterization not supported")
+	stmt, err := c.Prepare(query)
+	if err != nil {
+		return nil, err
 	}
+	return stmt.Query(args)
+}
 
-	ast, err := Parse(query) //check if query for tablename is too long must be less than 16bits
+func (c *Conn) Exec(query string, args []driver.Value) (driver.Result, error) {
+	stmt, err := c.Prepare(query)
 	if err != nil {
-		return nil, fmt.Errorf("error while parsing: %s", err)
+		return nil, err
 	}
+	return stmt.Exec(args)
+}
 
-	// NOTE: ignorning all but the first statement
-	stmt := ast.Type
-	switch stmt {
-	case Create:
-		err := c.db.CreateTable(ast)
+func (c *Conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := ctx.Err(); err != nil {
 		return nil, err
-	case Select:
-		rows, err := c.db.Select(ast)
-		if err != nil {
-			return nil, err
-		}
-		return rows, nil
-	case Insert:
-		err := c.db.Insert(ast)
+	}
+	values, err := namedValues(args)
+	if err != nil {
 		return nil, err
-	default:
-		return nil, errors.ErrUnsupported
 	}
+	return c.Exec(query, values)
+}
+
+// positional arguments only, names are not supported by placeholders
+func namedValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, fmt.Errorf("named argument %s not supported", arg.Name)
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
 }
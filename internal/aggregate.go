@@ -0,0 +1,375 @@
+package internal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+/*
+SELECT with aggregate functions or GROUP BY runs a hash aggregation, every row matching the WHERE clause
+is put in the group of its GROUP BY values and folded into the state of each aggregate of that group
+groups come out in the order they were first seen, then HAVING, ORDER BY, OFFSET and LIMIT apply to them
+without GROUP BY all the rows are in a single group which exists even when no row matches
+the rows of the groups are GROUP BY values and aggregate results so HAVING is evaluated like a WHERE
+clause against a table holding them
+*/
+
+// extra digits AVG of a DECIMAL column keeps after the scale of the column
+const avgExtraScale = 6
+
+// column of the rows produced for the groups, named after its field and typed as the values it holds
+type groupColumn struct {
+	Column
+	key       int //index in the GROUP BY values, -1 for aggregates
+	aggregate Aggregate
+	source    Column //aggregated column, unset for COUNT(*)
+}
+
+type aggregateState struct {
+	count int64
+	sum   *big.Int //exact sum of integer and DECIMAL values, at the scale of the column
+	fsum  float64
+	best  Cell //smallest or largest value so far for MIN and MAX
+}
+
+type group struct {
+	keys   []Cell
+	states []aggregateState
+}
+
+// isAggregate reports whether a SELECT computes groups rather than returning rows of its table
+func (q *Query) isAggregate() bool {
+	return len(q.Aggregates) > 0 || len(q.GroupBy) > 0
+}
+
+// scan reads the rows of t that may match a filter
+func (tx *Transaction) selectGroups(q Query, t Table, scan func(filter *rowFilter) rowIterator) (*Rows, error) {
+	keyColumns := make([]Column, 0, len(q.GroupBy))
+	for _, field := range q.GroupBy {
+		col, ok := t.getColumn(field)
+		if !ok {
+			return nil, fmt.Errorf("GROUP BY: column not in table: %s", field)
+		}
+		keyColumns = append(keyColumns, col)
+	}
+
+	columns := make([]groupColumn, 0, len(q.Fields))
+	addColumn := func(field string) error {
+		if agg, ok := q.Aggregates[field]; ok {
+			col, err := aggregateColumn(t, field, agg)
+			columns = append(columns, col)
+			return err
+		}
+		for i, key := range q.GroupBy {
+			if key == field {
+				col := keyColumns[i]
+				col.columnConstraint = 0
+				columns = append(columns, groupColumn{Column: col, key: i})
+				return nil
+			}
+		}
+		if field == "*" {
+			return fmt.Errorf("SELECT: * cannot be used with GROUP BY or aggregate functions")
+		}
+		return fmt.Errorf("SELECT: column %s must be in GROUP BY or used in an aggregate function", field)
+	}
+	for _, field := range q.Fields {
+		if err := addColumn(field); err != nil {
+			return nil, err
+		}
+	}
+	visible := len(columns)
+
+	//GROUP BY fields and aggregates used only by HAVING or ORDER BY are hidden columns after the selected ones
+	hidden := append([]string{}, q.GroupBy...)
+	for name := range q.Aggregates {
+		hidden = append(hidden, name)
+	}
+	sort.Strings(hidden[len(q.GroupBy):])
+	for _, field := range hidden {
+		if groupColumnIndex(columns, field) == -1 {
+			if err := addColumn(field); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	groupTable := Table{Name: t.Name}
+	for _, col := range columns {
+		groupTable.Columns = append(groupTable.Columns, col.Column)
+	}
+	groupTable.GenerateFields()
+	having, err := groupTable.newClauseFilter("HAVING", withoutAliases(q, q.Having))
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]sortKey, 0, len(q.OrderBy))
+	for _, field := range q.OrderBy {
+		k := orderColumn(q, groupTable.Columns, field.Field)
+		if k == -1 {
+			return nil, fmt.Errorf("ORDER BY: column %s must be in GROUP BY or used in an aggregate function", field.Field)
+		}
+		keys = append(keys, sortKey{column: k, colType: groupTable.Columns[k].columnType, desc: field.Desc, nullsFirst: field.NullsFirst})
+	}
+
+	filter, err := t.newRowFilter(q.Where)
+	if err != nil {
+		return nil, err
+	}
+	rows := &Rows{columns: []ResultColumn{}}
+	for _, col := range columns[:visible] {
+		rows.columns = append(rows.columns, ResultColumn{Name: resultName(q, col.columnName), ColumnType: col.columnType})
+	}
+	groups := &groupRows{input: &filterRows{input: scan(filter), filter: filter}, t: t, keyColumns: keyColumns,
+		columns: columns, groupTable: groupTable, having: having, single: len(q.GroupBy) == 0}
+	rows.source = tx.orderAndLimit(q, groups, keys, len(columns))
+	return rows, nil
+}
+
+// groupRows reads every row of its input on its first pull, then returns the rows of the groups satisfying HAVING
+type groupRows struct {
+	input      rowIterator
+	t          Table
+	keyColumns []Column
+	columns    []groupColumn
+	groupTable Table
+	having     *rowFilter
+	single     bool     //without GROUP BY every row is in one group
+	order      []*group //groups still to return in the order they were first seen, nil before the input was read
+}
+
+func (r *groupRows) next() ([]Cell, error) {
+	if r.order == nil {
+		if err := r.aggregate(); err != nil {
+			return nil, err
+		}
+	}
+	for len(r.order) > 0 {
+		g := r.order[0]
+		r.order = r.order[1:]
+		row := make([]Cell, len(r.columns))
+		groupbitset := r.groupTable.newRowBitSet()
+		for i, col := range r.columns {
+			var err error
+			if col.key != -1 {
+				row[i] = g.keys[col.key]
+			} else if row[i], err = g.states[i].result(col); err != nil {
+				return nil, err
+			}
+			if row[i] == nil {
+				groupbitset.setBit(i)
+			}
+		}
+		if r.having.match(r.groupTable.buildRow(groupbitset, row)) {
+			return row, nil
+		}
+	}
+	return nil, io.EOF
+}
+
+// folds every row of the input into the state of its group
+func (r *groupRows) aggregate() error {
+	t := r.t
+	groups := make(map[string]*group)
+	r.order = make([]*group, 0)
+	if r.single {
+		g := &group{states: make([]aggregateState, len(r.columns))}
+		groups[""] = g
+		r.order = append(r.order, g)
+	}
+	rowbitset := t.newRowBitSet()
+	bitsetsize := int(rowbitset.Size())
+	cell := func(row []byte, col Column) Cell {
+		if rowbitset.hasBit(col.columnIndex) {
+			return nil
+		}
+		return t.cellAt(row, col)
+	}
+	err := forEachRow(r.input, func(row []byte) error {
+		rowbitset.fromBytes(row[:bitsetsize])
+		var sb strings.Builder
+		for _, col := range r.keyColumns {
+			writeGroupKey(&sb, cell(row, col))
+		}
+		g, ok := groups[sb.String()]
+		if !ok {
+			g = &group{keys: make([]Cell, len(r.keyColumns)), states: make([]aggregateState, len(r.columns))}
+			for i, col := range r.keyColumns {
+				if c := cell(row, col); c != nil {
+					g.keys[i] = append(Cell{}, c...)
+				}
+			}
+			groups[sb.String()] = g
+			r.order = append(r.order, g)
+		}
+		for i, col := range r.columns {
+			if col.key != -1 {
+				continue
+			}
+			var value Cell
+			if col.aggregate.Field != "*" {
+				if value = cell(row, col.source); value == nil {
+					continue
+				}
+			}
+			g.states[i].fold(col, value)
+		}
+		return nil
+	})
+	if err != nil {
+		r.order = []*group{}
+	}
+	return err
+}
+
+func (r *groupRows) close() error {
+	r.order = []*group{}
+	return r.input.close()
+}
+
+// column produced by an aggregate, SUM and AVG only take numeric columns
+func aggregateColumn(t Table, name string, agg Aggregate) (groupColumn, error) {
+	col := groupColumn{key: -1, aggregate: agg}
+	col.columnName = name
+	if agg.Func == Count {
+		col.columnType, col.columnSize = INT, 8
+		if agg.Field == "*" {
+			return col, nil
+		}
+	}
+	source, ok := t.getColumn(agg.Field)
+	if !ok {
+		return col, fmt.Errorf("%s: column not in table: %s", name, agg.Field)
+	}
+	col.source = source
+	switch agg.Func {
+	case Sum, Avg:
+		if !isNumeric(source.columnType) {
+			return col, fmt.Errorf("%s: cannot aggregate %s column %s", name, typeName(source.columnType), source.columnName)
+		}
+		switch {
+		case source.columnType == DECIMAL:
+			col.columnType, col.columnSize, col.precision, col.scale = DECIMAL, decimalSize, maxDecimalPrecision, source.scale
+			if agg.Func == Avg {
+				//the mean is never larger than the largest value so its whole digits still fit
+				col.scale = uint8(min(int(source.scale)+avgExtraScale, maxDecimalPrecision-int(source.precision-source.scale)))
+			}
+		case agg.Func == Sum && isInteger(source.columnType):
+			col.columnType, col.columnSize = INT, 8
+		default:
+			col.columnType, col.columnSize = FLOAT, 8
+		}
+	case Min, Max:
+		col.columnType, col.columnSize = source.columnType, source.columnSize
+		col.precision, col.scale = source.precision, source.scale
+	}
+	return col, nil
+}
+
+// adds a value of the aggregated column to the state, value is nil for COUNT(*)
+func (s *aggregateState) fold(col groupColumn, value Cell) {
+	s.count++
+	switch col.aggregate.Func {
+	case Sum, Avg:
+		if col.source.columnType == FLOAT {
+			s.fsum += value.AsFloat()
+			return
+		}
+		if s.sum == nil {
+			s.sum = new(big.Int)
+		}
+		unscaled, scale := cellAsDecimal(col.source.columnType, value)
+		s.sum.Add(s.sum, rescale(unscaled, scale, int(col.source.scale)))
+	case Min, Max:
+		if s.best == nil {
+			s.best = append(Cell{}, value...)
+			return
+		}
+		cmp := compareCells(col.source.columnType, value, col.source.columnType, s.best)
+		if (col.aggregate.Func == Min && cmp < 0) || (col.aggregate.Func == Max && cmp > 0) {
+			s.best = append(Cell{}, value...)
+		}
+	}
+}
+
+// value of the aggregate for the group, nil when only nulls were aggregated
+func (s *aggregateState) result(col groupColumn) (Cell, error) {
+	if col.aggregate.Func == Count {
+		return binary.LittleEndian.AppendUint64(nil, uint64(s.count)), nil
+	}
+	if s.count == 0 {
+		return nil, nil
+	}
+	switch col.aggregate.Func {
+	case Min, Max:
+		return s.best, nil
+	case Sum:
+		switch col.columnType {
+		case FLOAT:
+			return binary.LittleEndian.AppendUint64(nil, math.Float64bits(s.fsum)), nil
+		case INT:
+			if !s.sum.IsInt64() {
+				return nil, fmt.Errorf("%s: %s out of range for INT", col.columnName, s.sum)
+			}
+			return binary.LittleEndian.AppendUint64(nil, uint64(s.sum.Int64())), nil
+		}
+		if new(big.Int).Abs(s.sum).Cmp(pow10(maxDecimalPrecision)) >= 0 {
+			return nil, fmt.Errorf("%s: sum has more than %d digits", col.columnName, maxDecimalPrecision)
+		}
+		return decimalCell(s.sum, int(col.scale)), nil
+	}
+	if col.columnType == DECIMAL {
+		//rounds half away from zero like the scale of DECIMAL values
+		count := big.NewInt(s.count)
+		q, r := new(big.Int).QuoRem(rescale(s.sum, int(col.source.scale), int(col.scale)), count, new(big.Int))
+		if r.Abs(r).Lsh(r, 1).Cmp(count) >= 0 {
+			q.Add(q, big.NewInt(int64(s.sum.Sign())))
+		}
+		return decimalCell(q, int(col.scale)), nil
+	}
+	mean := s.fsum / float64(s.count)
+	if col.source.columnType != FLOAT {
+		mean, _ = new(big.Rat).SetFrac(s.sum, big.NewInt(s.count)).Float64()
+	}
+	return binary.LittleEndian.AppendUint64(nil, math.Float64bits(mean)), nil
+}
+
+// appends a GROUP BY value to the key of a group, nulls are grouped together
+func writeGroupKey(sb *strings.Builder, c Cell) {
+	if c == nil {
+		sb.WriteByte(0)
+		return
+	}
+	sb.WriteByte(1)
+	sb.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(c))))
+	sb.Write(c)
+}
+
+func groupColumnIndex(columns []groupColumn, name string) int {
+	for i, col := range columns {
+		if col.columnName == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// copy of a HAVING expression with the aliases of the selected fields replaced by the fields
+func withoutAliases(q Query, e *Expression) *Expression {
+	if e == nil || len(q.Aliases) == 0 {
+		return e
+	}
+	c := e.clone()
+	for _, leaf := range c.leaves() {
+		leaf.Condition.Operand1 = aliasedField(q, leaf.Condition.Operand1)
+		if leaf.Condition.Operand2IsField {
+			leaf.Condition.Operand2 = aliasedField(q, leaf.Condition.Operand2)
+		}
+	}
+	return c
+}
@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Bind returns a copy of the query with every placeholder replaced by its argument
+// arguments are checked against the type of the column they are stored in or compared with
+func (b *Backend) Bind(q Query, args []driver.Value) (Query, error) {
+	if len(args) != q.NumParams() {
+		return Query{}, fmt.Errorf("expected %d arguments, got %d", q.NumParams(), len(args))
+	}
+	if len(q.Params) == 0 {
+		return q, nil
+	}
+	b.mu.RLock()
+	table, ok := b.checkTableExist(q)
+	getColumn := table.getColumn
+	if ok && (len(q.Joins) > 0 || q.TableAlias != "") {
+		//WHERE fields of a SELECT with JOIN or AS may be qualified by their table
+		scope, err := newJoinScope(q, func(name string) (Table, bool) { return b.checkTableExist(Query{TableName: name}) })
+		if err != nil {
+			b.mu.RUnlock()
+			return Query{}, err
+		}
+		getColumn = func(name string) (Column, bool) {
+			col, err := scope.column(name)
+			return col, err == nil
+		}
+	}
+	b.mu.RUnlock()
+	if !ok {
+		return Query{}, errors.New("Table does not exist")
+	}
+
+	bound := q.clone()
+	leaves := bound.Where.leaves()
+	for _, param := range q.Params {
+		var columnName string
+		switch param.Kind {
+		case ParamInsert:
+			columnName = q.Fields[param.Column]
+		case ParamUpdate:
+			columnName = param.Field
+		case ParamWhere:
+			columnName = leaves[param.Condition].Condition.Operand1
+		}
+		col, ok := getColumn(columnName)
+		if !ok {
+			return Query{}, fmt.Errorf("Columns not in table: %s", columnName)
+		}
+		val := Value{Kind: NullValue} //nil arguments are NULL
+		if arg := args[param.Number-1]; arg != nil {
+			text, err := bindValue(col, arg)
+			if err != nil {
+				return Query{}, fmt.Errorf("argument %d: %w", param.Number, err)
+			}
+			val = Value{Text: text}
+		}
+
+		switch param.Kind {
+		case ParamInsert:
+			bound.Inserts[param.Row][param.Column] = val
+		case ParamUpdate:
+			bound.Updates[param.Field] = val
+		case ParamWhere:
+			leaves[param.Condition].Condition.Operand2 = val.Text
+			leaves[param.Condition].Condition.Operand2Kind = val.Kind
+		}
+	}
+	bound.Params = nil
+	return bound, nil
+}
+
+// converts a driver value to the string form parsed for the column type
+func bindValue(col Column, v driver.Value) (string, error) {
+	switch col.columnType {
+	case INT, TINYINT, SMALLINT, INTEGER, UTINYINT, USMALLINT, UINTEGER, UBIGINT:
+		if n, ok := v.(int64); ok {
+			return strconv.FormatInt(n, 10), nil
+		}
+	case FLOAT:
+		switch n := v.(type) {
+		case float64:
+			return strconv.FormatFloat(n, 'g', -1, 64), nil
+		case int64:
+			return strconv.FormatInt(n, 10), nil
+		}
+	case BOOL:
+		if n, ok := v.(bool); ok {
+			return strconv.FormatBool(n), nil
+		}
+	case DATE:
+		switch n := v.(type) {
+		case time.Time:
+			return n.Format("2006-01-02"), nil
+		case string:
+			return n, nil
+		}
+	case TIMESTAMP:
+		switch n := v.(type) {
+		case time.Time:
+			return n.Format(time.RFC3339Nano), nil
+		case string:
+			return n, nil
+		}
+	case INTERVAL:
+		switch n := v.(type) {
+		case int64:
+			return time.Duration(n).String(), nil
+		case string:
+			return n, nil
+		}
+	case DECIMAL:
+		switch n := v.(type) {
+		case string:
+			return n, nil
+		case []byte:
+			return string(n), nil
+		case int64:
+			return strconv.FormatInt(n, 10), nil
+		case float64:
+			return strconv.FormatFloat(n, 'g', -1, 64), nil
+		}
+	case CHAR, VARCHAR, TEXT, BLOB:
+		switch n := v.(type) {
+		case string:
+			return n, nil
+		case []byte:
+			return string(n), nil
+		}
+	}
+	return "", fmt.Errorf("cannot use %T as %s for column %s", v, typeName(col.columnType), col.columnName)
+}
@@ -0,0 +1,704 @@
+package internal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+/*
+Rows of a table are stored in a B+tree keyed on the primary key column, page 0 is always the root
+leaf pages are slotted and point to the next leaf so range scans follow the chain:
+a directory of offset (2 bytes) | length (2 bytes) slots in key order follows the header
+and the rows it points to are packed from the end of the page towards it
+internal pages hold child page ids separated by keys: child0 | key0 | child1 | ... | keyN-1 | childN
+keys in child i are smaller than key i and keys in child i+1 are greater or equal to it
+the row count at bytes 8-10 of a page is the number of rows of a leaf or the number of keys of an internal page
+*/
+const (
+	nodeLeaf byte = iota + 1
+	nodeInternal
+)
+
+// node header following the page header, rows or children start after it
+const (
+	nodeTypeOffset  = 26
+	nodeNextOffset  = 27 //next leaf page, 0 for the last leaf since the root is never a sibling
+	nodeCellsOffset = 35
+	leafSlotSize    = 4
+	leafSpace       = PAGESIZE - nodeCellsOffset //bytes for the slots and rows of a leaf
+)
+
+type node struct {
+	id  PageID
+	buf *[PAGESIZE]byte
+}
+
+func (n node) isLeaf() bool {
+	return n.buf[nodeTypeOffset] == nodeLeaf
+}
+
+func (n node) count() int {
+	return int(binary.LittleEndian.Uint16(n.buf[8:10]))
+}
+
+func (n node) setCount(c int) {
+	binary.LittleEndian.PutUint16(n.buf[8:10], uint16(c))
+}
+
+func (n node) next() PageID {
+	return PageID(binary.LittleEndian.Uint64(n.buf[nodeNextOffset : nodeNextOffset+8]))
+}
+
+func (n node) setNext(id PageID) {
+	binary.LittleEndian.PutUint64(n.buf[nodeNextOffset:nodeNextOffset+8], uint64(id))
+}
+
+// empties the node keeping its page number
+func (n node) reset(typ byte) {
+	zeroBytes(n.buf[8:])
+	n.buf[nodeTypeOffset] = typ
+}
+
+// pages of a B+tree file that are allocated and free, dynamic at runtime
+type treePages struct {
+	lastPage  uint64
+	freePages []PageID //pages emptied by merges reused by splits
+}
+
+// B+tree of a table or an index as seen by a transaction
+type btree struct {
+	tx          *Transaction
+	file        string //buffer pool and file holding the tree
+	pages       *treePages
+	key         Column //primary key column of a table tree
+	keyOf       func(row []byte) Cell
+	keysize     int  //keys of internal pages are zero padded to keysize
+	prefixes    bool //keys shorter than keysize are prefixes of the keys they are searched for
+	compareKeys func(a, b Cell) int
+	duplicate   error //returned when inserting a key that is already in the tree
+}
+
+func newBtree(tx *Transaction, t *Table) *btree {
+	key, _ := t.primaryColumn()
+	return &btree{
+		tx:      tx,
+		file:    t.Name,
+		pages:   &t.treePages,
+		key:     key,
+		keyOf:   func(row []byte) Cell { return t.cellAt(row, key) },
+		keysize: int(key.columnSize),
+		compareKeys: func(a, b Cell) int {
+			return compareCells(key.columnType, a, key.columnType, b)
+		},
+		duplicate: &ConstraintError{Kind: PrimaryKeyConstraint, Table: t.Name, Column: key.columnName},
+	}
+}
+
+// rows up to this size always fit two to a leaf so a split never leaves a leaf too full
+func (bt *btree) maxRowSize() int {
+	return leafSpace/2 - leafSlotSize
+}
+
+func (bt *btree) internalCapacity() int {
+	return (PAGESIZE - nodeCellsOffset - 8) / (bt.keysize + 8)
+}
+
+// nodes other than the root using less than a quarter of a leaf or holding less than half
+// the keys of an internal page are merged or refilled from a sibling
+func (bt *btree) underflow(n node) bool {
+	if n.isLeaf() {
+		return usedSpace(n) < leafSpace/4
+	}
+	return n.count() < bt.internalCapacity()/2
+}
+
+func (bt *btree) compare(a, b Cell) int {
+	return bt.compareKeys(a, b)
+}
+
+func (bt *btree) slot(n node, i int) (offset int, length int) {
+	s := nodeCellsOffset + i*leafSlotSize
+	return int(binary.LittleEndian.Uint16(n.buf[s : s+2])), int(binary.LittleEndian.Uint16(n.buf[s+2 : s+4]))
+}
+
+func (bt *btree) setSlot(n node, i int, offset, length int) {
+	s := nodeCellsOffset + i*leafSlotSize
+	binary.LittleEndian.PutUint16(n.buf[s:s+2], uint16(offset))
+	binary.LittleEndian.PutUint16(n.buf[s+2:s+4], uint16(length))
+}
+
+func (bt *btree) row(n node, i int) []byte {
+	offset, length := bt.slot(n, i)
+	return n.buf[offset : offset+length]
+}
+
+func (bt *btree) rowKey(n node, i int) Cell {
+	return bt.keyOf(bt.row(n, i))
+}
+
+// start of the rows packed at the end of a leaf
+func (bt *btree) rowsStart(n node) int {
+	start := PAGESIZE
+	for i := 0; i < n.count(); i++ {
+		if offset, _ := bt.slot(n, i); offset < start {
+			start = offset
+		}
+	}
+	return start
+}
+
+// bytes taken by the slots and rows of a leaf, space left by removed rows is not counted
+func usedSpace(n node) int {
+	used := n.count() * leafSlotSize
+	for i := 0; i < n.count(); i++ {
+		s := nodeCellsOffset + i*leafSlotSize
+		used += int(binary.LittleEndian.Uint16(n.buf[s+2 : s+4]))
+	}
+	return used
+}
+
+func rowsSpace(rows [][]byte) int {
+	used := len(rows) * leafSlotSize
+	for _, row := range rows {
+		used += len(row)
+	}
+	return used
+}
+
+func (bt *btree) fits(n node, row []byte) bool {
+	return usedSpace(n)+leafSlotSize+len(row) <= leafSpace
+}
+
+// inserts row at slot i compacting the leaf first when removed rows left the free space in pieces
+func (bt *btree) insertRow(n node, i int, row []byte) {
+	c := n.count()
+	slotsEnd := nodeCellsOffset + (c+1)*leafSlotSize
+	if bt.rowsStart(n)-len(row) < slotsEnd {
+		bt.setRows(n, bt.rows(n))
+	}
+	offset := bt.rowsStart(n) - len(row)
+	copy(n.buf[offset:], row)
+	start := nodeCellsOffset + i*leafSlotSize
+	end := nodeCellsOffset + c*leafSlotSize
+	copy(n.buf[start+leafSlotSize:end+leafSlotSize], n.buf[start:end])
+	bt.setSlot(n, i, offset, len(row))
+	n.setCount(c + 1)
+}
+
+func (bt *btree) removeRow(n node, i int) {
+	c := n.count()
+	zeroBytes(bt.row(n, i))
+	start := nodeCellsOffset + i*leafSlotSize
+	end := nodeCellsOffset + c*leafSlotSize
+	copy(n.buf[start:end-leafSlotSize], n.buf[start+leafSlotSize:end])
+	zeroBytes(n.buf[end-leafSlotSize : end])
+	n.setCount(c - 1)
+}
+
+// copies of the rows of a leaf
+func (bt *btree) rows(n node) [][]byte {
+	rows := make([][]byte, n.count())
+	for i := range rows {
+		rows[i] = append([]byte{}, bt.row(n, i)...)
+	}
+	return rows
+}
+
+// rewrites a leaf with rows packed at the end of the page
+func (bt *btree) setRows(n node, rows [][]byte) {
+	zeroBytes(n.buf[nodeCellsOffset:])
+	offset := PAGESIZE
+	for i, row := range rows {
+		offset -= len(row)
+		copy(n.buf[offset:], row)
+		bt.setSlot(n, i, offset, len(row))
+	}
+	n.setCount(len(rows))
+}
+
+// index splitting rows in two leaves that are as even as possible, both fit when rows hold at most
+// a leaf and a row and no row is larger than maxRowSize
+func splitPoint(rows [][]byte) int {
+	total := rowsSpace(rows)
+	best, bestSize := 1, total
+	left := 0
+	for i := 1; i < len(rows); i++ {
+		left += leafSlotSize + len(rows[i-1])
+		size := left
+		if total-left > size {
+			size = total - left
+		}
+		if size < bestSize {
+			best, bestSize = i, size
+		}
+	}
+	return best
+}
+
+func (bt *btree) childOffset(i int) int {
+	return nodeCellsOffset + i*(8+bt.keysize)
+}
+
+func (bt *btree) child(n node, i int) PageID {
+	offset := bt.childOffset(i)
+	return PageID(binary.LittleEndian.Uint64(n.buf[offset : offset+8]))
+}
+
+func (bt *btree) setChild(n node, i int, id PageID) {
+	offset := bt.childOffset(i)
+	binary.LittleEndian.PutUint64(n.buf[offset:offset+8], uint64(id))
+}
+
+func (bt *btree) keyAt(n node, i int) Cell {
+	offset := bt.childOffset(i) + 8
+	return Cell(n.buf[offset : offset+bt.keysize])
+}
+
+func (bt *btree) setKey(n node, i int, key Cell) {
+	dst := bt.keyAt(n, i)
+	copy(dst, key)
+	if len(key) < len(dst) {
+		zeroBytes(dst[len(key):])
+	}
+}
+
+// inserts key at i with the child on its right at i+1
+func (bt *btree) insertKey(n node, i int, key Cell, right PageID) {
+	c := n.count()
+	step := 8 + bt.keysize
+	start := bt.childOffset(i) + 8
+	end := bt.childOffset(c) + 8
+	copy(n.buf[start+step:end+step], n.buf[start:end])
+	bt.setKey(n, i, key)
+	bt.setChild(n, i+1, right)
+	n.setCount(c + 1)
+}
+
+// removes key i with the child on its right at i+1
+func (bt *btree) removeKey(n node, i int) {
+	c := n.count()
+	step := 8 + bt.keysize
+	start := bt.childOffset(i) + 8
+	end := bt.childOffset(c) + 8
+	copy(n.buf[start:end-step], n.buf[start+step:end])
+	zeroBytes(n.buf[end-step : end])
+	n.setCount(c - 1)
+}
+
+// copies of the keys and children of an internal node
+func (bt *btree) entries(n node) ([]Cell, []PageID) {
+	keys := make([]Cell, n.count())
+	children := make([]PageID, n.count()+1)
+	for i := range keys {
+		keys[i] = append(Cell{}, bt.keyAt(n, i)...)
+	}
+	for i := range children {
+		children[i] = bt.child(n, i)
+	}
+	return keys, children
+}
+
+func (bt *btree) setEntries(n node, keys []Cell, children []PageID) {
+	zeroBytes(n.buf[nodeCellsOffset:])
+	for i, key := range keys {
+		bt.setKey(n, i, key)
+	}
+	for i, id := range children {
+		bt.setChild(n, i, id)
+	}
+	n.setCount(len(keys))
+}
+
+// index of the child of an internal node whose keys cover key, nil is smaller than every key
+// a prefix of a key goes left of equal separators since the first entries it matches may be there
+func (bt *btree) childIndex(n node, key Cell) int {
+	if key == nil {
+		return 0
+	}
+	prefix := bt.prefixes && len(key) < bt.keysize
+	return sort.Search(n.count(), func(i int) bool {
+		cmp := bt.compare(key, bt.keyAt(n, i))
+		return cmp < 0 || prefix && cmp == 0
+	})
+}
+
+// position of the first row of a leaf with a key greater or equal to key
+func (bt *btree) search(n node, key Cell) int {
+	return sort.Search(n.count(), func(i int) bool {
+		return bt.compare(bt.rowKey(n, i), key) >= 0
+	})
+}
+
+func (bt *btree) readNode(id PageID) (node, error) {
+	buf, err := bt.tx.readPage(bt.file, id)
+	if err != nil {
+		return node{}, err
+	}
+	if buf[nodeTypeOffset] != nodeLeaf && buf[nodeTypeOffset] != nodeInternal {
+		return node{}, fmt.Errorf("page %d is not a table page", id)
+	}
+	return node{id: id, buf: buf}, nil
+}
+
+func (bt *btree) writableNode(id PageID) (node, error) {
+	buf, err := bt.tx.writablePage(bt.file, id)
+	if err != nil {
+		return node{}, err
+	}
+	return node{id: id, buf: buf}, nil
+}
+
+// new node in a page freed by a merge or appended after the last page
+func (bt *btree) allocate(typ byte) node {
+	var id PageID
+	if n := len(bt.pages.freePages); n > 0 {
+		id = bt.pages.freePages[n-1]
+		bt.pages.freePages = bt.pages.freePages[:n-1]
+	} else {
+		bt.pages.lastPage++
+		id = PageID(bt.pages.lastPage)
+	}
+	n := node{id: id, buf: bt.tx.newPage(bt.file, id)}
+	n.reset(typ)
+	return n
+}
+
+func (bt *btree) free(n node) {
+	zeroBytes(n.buf[8:])
+	bt.pages.freePages = append(bt.pages.freePages, n.id)
+}
+
+// step of a path from the root, index is the child taken in the internal node
+type pathStep struct {
+	id    PageID
+	index int
+}
+
+// walks from the root to the leaf that holds key returning the internal nodes on the way
+func (bt *btree) descend(key Cell) ([]pathStep, node, error) {
+	path := make([]pathStep, 0)
+	n, err := bt.readNode(0)
+	for err == nil && !n.isLeaf() {
+		i := bt.childIndex(n, key)
+		path = append(path, pathStep{id: n.id, index: i})
+		n, err = bt.readNode(bt.child(n, i))
+	}
+	return path, n, err
+}
+
+// get returns the row stored under key
+func (bt *btree) get(key Cell) ([]byte, bool, error) {
+	_, leaf, err := bt.descend(key)
+	if err != nil {
+		return nil, false, err
+	}
+	i := bt.search(leaf, key)
+	if i < leaf.count() && bt.compare(bt.rowKey(leaf, i), key) == 0 {
+		return bt.row(leaf, i), true, nil
+	}
+	return nil, false, nil
+}
+
+// scan calls fn in key order with every row whose key is between from and to, nil bounds are open
+// fn must not modify the tree
+func (bt *btree) scan(from, to Cell, fn func(row []byte) error) error {
+	c := bt.cursor(from, to)
+	for {
+		row, err := c.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			c.close()
+			return err
+		}
+	}
+}
+
+// treeCursor reads the rows of a B+tree whose key is between from and to one at a time in key order
+// only the leaf being read is held, pages are read when the cursor reaches them
+type treeCursor struct {
+	bt       *btree
+	from, to Cell
+	leaf     node
+	i        int
+	started  bool
+	done     bool
+}
+
+func (bt *btree) cursor(from, to Cell) *treeCursor {
+	return &treeCursor{bt: bt, from: from, to: to}
+}
+
+// next returns the next row or io.EOF after the last one, the row is only valid until the following call
+func (c *treeCursor) next() ([]byte, error) {
+	if c.done {
+		return nil, io.EOF
+	}
+	if !c.started {
+		_, leaf, err := c.bt.descend(c.from)
+		if err != nil {
+			return nil, err
+		}
+		c.leaf, c.started = leaf, true
+		if c.from != nil {
+			c.i = c.bt.search(leaf, c.from)
+		}
+	}
+	for c.i == c.leaf.count() {
+		if c.leaf.next() == 0 {
+			c.close()
+			return nil, io.EOF
+		}
+		leaf, err := c.bt.readNode(c.leaf.next())
+		if err != nil {
+			return nil, err
+		}
+		c.leaf, c.i = leaf, 0
+	}
+	if c.to != nil && c.bt.compare(c.bt.rowKey(c.leaf, c.i), c.to) > 0 {
+		c.close()
+		return nil, io.EOF
+	}
+	c.i++
+	return c.bt.row(c.leaf, c.i-1), nil
+}
+
+// close releases the leaf held by the cursor, next then returns io.EOF
+func (c *treeCursor) close() error {
+	c.leaf, c.done = node{}, true
+	return nil
+}
+
+// insert stores row in key order splitting full nodes from the leaf up
+func (bt *btree) insert(row []byte) error {
+	if len(row) > bt.maxRowSize() {
+		return bt.rowTooLarge(row)
+	}
+	key := bt.keyOf(row)
+	path, leaf, err := bt.descend(key)
+	if err != nil {
+		return err
+	}
+	i := bt.search(leaf, key)
+	if i < leaf.count() && bt.compare(bt.rowKey(leaf, i), key) == 0 {
+		return bt.duplicate
+	}
+	leaf, err = bt.writableNode(leaf.id)
+	if err != nil {
+		return err
+	}
+	if bt.fits(leaf, row) {
+		bt.insertRow(leaf, i, row)
+		return nil
+	}
+
+	rows := bt.rows(leaf)
+	rows = append(rows[:i], append([][]byte{append([]byte{}, row...)}, rows[i:]...)...)
+	mid := splitPoint(rows)
+	right := bt.allocate(nodeLeaf)
+	bt.setRows(leaf, rows[:mid])
+	bt.setRows(right, rows[mid:])
+	right.setNext(leaf.next())
+	leaf.setNext(right.id)
+	return bt.insertSeparator(path, leaf, append(Cell{}, bt.rowKey(right, 0)...), right.id)
+}
+
+// adds the separator of a split node to its parent splitting parents that are full
+func (bt *btree) insertSeparator(path []pathStep, left node, key Cell, right PageID) error {
+	for level := len(path) - 1; level >= 0; level-- {
+		parent, err := bt.writableNode(path[level].id)
+		if err != nil {
+			return err
+		}
+		i := path[level].index
+		if parent.count() < bt.internalCapacity() {
+			bt.insertKey(parent, i, key, right)
+			return nil
+		}
+
+		keys, children := bt.entries(parent)
+		keys = append(keys[:i], append([]Cell{key}, keys[i:]...)...)
+		children = append(children[:i+1], append([]PageID{right}, children[i+1:]...)...)
+		mid := len(keys) / 2
+		sibling := bt.allocate(nodeInternal)
+		bt.setEntries(parent, keys[:mid], children[:mid+1])
+		bt.setEntries(sibling, keys[mid+1:], children[mid+1:])
+		left, key, right = parent, keys[mid], sibling.id
+	}
+
+	//the root was split, its left half moves to a new page so the root stays at page 0
+	moved := bt.allocate(left.buf[nodeTypeOffset])
+	copy(moved.buf[8:], left.buf[8:])
+	left.reset(nodeInternal)
+	bt.setEntries(left, []Cell{key}, []PageID{moved.id, right})
+	return nil
+}
+
+// delete removes the row stored under key, reports false when there is none
+func (bt *btree) delete(key Cell) (bool, error) {
+	path, leaf, err := bt.descend(key)
+	if err != nil {
+		return false, err
+	}
+	i := bt.search(leaf, key)
+	if i >= leaf.count() || bt.compare(bt.rowKey(leaf, i), key) != 0 {
+		return false, nil
+	}
+	leaf, err = bt.writableNode(leaf.id)
+	if err != nil {
+		return false, err
+	}
+	bt.removeRow(leaf, i)
+	return true, bt.rebalance(path, leaf)
+}
+
+// refills nodes left with too few rows or keys by borrowing from or merging with a sibling
+func (bt *btree) rebalance(path []pathStep, n node) error {
+	for level := len(path) - 1; level >= 0; level-- {
+		if !bt.underflow(n) {
+			return nil
+		}
+		parent, err := bt.writableNode(path[level].id)
+		if err != nil {
+			return err
+		}
+		i := path[level].index
+		if n.isLeaf() {
+			//rows of the leaf and a sibling are merged when they fit in one leaf and shared evenly otherwise
+			sep := i
+			if i > 0 {
+				sep = i - 1
+			}
+			left, err := bt.writableNode(bt.child(parent, sep))
+			if err != nil {
+				return err
+			}
+			right, err := bt.writableNode(bt.child(parent, sep+1))
+			if err != nil {
+				return err
+			}
+			rows := append(bt.rows(left), bt.rows(right)...)
+			if rowsSpace(rows) > leafSpace {
+				mid := splitPoint(rows)
+				bt.setRows(left, rows[:mid])
+				bt.setRows(right, rows[mid:])
+				bt.setKey(parent, sep, bt.rowKey(right, 0))
+				return nil
+			}
+			bt.merge(parent, sep, left, right)
+		} else if i > 0 {
+			left, err := bt.writableNode(bt.child(parent, i-1))
+			if err != nil {
+				return err
+			}
+			if left.count() > bt.internalCapacity()/2 {
+				bt.borrowLeft(parent, i, left, n)
+				return nil
+			}
+			bt.merge(parent, i-1, left, n)
+		} else {
+			right, err := bt.writableNode(bt.child(parent, i+1))
+			if err != nil {
+				return err
+			}
+			if right.count() > bt.internalCapacity()/2 {
+				bt.borrowRight(parent, i, n, right)
+				return nil
+			}
+			bt.merge(parent, i, n, right)
+		}
+		n = parent
+	}
+
+	//a root left with a single child takes over the child's contents
+	if !n.isLeaf() && n.count() == 0 {
+		only, err := bt.writableNode(bt.child(n, 0))
+		if err != nil {
+			return err
+		}
+		copy(n.buf[8:], only.buf[8:])
+		bt.free(only)
+	}
+	return nil
+}
+
+// moves the last key of the internal node left into n which is child i of parent
+func (bt *btree) borrowLeft(parent node, i int, left, n node) {
+	leftKeys, leftChildren := bt.entries(left)
+	keys, children := bt.entries(n)
+	last := len(leftKeys) - 1
+	keys = append([]Cell{append(Cell{}, bt.keyAt(parent, i-1)...)}, keys...)
+	children = append([]PageID{leftChildren[last+1]}, children...)
+	bt.setEntries(n, keys, children)
+	bt.setKey(parent, i-1, leftKeys[last])
+	bt.removeKey(left, last)
+}
+
+// moves the first key of the internal node right into n which is child i of parent
+func (bt *btree) borrowRight(parent node, i int, n, right node) {
+	rightKeys, rightChildren := bt.entries(right)
+	bt.insertKey(n, n.count(), bt.keyAt(parent, i), rightChildren[0])
+	bt.setKey(parent, i, rightKeys[0])
+	bt.setEntries(right, rightKeys[1:], rightChildren[1:])
+}
+
+// moves everything in right into left and drops the separator at i from parent
+func (bt *btree) merge(parent node, i int, left, right node) {
+	if left.isLeaf() {
+		bt.setRows(left, append(bt.rows(left), bt.rows(right)...))
+		left.setNext(right.next())
+	} else {
+		leftKeys, leftChildren := bt.entries(left)
+		rightKeys, rightChildren := bt.entries(right)
+		keys := append(append(leftKeys, append(Cell{}, bt.keyAt(parent, i)...)), rightKeys...)
+		bt.setEntries(left, keys, append(leftChildren, rightChildren...))
+	}
+	bt.removeKey(parent, i)
+	bt.free(right)
+}
+
+// replaces the row stored under the same key as row
+func (bt *btree) replace(row []byte) error {
+	if len(row) > bt.maxRowSize() {
+		return bt.rowTooLarge(row)
+	}
+	key := bt.keyOf(row)
+	path, leaf, err := bt.descend(key)
+	if err != nil {
+		return err
+	}
+	i := bt.search(leaf, key)
+	if i >= leaf.count() || bt.compare(bt.rowKey(leaf, i), key) != 0 {
+		return fmt.Errorf("row missing from %s", bt.file)
+	}
+	leaf, err = bt.writableNode(leaf.id)
+	if err != nil {
+		return err
+	}
+	if old := bt.row(leaf, i); usedSpace(leaf)-len(old)+len(row) <= leafSpace {
+		bt.removeRow(leaf, i)
+		bt.insertRow(leaf, i, row)
+		return bt.rebalance(path, leaf) //a shorter row may leave the leaf underfull
+	}
+	//a longer row that no longer fits moves through a delete and an insert which split the leaf
+	if _, err := bt.delete(key); err != nil {
+		return err
+	}
+	return bt.insert(row)
+}
+
+func (bt *btree) rowTooLarge(row []byte) error {
+	return fmt.Errorf("row of %d bytes is larger than the %d bytes allowed in %s", len(row), bt.maxRowSize(), bt.file)
+}
+
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// walks the whole tree checking key order, node sizes, leaf depth and the leaf chain
+// returns the keys in order
+func checkTree(t *testing.T, bt *btree) []string {
+	t.Helper()
+	keys := make([]string, 0)
+	leaves := make([]PageID, 0)
+	used := map[PageID]bool{}
+	leafDepth := -1
+	var last Cell
+
+	var walk func(id PageID, depth int, low, high Cell)
+	walk = func(id PageID, depth int, low, high Cell) {
+		n, err := bt.readNode(id)
+		require.NoError(t, err)
+		require.False(t, used[id], "page %d reached twice", id)
+		used[id] = true
+		if id != 0 {
+			require.False(t, bt.underflow(n), "page %d underfull", id)
+		}
+		inRange := func(key Cell) {
+			if low != nil {
+				require.GreaterOrEqual(t, bt.compare(key, low), 0)
+			}
+			if high != nil {
+				require.Less(t, bt.compare(key, high), 0)
+			}
+		}
+		if n.isLeaf() {
+			if leafDepth == -1 {
+				leafDepth = depth
+			}
+			require.Equal(t, leafDepth, depth, "leaves at different depths")
+			leaves = append(leaves, id)
+			for i := 0; i < n.count(); i++ {
+				key := bt.rowKey(n, i)
+				inRange(key)
+				if last != nil {
+					require.Less(t, bt.compare(last, key), 0, "keys out of order")
+				}
+				last = append(Cell{}, key...)
+				keys = append(keys, key.AsString())
+			}
+			return
+		}
+		for i := 0; i < n.count(); i++ {
+			inRange(bt.keyAt(n, i))
+		}
+		for i := 0; i <= n.count(); i++ {
+			childLow, childHigh := low, high
+			if i > 0 {
+				childLow = append(Cell{}, bt.keyAt(n, i-1)...)
+			}
+			if i < n.count() {
+				childHigh = append(Cell{}, bt.keyAt(n, i)...)
+			}
+			walk(bt.child(n, i), depth+1, childLow, childHigh)
+		}
+	}
+	walk(0, 0, nil, nil)
+
+	for i, id := range leaves {
+		n, err := bt.readNode(id)
+		require.NoError(t, err)
+		if i == len(leaves)-1 {
+			require.Equal(t, PageID(0), n.next())
+		} else {
+			require.Equal(t, leaves[i+1], n.next())
+		}
+	}
+	//every page is either in the tree or free
+	for _, id := range bt.pages.freePages {
+		require.False(t, used[id], "free page %d is in the tree", id)
+		used[id] = true
+	}
+	require.Len(t, used, int(bt.pages.lastPage)+1)
+	return keys
+}
+
+func TestBtreeSplitsAndMerges(t *testing.T) {
+	b := newTestDatabase(t, "CREATE TABLE 'words' (word char(255) Primary Key, n int)")
+	r := rand.New(rand.NewSource(1))
+
+	expected := map[string]bool{}
+	order := r.Perm(3000)
+	tx := begin(t, b)
+	for _, i := range order {
+		word := fmt.Sprintf("w%05d", i)
+		_, err := tx.Insert(mustParse(t, fmt.Sprintf("INSERT INTO 'words' (word,n) VALUES ('%s','%d')", word, i)))
+		require.NoError(t, err)
+		expected[word] = true
+	}
+	table, err := tx.writableTable("words")
+	require.NoError(t, err)
+	bt := newBtree(tx, table)
+	require.Len(t, checkTree(t, bt), 3000)
+	root, err := bt.readNode(0)
+	require.NoError(t, err)
+	child, err := bt.readNode(bt.child(root, 0))
+	require.NoError(t, err)
+	require.False(t, child.isLeaf(), "tree should be three levels deep")
+
+	for _, i := range order[:2500] {
+		word := fmt.Sprintf("w%05d", i)
+		n, err := tx.Delete(mustParse(t, fmt.Sprintf("DELETE FROM 'words' WHERE word = '%s'", word)))
+		require.NoError(t, err)
+		require.Equal(t, int64(1), n)
+		delete(expected, word)
+	}
+	require.NotEmpty(t, table.freePages, "merged pages are freed")
+	keys := checkTree(t, bt)
+	require.Len(t, keys, len(expected))
+	for _, key := range keys {
+		require.True(t, expected[key])
+	}
+	require.NoError(t, tx.Commit())
+
+	reopened, err := OpenExistingDatabase(b.dir)
+	require.NoError(t, err)
+	require.Equal(t, b.tables[0].lastPage, reopened.tables[0].lastPage)
+	require.ElementsMatch(t, b.tables[0].freePages, reopened.tables[0].freePages)
+
+	//freed pages are reused before the file grows
+	tx = begin(t, reopened)
+	for _, i := range order[:500] {
+		_, err := tx.Insert(mustParse(t, fmt.Sprintf("INSERT INTO 'words' (word,n) VALUES ('w%05d','%d')", i, i)))
+		require.NoError(t, err)
+	}
+	table, err = tx.writableTable("words")
+	require.NoError(t, err)
+	require.Equal(t, reopened.tables[0].lastPage, table.lastPage)
+	require.Len(t, checkTree(t, newBtree(tx, table)), 1000)
+	require.NoError(t, tx.Rollback())
+
+	//everything deleted collapses back to an empty root leaf
+	_, err = reopened.Delete(mustParse(t, "DELETE FROM 'words' WHERE n >= '0'"))
+	require.NoError(t, err)
+	bt = newBtree(reopened.reader(), &reopened.tables[0])
+	require.Empty(t, checkTree(t, bt))
+	root, err = bt.readNode(0)
+	require.NoError(t, err)
+	require.True(t, root.isLeaf())
+}
+
+func TestBtreeKeyRange(t *testing.T) {
+	b := newTestDatabase(t, "CREATE TABLE 'items' (id int Primary Key, name char(8))")
+	values := make([]string, 0)
+	for i := 1; i <= 1000; i++ {
+		values = append(values, fmt.Sprintf("('%d','n%d')", i, i))
+	}
+	_, err := b.Insert(mustParse(t, "INSERT INTO 'items' (id,name) VALUES "+strings.Join(values, ",")))
+	require.NoError(t, err)
+
+	table := b.tables[0]
+	key, _ := table.primaryColumn()
+	filter, err := table.newRowFilter(mustParse(t, "SELECT id FROM 'items' WHERE id > '10' AND name != 'x' AND id <= '20' AND id < '500'").Where)
+	require.NoError(t, err)
+	from, to := filter.keyRange(key)
+	require.Equal(t, int64(10), from.AsInt())
+	require.Equal(t, int64(20), to.AsInt())
+
+	filter, err = table.newRowFilter(mustParse(t, "SELECT id FROM 'items' WHERE id > '10' OR id = '3'").Where)
+	require.NoError(t, err)
+	from, to = filter.keyRange(key)
+	require.Nil(t, from)
+	require.Nil(t, to)
+
+	rows := selectAll(t, b, "SELECT id FROM 'items' WHERE id > '10' AND id <= '13'")
+	require.Equal(t, [][]driver.Value{{int64(11)}, {int64(12)}, {int64(13)}}, rows)
+	require.Equal(t, [][]driver.Value{{int64(500), "n500"}}, selectAll(t, b, "SELECT * FROM 'items' WHERE id = '500'"))
+
+	//moving a row to a new primary key keeps the tree ordered
+	n, err := b.Update(mustParse(t, "UPDATE 'items' SET id = '5000' WHERE id = '1'"))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+	rows = selectAll(t, b, "SELECT id, name FROM 'items' WHERE id >= '1000'")
+	require.Equal(t, [][]driver.Value{{int64(1000), "n1000"}, {int64(5000), "n1"}}, rows)
+	_, err = b.Update(mustParse(t, "UPDATE 'items' SET id = '2' WHERE id = '3'"))
+	var constraintErr *ConstraintError
+	require.ErrorAs(t, err, &constraintErr)
+	require.Equal(t, PrimaryKeyConstraint, constraintErr.Kind)
+}
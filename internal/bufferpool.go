@@ -1,8 +1,8 @@
 package internal
 
 import (
+	"bytes"
 	"crypto/md5"
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"os"
@@ -31,9 +31,20 @@ type InternalPage struct {
 	pinned   bool
 }
 
+func validChecksum(buf *[PAGESIZE]byte) bool {
+	checksum := md5.Sum(buf[26:])
+	return bytes.Equal(buf[10:26], checksum[:])
+}
+
+func updateChecksum(buf *[PAGESIZE]byte) {
+	checksum := md5.Sum(buf[26:])
+	copy(buf[10:26], checksum[:])
+}
+
 type BufferPoolManager struct {
 	dir      string
 	allpools map[string]*bufferPool
+	mu       sync.RWMutex //guards allpools, pools come and go with tables and indexes while readers fetch pages
 }
 
 type bufferPool struct {
@@ -41,7 +52,8 @@ type bufferPool struct {
 	freelist       []int
 	mxread         *sync.Mutex
 	mxwrite        *sync.Mutex
-	pagemx         *sync.RWMutex
+	pagemx         *sync.RWMutex //guards the frame state of the slots, readers fetch pages concurrently
+	frameFree      *sync.Cond    //signalled on pagemx when a frame is unpinned
 	alltables      map[PageID]int
 	tablefileRead  *os.File
 	tablefileWrite *os.File
@@ -64,6 +76,7 @@ func (bm *BufferPoolManager) NewPool(tablename string, dir string) {
 		mxwrite:  &sync.Mutex{},
 		pagemx:   &sync.RWMutex{},
 	}
+	newPool.frameFree = sync.NewCond(newPool.pagemx)
 	for i := 0; i < MAXPOOLSIZE; i++ {
 		newPool.freelist[i] = i
 	}
@@ -83,64 +96,114 @@ func (bm *BufferPoolManager) NewPool(tablename string, dir string) {
 	}
 	newPool.tablefileRead, _ = os.OpenFile(filePathStr, os.O_RDONLY, 0644)
 	newPool.tablefileWrite, _ = os.OpenFile(filePathStr, os.O_WRONLY, 0644)
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
 	bm.allpools[tablename] = newPool
 }
 
-// func (bm *BufferPoolManager) ManagerFetchPage(tablename string, pageid PageID) (*InternalPage, int, error) {
-// 	pool, ok := bm.allpools[tablename]
-// 	if !ok {
-// 		return nil, -1, fmt.Errorf("table name: \"%s\" does not exist", tablename)
-// 	}
-// 	page, frameid := pool.FetchPage(pageid)
-// 	return page, frameid, nil
-// }
+func (bm *BufferPoolManager) pool(tablename string) (*bufferPool, bool) {
+	bm.mu.RLock()
+	defer bm.mu.RUnlock()
+	pool, ok := bm.allpools[tablename]
+	return pool, ok
+}
+
+// closes the table files and forgets every page held for the table
+func (bm *BufferPoolManager) RemovePool(tablename string) error {
+	bm.mu.Lock()
+	pool, ok := bm.allpools[tablename]
+	delete(bm.allpools, tablename)
+	bm.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("table name: \"%s\" does not exist", tablename)
+	}
+	pool.mxwrite.Lock()
+	defer pool.mxwrite.Unlock()
+	return errors.Join(pool.tablefileRead.Close(), pool.tablefileWrite.Close())
+}
+
+// page returned is pinned and must be released with UnpinPage
+func (bm *BufferPoolManager) FetchPage(tablename string, pageid PageID) (*InternalPage, error) {
+	pool, ok := bm.pool(tablename)
+	if !ok {
+		return nil, fmt.Errorf("table name: \"%s\" does not exist", tablename)
+	}
+	page := pool.FetchPage(pageid)
+	if page == nil {
+		return nil, errors.New("internal error fetching page")
+	}
+	return page, nil
+}
+
+// writes the page buffer to its position in the table file, Sync makes it durable
+func (bm *BufferPoolManager) WritePage(tablename string, pageid PageID, buf *[PAGESIZE]byte) error {
+	pool, ok := bm.pool(tablename)
+	if !ok {
+		return fmt.Errorf("table name: \"%s\" does not exist", tablename)
+	}
+	pool.mxwrite.Lock()
+	defer pool.mxwrite.Unlock()
+
+	_, err := pool.tablefileWrite.WriteAt(buf[:], int64(pageid)*PAGESIZE)
+	return err
+}
+
+func (bm *BufferPoolManager) Sync(tablename string) error {
+	pool, ok := bm.pool(tablename)
+	if !ok {
+		return fmt.Errorf("table name: \"%s\" does not exist", tablename)
+	}
+	return pool.tablefileWrite.Sync()
+}
 
 // returns nil if error occured
 func (b *bufferPool) FetchPage(pageid PageID) *InternalPage {
-	b.pagemx.RLock()
+	b.pagemx.Lock()
 	pagepos, ok := b.alltables[pageid]
 	if ok {
 		tmppage := b.slots[pagepos]
 		tmppage.pincount.Add(1)
 		tmppage.pinned = true
-		b.pagemx.RUnlock()
+		b.pagemx.Unlock()
 		return tmppage
 	}
 	//getframeid and have to allocate page from buffer if none free
-	b.pagemx.RUnlock()
+	b.pagemx.Unlock()
 	frameId := b.GetFrameID(pageid)
-	b.slots[frameId].pincount.Store(1)
-	b.slots[frameId].id = pageid
 	err := b.AllocatePage(pageid, frameId)
 	if err != nil {
+		b.Unpin(frameId)
 		return nil
 	}
 	return b.slots[frameId]
 }
 
+// frame pinned for the page, waits while every frame is pinned by other readers
 func (b *bufferPool) GetFrameID(pageid PageID) int {
 	b.pagemx.Lock()
 	defer b.pagemx.Unlock()
-	if len(b.freelist) > 0 {
-		frameID, newFreeList := b.freelist[0], b.freelist[1:]
-		b.freelist = newFreeList
-		b.slots[frameID].pinned = true
-		b.slots[frameID].slotid = frameID
-		return frameID
-	}
-	//return clockreplacer scan through pages pincount
 	for {
-		frameID := 0
-		for i := range b.slots {
-			if !b.slots[i].pinned && b.slots[i].pincount.Load() <= 0 {
-				delete(b.alltables, pageid)
-				frameID = i
-				break
+		frameID := -1
+		if len(b.freelist) > 0 {
+			frameID, b.freelist = b.freelist[0], b.freelist[1:]
+		} else {
+			//return clockreplacer scan through pages pincount
+			for i := range b.slots {
+				if !b.slots[i].pinned && b.slots[i].pincount.Load() <= 0 {
+					delete(b.alltables, b.slots[i].id)
+					frameID = i
+					break
+				}
 			}
-
+		}
+		if frameID == -1 {
+			b.frameFree.Wait()
+			continue
 		}
 		b.slots[frameID].pinned = true
 		b.slots[frameID].slotid = frameID
+		b.slots[frameID].pincount.Store(1)
+		b.slots[frameID].id = pageid
 		return frameID
 	}
 }
@@ -165,9 +228,11 @@ func (b *bufferPool) AllocatePage(pageid PageID, frameId int) error {
 }
 
 func (b *bufferPool) Unpin(frameId int) {
-	b.slots[frameId].pincount.Add(-1)
-	if b.slots[frameId].pincount.Load() <= 0 {
+	b.pagemx.Lock()
+	defer b.pagemx.Unlock()
+	if b.slots[frameId].pincount.Add(-1) <= 0 {
 		b.slots[frameId].pinned = false
+		b.frameFree.Signal()
 	}
 }
 
@@ -180,80 +245,14 @@ func (b *bufferPool) DeletePage(pageid PageID, frameid int) {
 }
 
 func (bm *BufferPoolManager) UnpinPage(tablename string, frameid int) {
-	pool := bm.allpools[tablename]
+	pool, _ := bm.pool(tablename)
 	pool.Unpin(frameid)
 }
 
-// return last page modified
-func (bm *BufferPoolManager) InsertData(tablename string, pageid PageID, data [][]byte) (PageID, error) {
-
-	pool, ok := bm.allpools[tablename]
-	if !ok {
-		return 0, fmt.Errorf("table name: \"%s\" does not exist", tablename)
-	}
-	pageToModify := pool.FetchPage(pageid)
-	if pageToModify == nil {
-		return 0, errors.New("internal error fetching page")
-	}
-	buf := pageToModify.buf //pointer
-	pool.mxwrite.Lock()
-	defer pool.mxwrite.Unlock()
-	f := pool.tablefileWrite
-
-	//numberOfPage := binary.LittleEndian.Uint64(buf[0:8])
-	rowNums := binary.LittleEndian.Uint16(buf[8:10])
-	//checksum := buf[10:26]
-
-	offset := 26 + int(rowNums)*len(data[0])
-
-	pgNum := pageid
-	for i := range data {
-		if offset+len(data[i]) > PAGESIZE {
-			//create new page and write old page
-			binary.LittleEndian.PutUint64(buf[0:8], uint64(pgNum))
-			binary.LittleEndian.PutUint16(buf[8:10], rowNums)
-			checksum := md5.Sum(buf[26:])
-			copy(buf[10:26], checksum[:])
-
-			f.Seek(int64(pgNum)*PAGESIZE, 0)
-			_, err := f.Write(buf[:])
-			if err != nil {
-				return 0, err
-			}
-			rowNums = 0
-			pgNum += 1
-			buf = [PAGESIZE]byte{}
-			binary.LittleEndian.PutUint64(buf[:], uint64(pgNum))
-			offset = 26
-		}
-		copy(buf[offset:], data[i])
-		offset += len(data[0])
-		rowNums += 1
-		fmt.Println("another row")
-	}
-
-	checksum := md5.Sum(buf[26:])
-	copy(buf[10:26], checksum[:])
-	binary.LittleEndian.PutUint16(buf[8:10], rowNums)
-
-	f.Seek(int64(pgNum)*PAGESIZE, 0)
-	_, err := f.Write(buf[:])
-	if err != nil {
-		return 0, err
-	}
-
-	f.Sync()
-
-	//deletes page from bufferpool and all data should be written to disk by this point
-	pool.DeletePage(pageid, pageToModify.slotid)
-
-	return pgNum, nil
-}
-
 func (bm *BufferPoolManager) SelectDataRange(tablename string, start, end PageID) []*InternalPage {
 	allpages := make([]*InternalPage, 0, end-start)
 
-	pool := bm.allpools[tablename]
+	pool, _ := bm.pool(tablename)
 	for i := start; i <= end; i++ {
 		page := pool.FetchPage(i)
 		allpages = append(allpages, page)
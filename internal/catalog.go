@@ -0,0 +1,188 @@
+package internal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+/*
+System catalog stored in main.db after the 100 byte header as a chain of consecutive pages
+- bytes 0-26 = usual page header, bytes 8-10 hold the number of catalog bytes in the page
+- bytes 26-34 = next catalog page, 0 on the last page
+- bytes 34-PAGESIZE = catalog bytes
+the catalog bytes are entries of kind (1 byte) | size (4 bytes) | definition ended by a zero kind
+so an entry may span pages and new kinds of objects only need a new kind
+the header holds the first page of the chain, a new catalog is written to pages the current chain
+does not use and only becomes the catalog when the header is switched to it once the pages are synced
+*/
+const (
+	catalogOffset     = 100
+	catalogRootOffset = 18 //bytes 18-26 of the header hold the first page of the catalog
+	catalogNextOffset = 26
+	catalogDataOffset = 34
+	catalogPageData   = PAGESIZE - catalogDataOffset
+)
+
+// pages of main.db holding the current catalog
+type catalogChain struct {
+	first PageID
+	pages int
+}
+
+type catalogKind byte
+
+const (
+	catalogEnd catalogKind = iota
+	catalogTable
+	catalogIndex
+)
+
+func catalogBytes(tables []Table) []byte {
+	buf := make([]byte, 0)
+	appendEntry := func(kind catalogKind, definition []byte) {
+		buf = append(buf, byte(kind))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(definition)))
+		buf = append(buf, definition...)
+	}
+	for _, table := range tables {
+		appendEntry(catalogTable, table.toBytes())
+	}
+	//indexes come after every table so they can be attached when read
+	for _, table := range tables {
+		for _, idx := range table.indexes {
+			appendEntry(catalogIndex, idx.toBytes())
+		}
+	}
+	return append(buf, byte(catalogEnd))
+}
+
+// splits the catalog bytes into pages chained from first, there is always at least one page
+func catalogPages(data []byte, first PageID) [][PAGESIZE]byte {
+	pages := make([][PAGESIZE]byte, (len(data)+catalogPageData-1)/catalogPageData)
+	for i := range pages {
+		buf := &pages[i]
+		n := copy(buf[catalogDataOffset:], data[i*catalogPageData:])
+		binary.LittleEndian.PutUint64(buf[0:8], uint64(first)+uint64(i))
+		binary.LittleEndian.PutUint16(buf[8:10], uint16(n))
+		if i+1 < len(pages) {
+			binary.LittleEndian.PutUint64(buf[catalogNextOffset:catalogNextOffset+8], uint64(first)+uint64(i+1))
+		}
+		updateChecksum(buf)
+	}
+	return pages
+}
+
+// writes the catalog of the tables before the current chain when it fits there, after it otherwise
+// then switches the header to it and cuts off the pages after it, a crash before the switch keeps the current catalog
+func writeCatalog(f *os.File, tables []Table, current catalogChain) (catalogChain, error) {
+	data := catalogBytes(tables)
+	chain := catalogChain{pages: (len(data) + catalogPageData - 1) / catalogPageData}
+	if chain.pages > int(current.first) {
+		chain.first = current.first + PageID(current.pages)
+	}
+	pages := catalogPages(data, chain.first)
+	for i := range pages {
+		if _, err := f.WriteAt(pages[i][:], catalogOffset+(int64(chain.first)+int64(i))*PAGESIZE); err != nil {
+			return current, err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return current, err
+	}
+	if _, err := f.WriteAt(binary.LittleEndian.AppendUint64(nil, uint64(chain.first)), catalogRootOffset); err != nil {
+		return current, err
+	}
+	if err := f.Sync(); err != nil {
+		return current, err
+	}
+	//the pages of the previous catalog after the new one are no longer used, when cutting them off fails
+	//they stay unused until the next catalog written cuts them off
+	f.Truncate(catalogOffset + (int64(chain.first)+int64(chain.pages))*PAGESIZE)
+	return chain, nil
+}
+
+// follows the page chain from first returning the catalog bytes and its pages, nil when no catalog was written yet
+func readCatalogBytes(f *os.File, first PageID) ([]byte, catalogChain, error) {
+	data := make([]byte, 0)
+	seen := make(map[uint64]bool)
+	chain := catalogChain{first: first}
+	id := uint64(first)
+	for {
+		buf := [PAGESIZE]byte{}
+		_, err := f.ReadAt(buf[:], catalogOffset+int64(id)*PAGESIZE)
+		if err == io.EOF && len(seen) == 0 {
+			return nil, chain, nil
+		}
+		if err != nil {
+			return nil, chain, err
+		}
+		if !validChecksum(&buf) || binary.LittleEndian.Uint64(buf[0:8]) != id {
+			return nil, chain, fmt.Errorf("catalog page %d corrupted", id)
+		}
+		n := int(binary.LittleEndian.Uint16(buf[8:10]))
+		if n > catalogPageData {
+			return nil, chain, fmt.Errorf("catalog page %d corrupted", id)
+		}
+		data = append(data, buf[catalogDataOffset:catalogDataOffset+n]...)
+		seen[id] = true
+		chain.pages++
+		id = binary.LittleEndian.Uint64(buf[catalogNextOffset : catalogNextOffset+8])
+		if id == 0 {
+			return data, chain, nil
+		}
+		if seen[id] {
+			return nil, chain, errors.New("catalog pages form a cycle")
+		}
+	}
+}
+
+// tables of the catalog starting at first with their indexes attached
+func readCatalog(f *os.File, first PageID) ([]Table, catalogChain, error) {
+	data, chain, err := readCatalogBytes(f, first)
+	if err != nil {
+		return nil, chain, err
+	}
+	tables := make([]Table, 0)
+	byteIndex := 0
+	for byteIndex < len(data) {
+		kind := catalogKind(data[byteIndex])
+		if kind == catalogEnd {
+			break
+		}
+		if byteIndex+5 > len(data) {
+			return nil, chain, errors.New("catalog entry truncated")
+		}
+		size := int(binary.LittleEndian.Uint32(data[byteIndex+1 : byteIndex+5]))
+		byteIndex += 5
+		if byteIndex+size > len(data) {
+			return nil, chain, errors.New("catalog entry truncated")
+		}
+		definition := data[byteIndex : byteIndex+size]
+		byteIndex += size
+
+		switch kind {
+		case catalogTable:
+			table := fromBytes(definition)
+			table.GenerateFields()
+			tables = append(tables, table)
+		case catalogIndex:
+			idx := indexFromBytes(definition)
+			found := false
+			for i := range tables {
+				if tables[i].Name == idx.Table {
+					tables[i].indexes = append(tables[i].indexes, idx)
+					found = true
+				}
+			}
+			if !found {
+				return nil, chain, fmt.Errorf("index %s on unknown table %s", idx.Name, idx.Table)
+			}
+		default:
+			return nil, chain, fmt.Errorf("unknown catalog entry kind %d", kind)
+		}
+	}
+	return tables, chain, nil
+}
@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCatalogSpansPages(t *testing.T) {
+	b := CreateNewDatabase(t.TempDir())
+	for i := 0; i < 40; i++ {
+		columns := []string{"id int Primary Key"}
+		for j := 0; j < 20; j++ {
+			columns = append(columns, fmt.Sprintf("%s_%d int", strings.Repeat("column", 8), j))
+		}
+		require.NoError(t, b.CreateTable(mustParse(t, fmt.Sprintf("CREATE TABLE 'table%d' (%s)", i, strings.Join(columns, ", ")))))
+	}
+	require.NoError(t, b.CreateIndex(mustParse(t, fmt.Sprintf("CREATE INDEX late ON 'table39' (%s_3)", strings.Repeat("column", 8)))))
+	_, err := b.Insert(mustParse(t, "INSERT INTO 'table39' (id) VALUES ('7')"))
+	require.NoError(t, err)
+
+	main := filepath.Join(b.dir, "main.db")
+	fi, err := os.Stat(main)
+	require.NoError(t, err)
+	pages := (fi.Size() - catalogOffset) / PAGESIZE
+	require.Greater(t, pages, int64(5), "40 tables of 21 columns need several pages")
+
+	reopened, err := OpenExistingDatabase(b.dir)
+	require.NoError(t, err)
+	require.Len(t, reopened.tables, 40)
+	for i, table := range reopened.tables {
+		require.Equal(t, fmt.Sprintf("table%d", i), table.Name)
+		require.Len(t, table.Columns, 21)
+	}
+	require.Len(t, reopened.tables[39].indexes, 1)
+	require.Len(t, selectAll(t, reopened, "SELECT id FROM 'table39'"), 1)
+
+	//dropped tables shrink the catalog
+	for i := 0; i < 39; i++ {
+		require.NoError(t, reopened.DropTable(mustParse(t, fmt.Sprintf("DROP TABLE 'table%d'", i))))
+	}
+	fi, err = os.Stat(main)
+	require.NoError(t, err)
+	require.Equal(t, int64(catalogOffset+PAGESIZE), fi.Size())
+	reopened, err = OpenExistingDatabase(b.dir)
+	require.NoError(t, err)
+	require.Len(t, reopened.tables, 1)
+	require.Len(t, reopened.tables[0].indexes, 1)
+}
+
+func TestCatalogCorruption(t *testing.T) {
+	b := newTestDatabase(t, "CREATE TABLE 'items' (id int Primary Key, name char(8))")
+	f, err := os.OpenFile(filepath.Join(b.dir, "main.db"), os.O_WRONLY, 0700)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("x"), catalogOffset+catalogDataOffset)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	_, err = OpenExistingDatabase(b.dir)
+	require.ErrorContains(t, err, "catalog page 0 corrupted")
+}
+
+func TestCatalogSwitch(t *testing.T) {
+	b := newTestDatabase(t, "CREATE TABLE 'first' (id int Primary Key)")
+	require.Equal(t, catalogChain{first: 0, pages: 1}, b.catalog)
+	require.NoError(t, b.CreateTable(mustParse(t, "CREATE TABLE 'second' (id int Primary Key)")))
+	require.Equal(t, catalogChain{first: 1, pages: 1}, b.catalog, "the new catalog does not overwrite the current one")
+	require.NoError(t, b.CreateTable(mustParse(t, "CREATE TABLE 'third' (id int Primary Key)")))
+	require.Equal(t, catalogChain{first: 0, pages: 1}, b.catalog, "pages before the current catalog are reused")
+
+	//a crash before the header is switched leaves the previous catalog in place
+	f, err := os.OpenFile(filepath.Join(b.dir, "main.db"), os.O_WRONLY, 0700)
+	require.NoError(t, err)
+	require.NoError(t, b.CreateTable(mustParse(t, "CREATE TABLE 'fourth' (id int Primary Key)")))
+	_, err = f.WriteAt([]byte{0, 0, 0, 0, 0, 0, 0, 0}, catalogRootOffset)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	reopened, err := OpenExistingDatabase(b.dir)
+	require.NoError(t, err)
+	require.Len(t, reopened.tables, 3)
+	require.Equal(t, "third", reopened.tables[2].Name)
+}
+
+func TestCatalogWriteError(t *testing.T) {
+	b := newTestDatabase(t, "CREATE TABLE 'items' (id int Primary Key, code int UNIQUE)")
+	main := filepath.Join(b.dir, "main.db")
+	require.NoError(t, os.Rename(main, main+".moved"))
+	require.NoError(t, os.Mkdir(main, 0700))
+
+	err := b.CreateTable(mustParse(t, "CREATE TABLE 'other' (id int Primary Key, code int UNIQUE)"))
+	require.Error(t, err)
+	require.Len(t, b.tables, 1)
+	_, err = os.Stat(filepath.Join(b.dir, "other.db"))
+	require.True(t, os.IsNotExist(err), "files of a table that could not be created are removed")
+	require.Error(t, b.CreateIndex(mustParse(t, "CREATE INDEX by_code ON 'items' (code)")))
+	require.Len(t, b.tables[0].indexes, 1, "an index is only published once the catalog holds it")
+	_, ok := b.bufferPool.pool("items.by_code.idx")
+	require.False(t, ok)
+	require.Error(t, b.DropTable(mustParse(t, "DROP TABLE 'items'")))
+	require.Len(t, b.tables, 1)
+
+	require.NoError(t, os.Remove(main))
+	require.NoError(t, os.Rename(main+".moved", main))
+	require.NoError(t, b.CreateIndex(mustParse(t, "CREATE INDEX by_code ON 'items' (code)")))
+	reopened, err := OpenExistingDatabase(b.dir)
+	require.NoError(t, err)
+	require.Len(t, reopened.tables[0].indexes, 2)
+}
+
+func TestFormatVersion(t *testing.T) {
+	b := newTestDatabase(t, "CREATE TABLE 'items' (id int Primary Key)")
+	f, err := os.OpenFile(filepath.Join(b.dir, "main.db"), os.O_WRONLY, 0700)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("Fusedb format 1\x00"), 0)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	_, err = OpenExistingDatabase(b.dir)
+	require.ErrorContains(t, err, `unsupported version "Fusedb format 1"`)
+}
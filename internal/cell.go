@@ -2,7 +2,12 @@ package internal
 
 import (
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"math"
+	"strconv"
+	"strings"
+	"time"
 )
 
 /*
@@ -14,6 +19,32 @@ func (c *Cell) AsInt() int64 {
 	return int64(binary.LittleEndian.Uint64(*c))
 }
 
+// AsSigned decodes a TINYINT, SMALLINT, INTEGER or INT cell by its width
+func (c *Cell) AsSigned() int64 {
+	switch len(*c) {
+	case 1:
+		return int64(int8((*c)[0]))
+	case 2:
+		return int64(int16(binary.LittleEndian.Uint16(*c)))
+	case 4:
+		return int64(int32(binary.LittleEndian.Uint32(*c)))
+	}
+	return c.AsInt()
+}
+
+// AsUnsigned decodes a cell of an unsigned integer column by its width
+func (c *Cell) AsUnsigned() uint64 {
+	switch len(*c) {
+	case 1:
+		return uint64((*c)[0])
+	case 2:
+		return uint64(binary.LittleEndian.Uint16(*c))
+	case 4:
+		return uint64(binary.LittleEndian.Uint32(*c))
+	}
+	return binary.LittleEndian.Uint64(*c)
+}
+
 func (c *Cell) AsFloat() float64 {
 	return math.Float64frombits(binary.LittleEndian.Uint64(*c))
 }
@@ -22,6 +53,223 @@ func (c *Cell) AsBool() bool {
 	return (*c)[0] != 0
 }
 
+// DATE cells hold the number of days since 1970-01-01
+func (c *Cell) AsDate() time.Time {
+	return time.Unix(c.AsInt()*secondsPerDay, 0).UTC()
+}
+
+// TIMESTAMP cells hold microseconds since the Unix epoch in UTC
+func (c *Cell) AsTimestamp() time.Time {
+	return time.UnixMicro(c.AsInt()).UTC()
+}
+
+// INTERVAL cells hold nanoseconds like time.Duration
+func (c *Cell) AsInterval() time.Duration {
+	return time.Duration(c.AsInt())
+}
+
+// CHAR cells are zero padded up to the column size so padding is trimmed, VARCHAR and TEXT cells are not padded
 func (c *Cell) AsString() string {
-	return string(*c)
+	return strings.TrimRight(string(*c), "\x00")
+}
+
+// encodeValue converts a literal into the bytes stored for the column
+// quoted strings are read as the column type while unquoted literals must be of a matching type
+func encodeValue(col Column, v Value) (Cell, error) {
+	if !valueFits(v.Kind, col.columnType) {
+		return nil, fmt.Errorf("type mismatch: cannot use %s %s as %s for column %s", v.Kind, v.Text, typeName(col.columnType), col.columnName)
+	}
+	return encodeCell(col, v.Text)
+}
+
+// integers fit any numeric column, floats FLOAT and DECIMAL columns and booleans BOOL columns
+func valueFits(kind ValueKind, typ uint8) bool {
+	switch kind {
+	case IntValue:
+		return isNumeric(typ)
+	case FloatValue:
+		return typ == FLOAT || typ == DECIMAL
+	case BoolValue:
+		return typ == BOOL
+	}
+	return true
+}
+
+// encodeCell converts the string form of a value into the bytes stored for the column
+func encodeCell(col Column, val string) (Cell, error) {
+	b := make([]byte, 0, col.width())
+	switch col.columnType {
+	case INT:
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			return nil, err
+		}
+		b = binary.LittleEndian.AppendUint64(b, uint64(n))
+	case FLOAT:
+		n, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return nil, err
+		}
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(n))
+	case BOOL:
+		n, err := strconv.ParseBool(val)
+		if err != nil {
+			return nil, err
+		}
+		if n {
+			b = append(b, byte(1))
+		} else {
+			b = append(b, byte(0))
+		}
+	case CHAR:
+		n := []byte(val)
+		if len(n) > int(col.columnSize) {
+			return nil, errors.New("string to insert larger than allowed")
+		}
+		b = append(b, n...)
+	case VARCHAR:
+		if len(val) > int(col.columnSize) {
+			return nil, errors.New("string to insert larger than allowed")
+		}
+		b = append(b, val...)
+	case TEXT, BLOB:
+		b = append(b, val...)
+	case DATE:
+		t, err := parseDate(val)
+		if err != nil {
+			return nil, err
+		}
+		days := t.Unix() / secondsPerDay
+		if t.Unix()%secondsPerDay < 0 {
+			days-- //days before 1970 round down
+		}
+		b = binary.LittleEndian.AppendUint64(b, uint64(days))
+	case TIMESTAMP:
+		t, err := parseTimestamp(val)
+		if err != nil {
+			return nil, err
+		}
+		b = binary.LittleEndian.AppendUint64(b, uint64(t.UnixMicro()))
+	case INTERVAL:
+		d, err := parseInterval(val)
+		if err != nil {
+			return nil, err
+		}
+		b = binary.LittleEndian.AppendUint64(b, uint64(d))
+	case DECIMAL:
+		return encodeDecimal(val, int(col.precision), int(col.scale))
+	case TINYINT, SMALLINT, INTEGER, UTINYINT, USMALLINT, UINTEGER, UBIGINT:
+		n, err := parseInteger(col, val)
+		if err != nil {
+			return nil, err
+		}
+		switch col.columnSize {
+		case 1:
+			b = append(b, byte(n))
+		case 2:
+			b = binary.LittleEndian.AppendUint16(b, uint16(n))
+		case 4:
+			b = binary.LittleEndian.AppendUint32(b, uint32(n))
+		default:
+			b = binary.LittleEndian.AppendUint64(b, n)
+		}
+	default:
+		return nil, errors.ErrUnsupported
+	}
+	return b, nil
+}
+
+// parseInteger reads a value for an integer column checking it fits the column, signed values come back as two's complement
+func parseInteger(col Column, val string) (uint64, error) {
+	bits := int(col.columnSize) * 8
+	var n uint64
+	var err error
+	if isUnsigned(col.columnType) {
+		n, err = strconv.ParseUint(val, 10, bits)
+		if err != nil && strings.HasPrefix(val, "-") {
+			if _, signedErr := strconv.ParseInt(val, 10, 64); signedErr == nil {
+				err = strconv.ErrRange //negative numbers never fit
+			}
+		}
+	} else {
+		var signed int64
+		signed, err = strconv.ParseInt(val, 10, bits)
+		n = uint64(signed)
+	}
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, fmt.Errorf("value %s out of range for %s", val, typeName(col.columnType))
+	}
+	return n, err
+}
+
+const secondsPerDay = 24 * 60 * 60
+
+// layouts accepted for TIMESTAMP literals, a fraction of a second may follow the seconds of any of them
+// and times without a zone are in UTC
+var timestampLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+func parseTimestamp(val string) (time.Time, error) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, val); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid ISO-8601 timestamp: %s", val)
+}
+
+// date as written in the literal, the time and zone of a timestamp literal are dropped
+func parseDate(val string) (time.Time, error) {
+	t, err := parseTimestamp(val)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid ISO-8601 date: %s", val)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+}
+
+// INTERVAL literals are Go durations like 1h30m or ISO-8601 durations like P1DT12H without years and months
+func parseInterval(val string) (time.Duration, error) {
+	if d, err := time.ParseDuration(val); err == nil {
+		return d, nil
+	}
+	s, sign := val, time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		s, sign = s[1:], -1
+	}
+	if !strings.HasPrefix(s, "P") || len(s) < 2 {
+		return 0, fmt.Errorf("invalid interval: %s", val)
+	}
+	units := map[byte]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour}
+	timeUnits := map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+	var d time.Duration
+	number := ""
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= '0' && c <= '9' || c == '.':
+			number += string(c)
+		case c == 'T':
+			if number != "" {
+				return 0, fmt.Errorf("invalid interval: %s", val)
+			}
+			units = timeUnits
+		default:
+			unit, ok := units[c]
+			n, err := strconv.ParseFloat(number, 64)
+			if !ok || err != nil {
+				return 0, fmt.Errorf("invalid interval: %s", val)
+			}
+			d += time.Duration(n * float64(unit))
+			number = ""
+		}
+	}
+	if number != "" {
+		return 0, fmt.Errorf("invalid interval: %s", val)
+	}
+	return sign * d, nil
 }
@@ -17,25 +17,41 @@ const (
 	COL_I_NULL
 )
 
+const varSlotSize = 8 //offset and length of a VARCHAR, TEXT or BLOB value inside its row
+
 /*
 ColumnType values are define in parser.go
 */
 type Column struct {
 	columnName       string
-	columnType       uint8 //data type
-	columnSize       uint8 //size of column in database in bytes
+	columnType       uint8  //data type
+	columnSize       uint16 //size of column in database in bytes, the longest value of a VARCHAR and 0 for TEXT and BLOB
 	columnConstraint uint8
-	columnOffset     int
+	precision        uint8 //digits of a DECIMAL column
+	scale            uint8 //digits of a DECIMAL column after the decimal point
+	columnOffset     int   //offset in the fixed part of a row
 	columnIndex      int
 }
 
+// VARCHAR, TEXT and BLOB values are stored after the fixed part of a row which only holds where they are
+func (c Column) isVariable() bool {
+	return c.columnType == VARCHAR || c.columnType == TEXT || c.columnType == BLOB
+}
+
+// bytes the column takes in the fixed part of a row
+func (c Column) width() int {
+	if c.isVariable() {
+		return varSlotSize
+	}
+	return int(c.columnSize)
+}
+
 type ResultColumn struct {
 	Name       string
 	ColumnType uint8
 }
 
 type InsertColumn struct {
-	columnSize  uint8
 	colType     insertType
 	dataType    uint8
 	insertIndex int
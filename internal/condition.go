@@ -0,0 +1,471 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// condition from a WHERE clause with its columns resolved against a table
+type boundCondition struct {
+	left         Column
+	right        Column
+	rightIsField bool
+	literal      Cell
+	literalType  uint8 //type the literal is encoded as, wider than an integer column it is out of range for
+	nullLiteral  bool  //compared with NULL, never true
+	operator     Operator
+}
+
+// WHERE expression tree with every condition bound to the table
+type boundExpression struct {
+	exprType  ExpressionType
+	condition boundCondition
+	left      *boundExpression
+	right     *boundExpression
+}
+
+// result of evaluating a WHERE expression using SQL three valued logic
+type truth uint8
+
+const (
+	truthFalse truth = iota
+	truthTrue
+	truthUnknown
+)
+
+// rowFilter evaluates the WHERE clause of a query against rows stored in a table
+// or the HAVING clause against the rows of a table holding the groups
+type rowFilter struct {
+	table *Table
+	where *boundExpression
+}
+
+func (t *Table) newRowFilter(where *Expression) (*rowFilter, error) {
+	return t.newClauseFilter("WHERE", where)
+}
+
+// clause names the clause in the errors of its conditions
+func (t *Table) newClauseFilter(clause string, where *Expression) (*rowFilter, error) {
+	f := &rowFilter{table: t}
+	if where == nil {
+		return f, nil
+	}
+	bound, err := t.bindExpression(clause, where)
+	if err != nil {
+		return nil, err
+	}
+	f.where = bound
+	return f, nil
+}
+
+func (t *Table) bindExpression(clause string, e *Expression) (*boundExpression, error) {
+	bound := &boundExpression{exprType: e.Type}
+	switch e.Type {
+	case ConditionExpression:
+		c, err := t.bindCondition(clause, e.Condition)
+		if err != nil {
+			return nil, err
+		}
+		bound.condition = c
+	case AndExpression, OrExpression:
+		left, err := t.bindExpression(clause, e.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := t.bindExpression(clause, e.Right)
+		if err != nil {
+			return nil, err
+		}
+		bound.left, bound.right = left, right
+	case NotExpression:
+		operand, err := t.bindExpression(clause, e.Left)
+		if err != nil {
+			return nil, err
+		}
+		bound.left = operand
+	default:
+		return nil, fmt.Errorf("%s: unknown expression", clause)
+	}
+	return bound, nil
+}
+
+func (t *Table) bindCondition(clause string, c Condition) (boundCondition, error) {
+	bound := boundCondition{operator: c.Operator}
+	col, ok := t.getColumn(c.Operand1)
+	if !ok {
+		return bound, fmt.Errorf("%s: column not in table: %s", clause, c.Operand1)
+	}
+	bound.left = col
+	bound.literalType = col.columnType
+
+	if c.Operator == IsNull || c.Operator == IsNotNull {
+		return bound, nil
+	}
+	if c.Operand2IsField {
+		col, ok := t.getColumn(c.Operand2)
+		if !ok {
+			return bound, fmt.Errorf("%s: column not in table: %s", clause, c.Operand2)
+		}
+		if !comparableTypes(bound.left.columnType, col.columnType) {
+			return bound, fmt.Errorf("%s: cannot compare %s column %s with %s column %s", clause,
+				typeName(bound.left.columnType), bound.left.columnName, typeName(col.columnType), col.columnName)
+		}
+		bound.right = col
+		bound.rightIsField = true
+	} else if c.Operand2Kind == NullValue {
+		bound.nullLiteral = true
+	} else if !valueFits(c.Operand2Kind, bound.left.columnType) {
+		return bound, fmt.Errorf("%s: type mismatch: cannot compare %s column %s with %s %s", clause,
+			typeName(bound.left.columnType), bound.left.columnName, c.Operand2Kind, c.Operand2)
+	} else if isText(bound.left.columnType) || bound.left.columnType == BLOB {
+		//literal may be longer than the column and simply never be equal
+		bound.literal = Cell(c.Operand2)
+	} else if bound.left.columnType == DECIMAL {
+		//literal keeps its own scale so digits past the column scale are not rounded away
+		cell, err := encodeDecimalLiteral(c.Operand2)
+		if err != nil {
+			return bound, fmt.Errorf("%s: invalid DECIMAL value for column %s: %s", clause, bound.left.columnName, c.Operand2)
+		}
+		bound.literal = cell
+	} else if cell, err := encodeCell(bound.left, c.Operand2); err == nil {
+		bound.literal = cell
+	} else if cell, typ, err := widenedLiteral(c.Operand2); err == nil && isInteger(bound.left.columnType) {
+		//a literal out of the range of the column is compared by value, tiny < 1000 holds for every row
+		bound.literal, bound.literalType = cell, typ
+	} else {
+		return bound, fmt.Errorf("%s: invalid %s value for column %s: %s", clause, typeName(bound.left.columnType), bound.left.columnName, c.Operand2)
+	}
+	return bound, nil
+}
+
+// number encoded as an INT, a UBIGINT above the INT range or a DECIMAL for any other number
+func widenedLiteral(val string) (Cell, uint8, error) {
+	if n, err := strconv.ParseInt(val, 10, 64); err == nil {
+		return binary.LittleEndian.AppendUint64(nil, uint64(n)), INT, nil
+	}
+	if n, err := strconv.ParseUint(val, 10, 64); err == nil {
+		return binary.LittleEndian.AppendUint64(nil, n), UBIGINT, nil
+	}
+	cell, err := encodeDecimalLiteral(val)
+	return cell, DECIMAL, err
+}
+
+// conditions joined by AND at the top of the WHERE clause, each must hold for a row to match
+func (f *rowFilter) conjuncts() []boundCondition {
+	conditions := make([]boundCondition, 0)
+	var collect func(e *boundExpression)
+	collect = func(e *boundExpression) {
+		switch e.exprType {
+		case AndExpression:
+			collect(e.left)
+			collect(e.right)
+		case ConditionExpression:
+			conditions = append(conditions, e.condition)
+		}
+	}
+	if f.where != nil {
+		collect(f.where)
+	}
+	return conditions
+}
+
+// keyRange gives the smallest and largest value of col allowed by the top level conditions on it, nil bounds are open
+func (f *rowFilter) keyRange(col Column) (from, to Cell) {
+	for _, c := range f.conjuncts() {
+		//literals out of the range of the column cannot bound its values in a tree
+		if c.rightIsField || c.nullLiteral || c.left.columnIndex != col.columnIndex || c.literalType != col.columnType {
+			continue
+		}
+		switch c.operator {
+		case Eq, Gt, Gte:
+			if from == nil || compareCells(col.columnType, c.literal, col.columnType, from) > 0 {
+				from = c.literal
+			}
+		}
+		switch c.operator {
+		case Eq, Lt, Lte:
+			if to == nil || compareCells(col.columnType, c.literal, col.columnType, to) < 0 {
+				to = c.literal
+			}
+		}
+	}
+	return from, to
+}
+
+// indexRange picks the secondary index whose leading columns are best narrowed by the WHERE clause
+// returning the bounds of the scan as index entry prefixes, nil when no index helps
+func (f *rowFilter) indexRange(t *Table) (*Index, Cell, Cell) {
+	var best *Index
+	var bestFrom, bestTo Cell
+	bestScore := 0
+	for i := range t.indexes {
+		idx := &t.indexes[i]
+		from, to := make(Cell, 0), make(Cell, 0)
+		score := 0
+		for _, col := range idx.columns(t) {
+			lo, hi := f.keyRange(col)
+			if (lo == nil && hi == nil) || len(lo) > int(col.columnSize) || len(hi) > int(col.columnSize) {
+				break
+			}
+			if lo != nil && hi != nil && compareCells(col.columnType, lo, col.columnType, hi) == 0 {
+				from, to = appendIndexCell(from, col, lo), appendIndexCell(to, col, hi)
+				score += 2
+				continue
+			}
+			if lo != nil {
+				from = appendIndexCell(from, col, lo)
+			}
+			if hi != nil {
+				to = appendIndexCell(to, col, hi)
+			}
+			score++
+			break
+		}
+		if score > bestScore {
+			best, bestFrom, bestTo, bestScore = idx, from, to, score
+		}
+	}
+	if len(bestFrom) == 0 {
+		bestFrom = nil
+	}
+	if len(bestTo) == 0 {
+		bestTo = nil
+	}
+	return best, bestFrom, bestTo
+}
+
+// literal laid out like a cell of an index entry
+func appendIndexCell(entry Cell, col Column, literal Cell) Cell {
+	cell := make(Cell, col.columnSize)
+	copy(cell, literal)
+	entry = append(entry, 1)
+	return append(entry, cell...)
+}
+
+// match reports whether the row satisfies the WHERE clause, unknown results do not match
+func (f *rowFilter) match(row []byte) bool {
+	if f.where == nil {
+		return true
+	}
+	rowbitset := f.table.newRowBitSet()
+	rowbitset.fromBytes(row[:rowbitset.Size()])
+	return f.eval(f.where, row, rowbitset) == truthTrue
+}
+
+func (f *rowFilter) eval(e *boundExpression, row []byte, rowbitset BitSet) truth {
+	switch e.exprType {
+	case AndExpression:
+		left := f.eval(e.left, row, rowbitset)
+		if left == truthFalse {
+			return truthFalse
+		}
+		right := f.eval(e.right, row, rowbitset)
+		if right == truthFalse {
+			return truthFalse
+		}
+		if left == truthUnknown || right == truthUnknown {
+			return truthUnknown
+		}
+		return truthTrue
+	case OrExpression:
+		left := f.eval(e.left, row, rowbitset)
+		if left == truthTrue {
+			return truthTrue
+		}
+		right := f.eval(e.right, row, rowbitset)
+		if right == truthTrue {
+			return truthTrue
+		}
+		if left == truthUnknown || right == truthUnknown {
+			return truthUnknown
+		}
+		return truthFalse
+	case NotExpression:
+		switch f.eval(e.left, row, rowbitset) {
+		case truthTrue:
+			return truthFalse
+		case truthFalse:
+			return truthTrue
+		}
+		return truthUnknown
+	}
+	return f.evalCondition(e.condition, row, rowbitset)
+}
+
+// comparing against a null column is unknown, only IS NULL and IS NOT NULL test for nulls
+func (f *rowFilter) evalCondition(c boundCondition, row []byte, rowbitset BitSet) truth {
+	switch c.operator {
+	case IsNull, IsNotNull:
+		if rowbitset.hasBit(c.left.columnIndex) == (c.operator == IsNull) {
+			return truthTrue
+		}
+		return truthFalse
+	}
+	if rowbitset.hasBit(c.left.columnIndex) || c.nullLiteral {
+		return truthUnknown
+	}
+	left := f.table.cellAt(row, c.left)
+	right, rightType := c.literal, c.literalType
+	if c.rightIsField {
+		if rowbitset.hasBit(c.right.columnIndex) {
+			return truthUnknown
+		}
+		right, rightType = f.table.cellAt(row, c.right), c.right.columnType
+	}
+	if c.operator.holds(compareCells(c.left.columnType, left, rightType, right)) {
+		return truthTrue
+	}
+	return truthFalse
+}
+
+func (o Operator) holds(cmp int) bool {
+	switch o {
+	case Eq:
+		return cmp == 0
+	case Ne:
+		return cmp != 0
+	case Gt:
+		return cmp > 0
+	case Lt:
+		return cmp < 0
+	case Gte:
+		return cmp >= 0
+	case Lte:
+		return cmp <= 0
+	}
+	return false
+}
+
+func comparableTypes(a, b uint8) bool {
+	return a == b || (isNumeric(a) && isNumeric(b)) || (isText(a) && isText(b))
+}
+
+func isNumeric(typ uint8) bool {
+	return isInteger(typ) || typ == FLOAT || typ == DECIMAL
+}
+
+func isInteger(typ uint8) bool {
+	switch typ {
+	case INT, TINYINT, SMALLINT, INTEGER, UTINYINT, USMALLINT, UINTEGER, UBIGINT:
+		return true
+	}
+	return false
+}
+
+func isUnsigned(typ uint8) bool {
+	return typ == UTINYINT || typ == USMALLINT || typ == UINTEGER || typ == UBIGINT
+}
+
+func isText(typ uint8) bool {
+	return typ == CHAR || typ == VARCHAR || typ == TEXT
+}
+
+// compareCells returns -1, 0 or 1 comparing two cells of comparable types
+func compareCells(ltype uint8, l Cell, rtype uint8, r Cell) int {
+	if isText(ltype) && isText(rtype) {
+		return strings.Compare(l.AsString(), r.AsString())
+	}
+	if isInteger(ltype) && isInteger(rtype) {
+		return compareIntegers(ltype, l, rtype, r)
+	}
+	if (ltype == DECIMAL || rtype == DECIMAL) && ltype != FLOAT && rtype != FLOAT {
+		a, ascale := cellAsDecimal(ltype, l)
+		b, bscale := cellAsDecimal(rtype, r)
+		return compareDecimals(a, ascale, b, bscale)
+	}
+	if ltype != rtype {
+		return compareFloats(cellAsFloat(ltype, l), cellAsFloat(rtype, r))
+	}
+	switch ltype {
+	case DATE, TIMESTAMP, INTERVAL:
+		a, b := l.AsInt(), r.AsInt()
+		if a < b {
+			return -1
+		} else if a > b {
+			return 1
+		}
+		return 0
+	case FLOAT:
+		return compareFloats(l.AsFloat(), r.AsFloat())
+	case BOOL:
+		a, b := l.AsBool(), r.AsBool()
+		if a == b {
+			return 0
+		} else if b {
+			return -1
+		}
+		return 1
+	case BLOB:
+		return bytes.Compare(l, r)
+	}
+	return 0
+}
+
+// integers of any width compare exactly, only unsigned values above the int64 range need care
+func compareIntegers(ltype uint8, l Cell, rtype uint8, r Cell) int {
+	if isUnsigned(ltype) && isUnsigned(rtype) {
+		a, b := l.AsUnsigned(), r.AsUnsigned()
+		if a < b {
+			return -1
+		} else if a > b {
+			return 1
+		}
+		return 0
+	}
+	if isUnsigned(ltype) && l.AsUnsigned() > math.MaxInt64 {
+		return 1
+	}
+	if isUnsigned(rtype) && r.AsUnsigned() > math.MaxInt64 {
+		return -1
+	}
+	a, b := cellAsInt(ltype, l), cellAsInt(rtype, r)
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// value of a cell of any integer type, unsigned values above the int64 range wrap around
+func cellAsInt(typ uint8, c Cell) int64 {
+	if isUnsigned(typ) {
+		return int64(c.AsUnsigned())
+	}
+	return c.AsSigned()
+}
+
+func compareFloats(a, b float64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func cellAsFloat(typ uint8, c Cell) float64 {
+	switch {
+	case isUnsigned(typ):
+		return float64(c.AsUnsigned())
+	case isInteger(typ):
+		return float64(c.AsSigned())
+	case typ == DECIMAL:
+		unscaled, scale := c.AsDecimal()
+		f, _ := new(big.Rat).SetFrac(unscaled, pow10(scale)).Float64()
+		return f
+	}
+	return c.AsFloat()
+}
+
+func typeName(typ uint8) string {
+	if typ == 0 || int(typ) > len(reservedTypes) {
+		return "UNKNOWN"
+	}
+	return reservedTypes[typ-1]
+}
@@ -1,6 +1,11 @@
 package internal
 
+import "time"
+
 const (
 	PAGESIZE    = 4096
 	MAXPOOLSIZE = 10
+	SORTMEMORY  = 8 << 20               //bytes of rows ORDER BY sorts in memory before spilling runs to disk
+	BUSYTIMEOUT = 5 * time.Second       //longest a write waits for the transaction writing before failing with ErrBusy
+	FORMAT      = "Fusedb format 2\x00" //header of main.db, version 2 holds the catalog chain and overflow pages
 )
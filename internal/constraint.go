@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"fmt"
+)
+
+type ConstraintKind uint8
+
+const (
+	PrimaryKeyConstraint ConstraintKind = iota + 1
+	UniqueConstraint
+	NotNullConstraint
+)
+
+func (k ConstraintKind) String() string {
+	switch k {
+	case PrimaryKeyConstraint:
+		return "PRIMARY KEY"
+	case UniqueConstraint:
+		return "UNIQUE"
+	case NotNullConstraint:
+		return "NOT NULL"
+	}
+	return "unknown"
+}
+
+// ConstraintError is returned when a write would break a column constraint
+type ConstraintError struct {
+	Kind   ConstraintKind
+	Table  string
+	Column string
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("%s constraint failed: %s.%s", e.Kind, e.Table, e.Column)
+}
+
+// constraint of a column from the tokens following its type in CREATE
+func parseConstraint(column string, tokens []string) (uint8, error) {
+	primary, unique, notnull := false, false, false
+	for _, val := range tokens {
+		if !isConstraint(val) {
+			return 0, fmt.Errorf("CREATE: unsupported token in create field for column: %s", column)
+		}
+		switch val {
+		case "PRIMARY KEY":
+			primary = true
+		case "UNIQUE":
+			unique = true
+		case "NOT NULL":
+			notnull = true
+		}
+	}
+	switch {
+	case primary:
+		return COL_PRIMARY, nil
+	case unique && notnull:
+		return COL_NOTNULLUNIQUE, nil
+	case unique:
+		return COL_UNIQUE, nil
+	case notnull:
+		return COL_NOTNULL, nil
+	}
+	return 0, nil
+}
+
+func (c Column) isUnique() bool {
+	switch c.columnConstraint {
+	case COL_UNIQUE, COL_NOTNULLUNIQUE, COL_PRIMARY, COL_ROWID:
+		return true
+	}
+	return false
+}
+
+func (c Column) isNotNull() bool {
+	switch c.columnConstraint {
+	case COL_NOTNULL, COL_NOTNULLUNIQUE, COL_PRIMARY, COL_ROWID:
+		return true
+	}
+	return false
+}
+
+func (c Column) uniqueKind() ConstraintKind {
+	if c.columnConstraint == COL_PRIMARY || c.columnConstraint == COL_ROWID {
+		return PrimaryKeyConstraint
+	}
+	return UniqueConstraint
+}
+
+// name of the unique index created with the table for a column declared UNIQUE
+func uniqueIndexName(table, column string) string {
+	return fmt.Sprintf("%s_%s_unique", table, column)
+}
+
+// reports whether the index was created for a column declared UNIQUE and enforces it
+func (idx *Index) backsUnique(t *Table) bool {
+	if len(idx.Columns) != 1 || idx.Name != uniqueIndexName(t.Name, idx.Columns[0]) {
+		return false
+	}
+	col, ok := t.getColumn(idx.Columns[0])
+	return ok && col.isUnique()
+}
+
+// checks new rows against NOT NULL and against the primary keys of the table and each other
+// other unique columns are checked through their indexes by checkUniqueIndexes
+func (tx *Transaction) checkInsert(t *Table, rows [][]byte) error {
+	bt := newBtree(tx, t)
+	rowbitset := t.newRowBitSet()
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		rowbitset.fromBytes(row[:rowbitset.Size()])
+		for _, col := range t.Columns {
+			if rowbitset.hasBit(col.columnIndex) && col.isNotNull() {
+				return &ConstraintError{Kind: NotNullConstraint, Table: t.Name, Column: col.columnName}
+			}
+		}
+		key := t.cellAt(row, bt.key)
+		_, taken, err := bt.get(key)
+		if err != nil {
+			return err
+		}
+		if taken || seen[string(key)] {
+			return bt.duplicate
+		}
+		seen[string(key)] = true
+	}
+	return nil
+}
+
+// checks that setting the primary key to cell on the rows with the given primary keys keeps it unique
+func (tx *Transaction) checkUpdate(t *Table, col Column, cell Cell, primaries []string) error {
+	bt := newBtree(tx, t)
+	if col.columnIndex != bt.key.columnIndex || len(primaries) == 0 || cell == nil {
+		return nil
+	}
+	if len(primaries) > 1 {
+		return bt.duplicate
+	}
+	_, taken, err := bt.get(cell)
+	if err != nil {
+		return err
+	}
+	if taken && string(cell) != primaries[0] {
+		return bt.duplicate
+	}
+	return nil
+}
@@ -1,30 +1,38 @@
 package internal
 
 import (
-	"bytes"
-	"crypto/md5"
+	"context"
 	"database/sql/driver"
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"io"
 	"math"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Backend struct {
-	dir        string
-	mainFile   *os.File
-	tables     []Table
-	bufferPool *BufferPoolManager
+	dir         string
+	mainFile    *os.File
+	tables      []Table
+	bufferPool  *BufferPoolManager
+	wal         *writeAheadLog
+	writer      chan struct{} //holds a token while the one transaction allowed to write at a time runs
+	mu          sync.RWMutex  //guards tables and committed pages against readers while publishing
+	sortMemory  int
+	busyTimeout time.Duration
+	catalog     catalogChain   //pages of main.db holding the catalog of tables
+	readers     map[*Rows]bool //rows reading committed pages, read whole before a commit changes their tables
+	readersMu   sync.Mutex     //guards readers, taken after mu
 }
 
 func CreateNewDatabase(dir string) *Backend {
 	buf := make([]byte, 100) //reserves first hundred bytes of main file for header
-	headername := []byte("Fusedb format 1\x00")
+	headername := []byte(FORMAT)
 	copy(buf[0:16], headername)
 	binary.LittleEndian.PutUint16(buf[16:18], uint16(PAGESIZE))
 
@@ -37,11 +45,16 @@ func CreateNewDatabase(dir string) *Backend {
 	if err != nil {
 		panic(err)
 	}
-	return &Backend{dir: dir, mainFile: f, tables: make([]Table, 0), bufferPool: NewBufferPool(dir)}
+	wal, err := openWAL(dir)
+	if err != nil {
+		panic(err)
+	}
+	return &Backend{dir: dir, mainFile: f, tables: make([]Table, 0), bufferPool: NewBufferPool(dir), wal: wal, sortMemory: SORTMEMORY,
+		writer: make(chan struct{}, 1), busyTimeout: BUSYTIMEOUT}
 }
 
 func OpenExistingDatabase(dir string) (*Backend, error) {
-	b := Backend{dir: dir, bufferPool: NewBufferPool(dir)}
+	b := Backend{dir: dir, bufferPool: NewBufferPool(dir), sortMemory: SORTMEMORY, writer: make(chan struct{}, 1), busyTimeout: BUSYTIMEOUT}
 
 	f, err := os.Open(filepath.Join(dir, "main.db"))
 	if os.IsNotExist(err) {
@@ -58,80 +71,147 @@ func OpenExistingDatabase(dir string) (*Backend, error) {
 		return nil, err
 	}
 
-	if string(headerBuf[0:16]) != "Fusedb format 1\x00" {
+	if string(headerBuf[0:16]) != FORMAT {
+		if strings.HasPrefix(string(headerBuf[0:16]), "Fusedb format ") {
+			return nil, fmt.Errorf("database file has unsupported version %q, expected %q",
+				strings.TrimRight(string(headerBuf[0:16]), "\x00"), strings.TrimRight(FORMAT, "\x00"))
+		}
 		return nil, errors.New("database file tampered with unrecognized version")
 	}
-	f.Seek(100, 0)
-	tablePage := make([]byte, PAGESIZE)
-	_, err = f.Read(tablePage)
-	if err == io.EOF {
-		return &b, nil //means no tables made
+
+	//pages committed before a crash are copied into the table files before anything reads them
+	if err := recoverWAL(dir); err != nil {
+		return nil, err
 	}
+	b.wal, err = openWAL(dir)
 	if err != nil {
 		return nil, err
 	}
-
-	b.tables = make([]Table, 0)
-	byteIndex := 0
-	for byteIndex < len(tablePage) {
-		tableSize := binary.LittleEndian.Uint32(tablePage[byteIndex : byteIndex+4])
-		if tableSize == 0 {
-			break
-		}
-		byteIndex += 4
-		tmpTable := fromBytes(tablePage[byteIndex : byteIndex+int(tableSize)])
-		tmpTable.GenerateFields()
-		byteIndex += int(tableSize)
-		b.tables = append(b.tables, tmpTable)
+	b.tables, b.catalog, err = readCatalog(f, PageID(binary.LittleEndian.Uint64(headerBuf[catalogRootOffset:catalogRootOffset+8])))
+	if err != nil {
+		return nil, err
 	}
 
 	for i, tab := range b.tables {
-		n, m, err := b.GetTableParams(tab)
+		n, m, freePages, err := b.GetTableParams(tab)
 		if err != nil {
 			return nil, err
 		}
 		b.tables[i].lastPage = n
 		b.tables[i].lastRowId = m
+		b.tables[i].freePages = freePages
 		b.bufferPool.NewPool(tab.Name, b.dir)
+		for j := range tab.indexes {
+			idx := &b.tables[i].indexes[j]
+			idx.lastPage, idx.freePages, err = b.walkTree(newIndexBtree(nil, &b.tables[i], idx), nil, nil)
+			if err != nil {
+				return nil, err
+			}
+			b.bufferPool.NewPool(idx.file(), b.dir)
+		}
 	}
 
 	return &b, nil
 }
 
-func (b *Backend) GetTableParams(table Table) (uint64, int64, error) {
-	tabledir := filepath.Join(b.dir, fmt.Sprintf("%s.db", table.Name))
-	f, err := os.Open(tabledir)
+// SetBusyTimeout sets how long a write waits for the transaction writing before failing with ErrBusy
+func (b *Backend) SetBusyTimeout(timeout time.Duration) {
+	b.busyTimeout = timeout
+}
+
+// SetSortMemory sets how many bytes of rows ORDER BY sorts in memory, larger results are merged from files
+func (b *Backend) SetSortMemory(bytes int) {
+	b.sortMemory = bytes
+}
+
+// walks the table B+tree returning the last page, the largest rowid stored and every page not in the tree
+func (b *Backend) GetTableParams(table Table) (uint64, int64, []PageID, error) {
+	lastRowId := table.lastRowId
+	bt := newBtree(nil, &table)
+	overflows := func(row []byte) []PageID {
+		pages, _ := table.overflowRefs(row)
+		return pages
+	}
+	lastPage, freePages, err := b.walkTree(bt, overflows, func(n node) {
+		//the last leaf holds the largest key
+		if n.count() > 0 && bt.key.columnType == INT {
+			cell := bt.rowKey(n, n.count()-1)
+			if cell.AsInt() > lastRowId {
+				lastRowId = cell.AsInt()
+			}
+		}
+	})
+	return lastPage, lastRowId, freePages, err
+}
+
+// walks a B+tree straight from its file returning the last page and every page not in the tree
+// overflows gives the first overflow page of the values of a row, it and lastLeaf may be nil
+func (b *Backend) walkTree(bt *btree, overflows func(row []byte) []PageID, lastLeaf func(n node)) (uint64, []PageID, error) {
+	f, err := os.Open(filepath.Join(b.dir, fmt.Sprintf("%s.db", bt.file)))
 	if err != nil {
-		return 0, 0, err
+		return 0, nil, err
 	}
 	defer f.Close()
 	fi, err := f.Stat()
 	if err != nil {
-		return 0, 0, err
+		return 0, nil, err
+	}
+	lastPage := PageID(fi.Size()/PAGESIZE - 1)
+
+	inTree := make([]bool, lastPage+1)
+	corrupted := false
+	stack := []PageID{0}
+	for len(stack) > 0 {
+		n := node{id: stack[len(stack)-1], buf: &[PAGESIZE]byte{}}
+		stack = stack[:len(stack)-1]
+		if n.id > lastPage || inTree[n.id] {
+			continue
+		}
+		inTree[n.id] = true
+		_, err = f.ReadAt(n.buf[:], int64(n.id)*PAGESIZE)
+		if err != nil {
+			return 0, nil, err
+		}
+		if !validChecksum(n.buf) {
+			corrupted = true //corrupted pages are left alone and reported when read
+			continue
+		}
+		if n.buf[nodeTypeOffset] == nodeOverflow {
+			stack = append(stack, n.next()) //0 ends the chain and the root is always visited already
+			continue
+		}
+		if !n.isLeaf() {
+			for i := 0; i <= n.count(); i++ {
+				stack = append(stack, bt.child(n, i))
+			}
+			continue
+		}
+		for i := 0; overflows != nil && i < n.count(); i++ {
+			stack = append(stack, overflows(bt.row(n, i))...)
+		}
+		if n.next() == 0 && lastLeaf != nil {
+			lastLeaf(n)
+		}
 	}
-	lastPage := fi.Size()/PAGESIZE - 1
-	f.Seek(lastPage*PAGESIZE, 0)
-	buf := [PAGESIZE]byte{}
-	_, err = f.Read(buf[:])
-	if err != nil {
-		return 0, 0, err
-	}
-	rowNums := binary.LittleEndian.Uint16(buf[8:10])
-	offset := 26 + rowNums*uint16(table.GenerateRowBytes())
-	columnBits := InitializeBitSet(uint64(len(table.Columns)))
-	offset += uint16(columnBits.Size())
-	for _, col := range table.Columns {
-		if col.columnConstraint == COL_ROWID {
-			break
-		} else {
-			offset += uint16(col.columnSize)
+
+	//pages of a corrupted subtree cannot be told apart from free ones so none are reused
+	freePages := make([]PageID, 0)
+	for id := lastPage; id > 0 && !corrupted; id-- {
+		if !inTree[id] {
+			freePages = append(freePages, id)
 		}
 	}
-	rowid := binary.LittleEndian.Uint64(buf[offset : offset+8])
-	return uint64(lastPage), int64(rowid), nil
+	return uint64(lastPage), freePages, nil
 }
 
 func (b *Backend) CreateTable(q Query) error { //rewrite
+	if err := b.lockWriter(context.Background()); err != nil {
+		return err
+	}
+	defer b.unlockWriter()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
 	_, exists := b.checkTableExist(q)
 	if exists {
 		return errors.New("Table already exist")
@@ -143,80 +223,20 @@ func (b *Backend) CreateTable(q Query) error { //rewrite
 	for i, construct := range q.TableConstruction {
 		newColumn := Column{}
 		newColumn.columnName = construct[0]
+		if len(newColumn.columnName) > 255 {
+			return errors.New("CREATE: column name longer than 255 bytes")
+		}
+		constraints := construct[2:]
 		switch construct[1] { //Uses reserved types list in parser.go
 		case "INT":
 			newColumn.columnType = INT
 			newColumn.columnSize = 8 //(bytes)
-			if len(construct) <= 2 {
-				break
-			}
-			isPrimary := false
-			for _, val := range construct[2:] {
-				if !isConstraint(val) {
-					return fmt.Errorf("CREATE: unsupported token in create field for column: %s", newColumn.columnName)
-				}
-				if val == "PRIMARY KEY" {
-					newColumn.columnConstraint = COL_PRIMARY
-					isPrimary = true
-				}
-			}
-			if isPrimary {
-				break
-			}
-			if len(construct) == 4 {
-				newColumn.columnConstraint = COL_NOTNULLUNIQUE
-			} else if construct[3] == "UNIQUE" {
-				newColumn.columnConstraint = COL_UNIQUE
-			} else if construct[3] == "NOT NULL" {
-				newColumn.columnConstraint = COL_NOTNULL
-			}
 		case "FLOAT":
 			newColumn.columnType = FLOAT
 			newColumn.columnSize = 8 //(bytes)
-			if len(construct) <= 2 {
-				break
-			}
-			isPrimary := false
-			for _, val := range construct[2:] {
-				if !isConstraint(val) {
-					return fmt.Errorf("CREATE: unsupported token in create field for column: %s", newColumn.columnName)
-				}
-				if val == "PRIMARY KEY" {
-					newColumn.columnConstraint = COL_PRIMARY
-					isPrimary = true
-				}
-			}
-			if isPrimary {
-				break
-			}
-			if len(construct) == 4 {
-				newColumn.columnConstraint = COL_NOTNULLUNIQUE
-			} else if construct[3] == "UNIQUE" {
-				newColumn.columnConstraint = COL_UNIQUE
-			} else if construct[3] == "NOT NULL" {
-				newColumn.columnConstraint = COL_NOTNULL
-			}
 		case "BOOL":
 			newColumn.columnType = BOOL
 			newColumn.columnSize = 1 //(bytes)
-			if len(construct) <= 2 {
-				break
-			}
-			for _, val := range construct[2:] {
-				if !isConstraint(val) {
-					return fmt.Errorf("CREATE: unsupported token in create field for column: %s", newColumn.columnName)
-				}
-				if val == "PRIMARY KEY" {
-					return errors.New("CREATE: cannot make primary field on BOOL column")
-				}
-				if val == "UNIQUE" {
-					return errors.New("CREATE: cannot make unique field on BOOL column")
-				}
-			}
-			if construct[2] == "NOT NULL" {
-				newColumn.columnConstraint = COL_NOTNULL
-			}
-
 		case "CHAR":
 			newColumn.columnType = CHAR
 			if len(construct) < 3 {
@@ -229,33 +249,101 @@ func (b *Backend) CreateTable(q Query) error { //rewrite
 			if !(fieldSize >= 1 && fieldSize <= 255) {
 				return errors.New("size for char field must be between 1 and 255")
 			}
-			newColumn.columnSize = byte(fieldSize)
-			if len(construct) <= 3 {
-				break
+			newColumn.columnSize = uint16(fieldSize)
+			constraints = construct[3:]
+		case "VARCHAR":
+			newColumn.columnType = VARCHAR
+			if len(construct) < 3 {
+				return errors.New("size needed for varchar field in table")
 			}
-			isPrimary := false
-			for _, val := range construct[3:] {
-				if !isConstraint(val) {
-					return fmt.Errorf("CREATE: unsupported token in create field for column: %s", newColumn.columnName)
-				}
-				if val == "PRIMARY KEY" {
-					newColumn.columnConstraint = COL_PRIMARY
-					isPrimary = true
-				}
+			fieldSize, err := strconv.Atoi(construct[2])
+			if err != nil {
+				return errors.Join(err, errors.New("error in table construction of size of VARCHAR field"))
 			}
-			if isPrimary {
-				break
+			if !(fieldSize >= 1 && fieldSize <= math.MaxUint16) {
+				return fmt.Errorf("size for varchar field must be between 1 and %d", math.MaxUint16)
+			}
+			newColumn.columnSize = uint16(fieldSize)
+			constraints = construct[3:]
+		case "TEXT":
+			newColumn.columnType = TEXT
+			newColumn.columnSize = 0 //no limit on the length
+		case "BLOB":
+			newColumn.columnType = BLOB
+			newColumn.columnSize = 0 //no limit on the length
+		case "DATE":
+			newColumn.columnType = DATE
+			newColumn.columnSize = 8 //(bytes)
+		case "TIMESTAMP":
+			newColumn.columnType = TIMESTAMP
+			newColumn.columnSize = 8 //(bytes)
+		case "INTERVAL":
+			newColumn.columnType = INTERVAL
+			newColumn.columnSize = 8 //(bytes)
+		case "TINYINT":
+			newColumn.columnType = TINYINT
+			newColumn.columnSize = 1 //(bytes)
+		case "SMALLINT":
+			newColumn.columnType = SMALLINT
+			newColumn.columnSize = 2 //(bytes)
+		case "INTEGER":
+			newColumn.columnType = INTEGER
+			newColumn.columnSize = 4 //(bytes)
+		case "TINYINT UNSIGNED":
+			newColumn.columnType = UTINYINT
+			newColumn.columnSize = 1 //(bytes)
+		case "SMALLINT UNSIGNED":
+			newColumn.columnType = USMALLINT
+			newColumn.columnSize = 2 //(bytes)
+		case "INTEGER UNSIGNED":
+			newColumn.columnType = UINTEGER
+			newColumn.columnSize = 4 //(bytes)
+		case "BIGINT UNSIGNED":
+			newColumn.columnType = UBIGINT
+			newColumn.columnSize = 8 //(bytes)
+		case "DECIMAL":
+			newColumn.columnType = DECIMAL
+			newColumn.columnSize = decimalSize
+			if len(construct) < 4 {
+				return errors.New("precision needed for decimal field in table")
 			}
-			if len(construct) == 4 {
-				newColumn.columnConstraint = COL_NOTNULLUNIQUE
-			} else if construct[3] == "UNIQUE" {
-				newColumn.columnConstraint = COL_UNIQUE
-			} else if construct[3] == "NOT NULL" {
-				newColumn.columnConstraint = COL_NOTNULL
+			precision, err := strconv.Atoi(construct[2])
+			if err != nil {
+				return errors.Join(err, errors.New("error in table construction of precision of DECIMAL field"))
+			}
+			scale, err := strconv.Atoi(construct[3])
+			if err != nil {
+				return errors.Join(err, errors.New("error in table construction of scale of DECIMAL field"))
+			}
+			if !(precision >= 1 && precision <= maxDecimalPrecision) {
+				return fmt.Errorf("precision for decimal field must be between 1 and %d", maxDecimalPrecision)
 			}
+			if !(scale >= 0 && scale <= precision) {
+				return errors.New("scale for decimal field must be between 0 and its precision")
+			}
+			newColumn.precision, newColumn.scale = uint8(precision), uint8(scale)
+			constraints = construct[4:]
 		default:
 			return errors.ErrUnsupported
 		}
+
+		constraint, err := parseConstraint(newColumn.columnName, constraints)
+		if err != nil {
+			return err
+		}
+		if newColumn.columnType == BOOL && constraint == COL_PRIMARY {
+			return errors.New("CREATE: cannot make primary field on BOOL column")
+		}
+		if newColumn.columnType == BOOL && (constraint == COL_UNIQUE || constraint == COL_NOTNULLUNIQUE) {
+			return errors.New("CREATE: cannot make unique field on BOOL column")
+		}
+		if (newColumn.columnType == TEXT || newColumn.columnType == BLOB) && constraint == COL_PRIMARY {
+			return fmt.Errorf("CREATE: cannot make primary field on %s column", construct[1])
+		}
+		if (newColumn.columnType == TEXT || newColumn.columnType == BLOB) && (constraint == COL_UNIQUE || constraint == COL_NOTNULLUNIQUE) {
+			return fmt.Errorf("CREATE: cannot make unique field on %s column", construct[1])
+		}
+		newColumn.columnConstraint = constraint
 		newtable.Columns[i] = newColumn
 	}
 
@@ -271,46 +359,74 @@ func (b *Backend) CreateTable(q Query) error { //rewrite
 	if primary != 1 {
 		return errors.New("CREATE: must have exactly one primary field")
 	}
-
-	f, err := os.Create(filepath.Join(b.dir, fmt.Sprintf("%s.db", newtable.Name)))
-	if err != nil {
-		return err
+	newtable.GenerateFields()
+	bt := newBtree(nil, &newtable)
+	if newtable.rowWidth() > bt.maxRowSize() {
+		return errors.New("CREATE: row too large, a page must fit at least two rows")
+	}
+	if bt.internalCapacity() < 2 {
+		return errors.New("CREATE: primary key too large, a page must fit at least two keys")
+	}
+	//UNIQUE columns other than the primary key are enforced by a unique index created with the table
+	for _, col := range newtable.Columns {
+		if !col.isUnique() || col.uniqueKind() == PrimaryKeyConstraint {
+			continue
+		}
+		idx := Index{Name: uniqueIndexName(newtable.Name, col.columnName), Table: newtable.Name, Columns: []string{col.columnName}, Unique: true}
+		if _, _, exists := b.findIndex(idx.Name); exists {
+			return fmt.Errorf("CREATE: index %s for unique column %s already exist", idx.Name, col.columnName)
+		}
+		if bt := newIndexBtree(nil, &newtable, &idx); bt.keysize > bt.maxRowSize() || bt.internalCapacity() < 2 {
+			return fmt.Errorf("CREATE: unique column %s too large for a page", col.columnName)
+		}
+		newtable.indexes = append(newtable.indexes, idx)
 	}
 
-	buf := [PAGESIZE]byte{}
-	binary.LittleEndian.PutUint64(buf[0:8], 0)  //pagenum
-	binary.LittleEndian.PutUint16(buf[8:10], 0) //rownums
-	checksum := md5.Sum(buf[26:])
-	copy(buf[10:26], checksum[:])
-	_, err = f.Write(buf[:])
-	if err != nil {
+	if err := b.createTreeFile(newtable.Name); err != nil {
 		return err
 	}
+	for i, idx := range newtable.indexes {
+		if err := b.createTreeFile(idx.file()); err != nil {
+			b.removeCreatedFiles(newtable, i)
+			return err
+		}
+		b.bufferPool.NewPool(idx.file(), b.dir)
+	}
 
 	newtable.lastPage = 0
 	newtable.lastRowId = 0
 	newtable.GenerateFields()
-	b.tables = append(b.tables, newtable)
-	b.writeTablesToDisk()
+	if err := b.saveCatalog(append(b.tables[:len(b.tables):len(b.tables)], newtable)); err != nil {
+		b.removeCreatedFiles(newtable, len(newtable.indexes))
+		return err
+	}
 	b.bufferPool.NewPool(newtable.Name, b.dir)
 	return nil
 }
 
-func (b *Backend) Insert(q Query) error {
-	tableToInsert, ok := b.checkTableExist(q)
-	if !ok {
-		return errors.New("Table does not exist")
+// removes the file of a table that could not be created and the files of its first n indexes
+func (b *Backend) removeCreatedFiles(t Table, n int) {
+	for _, idx := range t.indexes[:n] {
+		b.bufferPool.RemovePool(idx.file())
+		os.Remove(filepath.Join(b.dir, fmt.Sprintf("%s.db", idx.file())))
+	}
+	os.Remove(filepath.Join(b.dir, fmt.Sprintf("%s.db", t.Name)))
+}
+
+func (tx *Transaction) Insert(q Query) (Result, error) {
+	tableToInsert, err := tx.writableTable(q.TableName)
+	if err != nil {
+		return Result{}, err
 	}
 
 	allrows := make([][]byte, 0)
-	pageid := PageID(tableToInsert.lastPage)
 	lastrownum := tableToInsert.lastRowId
+	result := Result{rowsAffected: int64(len(q.Inserts))}
 	insertColumns := make([]InsertColumn, len(tableToInsert.Columns))
 	queryCols := make([]string, len(q.Fields))
 	copy(queryCols, q.Fields)
 
 	for i, col := range tableToInsert.Columns {
-		insertColumns[i].columnSize = col.columnSize
 		insertColumns[i].dataType = col.columnType
 		isNull := true
 		for j := range queryCols {
@@ -327,9 +443,10 @@ func (b *Backend) Insert(q Query) error {
 				break
 			}
 		}
-		if isNull && col.columnConstraint == COL_PRIMARY { //supposes primary key is rowid
+		isRowId := col.columnConstraint == COL_PRIMARY && col.columnType == INT //INT primary key is the rowid
+		if isNull && isRowId {
 			insertColumns[i].colType = COL_I_PRIMARYNULL
-		} else if !isNull && col.columnConstraint == COL_PRIMARY {
+		} else if !isNull && isRowId {
 			insertColumns[i].colType = COL_I_PRIMARYVALUED
 		} else if isNull {
 			insertColumns[i].colType = COL_I_NULL
@@ -338,81 +455,256 @@ func (b *Backend) Insert(q Query) error {
 		}
 	}
 	if len(queryCols) > 0 {
-		return fmt.Errorf("Columns may not exist: %s", strings.Join(queryCols, " - "))
+		return Result{}, fmt.Errorf("Columns may not exist: %s", strings.Join(queryCols, " - "))
 	}
 
 	for _, val := range q.Inserts {
-		nullColumns := InitializeBitSet(uint64(len(tableToInsert.Columns) + 1))
-		nullColumns.setBit(len(tableToInsert.Columns) + 1)
-		rowInsert := make([]byte, tableToInsert.GenerateRowBytes()+nullColumns.Size())
-		byteIndex := nullColumns.Size()
+		nullColumns := tableToInsert.newRowBitSet()
+		nullColumns.setBit(tableToInsert.existsBit())
+		cells := make([]Cell, len(insertColumns))
 
 		for j := range insertColumns {
 			var b []byte = make([]byte, 0)
 
-			if insertColumns[j].colType == COL_I_PRIMARYVALUED {
-				n, err := strconv.Atoi(val[insertColumns[j].insertIndex])
+			colType := insertColumns[j].colType
+			if colType != COL_I_PRIMARYNULL && colType != COL_I_NULL && val[insertColumns[j].insertIndex].Kind == NullValue {
+				//a NULL rowid is given the next rowid like a missing one
+				if colType == COL_I_PRIMARYVALUED {
+					colType = COL_I_PRIMARYNULL
+				} else {
+					colType = COL_I_NULL
+				}
+			}
+
+			if colType == COL_I_PRIMARYVALUED {
+				value := val[insertColumns[j].insertIndex]
+				if !valueFits(value.Kind, INT) {
+					return Result{}, fmt.Errorf("type mismatch: cannot use %s %s as INT for column %s", value.Kind, value.Text, tableToInsert.Columns[j].columnName)
+				}
+				n, err := strconv.Atoi(value.Text)
 				if err != nil {
-					return errors.Join(errors.New("Insert Query failed: "), err)
+					return Result{}, errors.Join(errors.New("Insert Query failed: "), err)
+				}
+				if int64(n) > lastrownum {
+					lastrownum = int64(n)
 				}
-				lastrownum = int64(n)
+				result.lastInsertId = int64(n)
 				b = binary.LittleEndian.AppendUint64(b, uint64(n))
-			} else if insertColumns[j].colType == COL_I_PRIMARYNULL {
-				n := lastrownum + 1
+			} else if colType == COL_I_PRIMARYNULL {
+				lastrownum++
+				n := lastrownum
+				result.lastInsertId = n
 				b = binary.LittleEndian.AppendUint64(b, uint64(n))
-			} else if insertColumns[j].colType == COL_I_VALUED {
-				switch insertColumns[j].dataType {
-				case INT:
-					n, err := strconv.Atoi(val[insertColumns[j].insertIndex])
-					if err != nil {
-						return errors.Join(errors.New("Insert Query failed: "), err)
-					}
-					b = binary.LittleEndian.AppendUint64(b, uint64(n))
-				case FLOAT:
-					n, err := strconv.ParseFloat(val[insertColumns[j].insertIndex], 64)
-					if err != nil {
-						return errors.Join(errors.New("Insert Query failed: "), err)
-					}
-					b = binary.LittleEndian.AppendUint64(b, math.Float64bits(n))
-				case BOOL:
-					n, err := strconv.ParseBool(val[insertColumns[j].insertIndex])
-					if err != nil {
-						return errors.Join(errors.New("Insert Query failed: "), err)
-					}
-					if n {
-						b = append(b, byte(1))
-					} else {
-						b = append(b, byte(0))
-					}
-				case CHAR:
-					n := []byte(val[insertColumns[j].insertIndex])
-					if len(n) > int(insertColumns[j].columnSize) {
-						return errors.Join(errors.New("Insert Query failed: "), errors.New("string to insert larger than allowed"))
-					}
-					b = append(b, n...)
+			} else if colType == COL_I_VALUED {
+				cell, err := encodeValue(tableToInsert.Columns[j], val[insertColumns[j].insertIndex])
+				if err != nil {
+					return Result{}, errors.Join(errors.New("Insert Query failed: "), err)
 				}
-			} else if insertColumns[j].colType == COL_I_NULL {
+				b = append(b, cell...)
+			} else if colType == COL_I_NULL {
 				nullColumns.setBit(j)
 			}
 
-			copy(rowInsert[byteIndex:], b)
-			byteIndex += uint64(insertColumns[j].columnSize)
+			cells[j] = b
+		}
+		allrows = append(allrows, tableToInsert.buildRow(nullColumns, cells))
+	}
+
+	bt := newBtree(tx, tableToInsert)
+	for _, row := range allrows {
+		if _, ok := tableToInsert.overflowColumns(row, bt.maxRowSize()); !ok {
+			return Result{}, bt.rowTooLarge(row)
+		}
+	}
+	if err := tx.checkInsert(tableToInsert, allrows); err != nil {
+		return Result{}, err
+	}
+	if err := tx.checkUniqueIndexes(tableToInsert, allrows, nil); err != nil {
+		return Result{}, err
+	}
+	for _, row := range allrows {
+		stored, err := tx.storeRow(bt, tableToInsert, row)
+		if err != nil {
+			return Result{}, err
+		}
+		if err := bt.insert(stored); err != nil {
+			return Result{}, err
+		}
+		if err := tx.insertIndexEntries(tableToInsert, row); err != nil {
+			return Result{}, err
+		}
+	}
+	tableToInsert.lastRowId = lastrownum
+	return result, nil
+}
+
+// Update rewrites the cells of every row matching the query conditions and returns the number of rows changed
+func (tx *Transaction) Update(q Query) (int64, error) {
+	tableToUpdate, err := tx.writableTable(q.TableName)
+	if err != nil {
+		return 0, err
+	}
+
+	updateColumns := make([]Column, 0, len(q.Updates))
+	updateCells := make([]Cell, 0, len(q.Updates))
+	for field, val := range q.Updates {
+		col, ok := tableToUpdate.getColumn(field)
+		if !ok {
+			return 0, fmt.Errorf("Columns not in table: %s", field)
+		}
+		if val.Kind == NullValue {
+			if col.isNotNull() {
+				return 0, &ConstraintError{Kind: NotNullConstraint, Table: tableToUpdate.Name, Column: col.columnName}
+			}
+			updateColumns = append(updateColumns, col)
+			updateCells = append(updateCells, nil) //nil cells set the column to null
+			continue
+		}
+		cell, err := encodeValue(col, val)
+		if err != nil {
+			return 0, errors.Join(errors.New("Update Query failed: "), err)
+		}
+		if !col.isVariable() {
+			padded := make(Cell, col.columnSize) //zero padded to the full width of the column
+			copy(padded, cell)
+			cell = padded
+		}
+		updateColumns = append(updateColumns, col)
+		updateCells = append(updateCells, cell)
+	}
+
+	filter, err := tableToUpdate.newRowFilter(q.Where)
+	if err != nil {
+		return 0, err
+	}
+
+	//rows are copied out before any is changed so constraints are checked against the whole statement
+	bt := newBtree(tx, tableToUpdate)
+	matched, err := tx.matchingRows(tableToUpdate, filter)
+	if err != nil {
+		return 0, err
+	}
+	primaries := make([]string, len(matched))
+	replaced := make(map[string]bool, len(matched))
+	for i, row := range matched {
+		primaries[i] = string(tableToUpdate.cellAt(row, bt.key))
+		replaced[primaries[i]] = true
+	}
+	for i, col := range updateColumns {
+		if err := tx.checkUpdate(tableToUpdate, col, updateCells[i], primaries); err != nil {
+			return 0, err
 		}
-		copy(rowInsert[0:], nullColumns.bytes)
-		allrows = append(allrows, rowInsert)
 	}
 
-	n, err := b.bufferPool.InsertData(tableToInsert.Name, pageid, allrows)
+	updated := make([][]byte, len(matched))
+	for i, row := range matched {
+		updated[i] = tableToUpdate.withCells(row, updateColumns, updateCells)
+		if _, ok := tableToUpdate.overflowColumns(updated[i], bt.maxRowSize()); !ok {
+			return 0, bt.rowTooLarge(updated[i])
+		}
+	}
+	if err := tx.checkUniqueIndexes(tableToUpdate, updated, replaced); err != nil {
+		return 0, err
+	}
+
+	var affected int64
+	//old entries all go first so a row may take the values another row of the statement gives up
+	for _, row := range matched {
+		if err := tx.deleteIndexEntries(tableToUpdate, row); err != nil {
+			return affected, err
+		}
+	}
+	for i, row := range updated {
+		if err := tx.freeOverflow(bt, tableToUpdate, Cell(primaries[i])); err != nil {
+			return affected, err
+		}
+		stored, err := tx.storeRow(bt, tableToUpdate, row)
+		if err != nil {
+			return affected, err
+		}
+		if string(tableToUpdate.cellAt(row, bt.key)) == primaries[i] {
+			err = bt.replace(stored)
+		} else if _, err = bt.delete(Cell(primaries[i])); err == nil {
+			err = bt.insert(stored) //a new primary key moves the row
+		}
+		if err != nil {
+			return affected, err
+		}
+		if err := tx.insertIndexEntries(tableToUpdate, row); err != nil {
+			return affected, err
+		}
+		affected++
+	}
+	return affected, nil
+}
+
+func (tx *Transaction) Delete(q Query) (int64, error) {
+	tableToDelete, err := tx.writableTable(q.TableName)
 	if err != nil {
+		return 0, err
+	}
+
+	filter, err := tableToDelete.newRowFilter(q.Where)
+	if err != nil {
+		return 0, err
+	}
+
+	bt := newBtree(tx, tableToDelete)
+	matched, err := tx.matchingRows(tableToDelete, filter)
+	if err != nil {
+		return 0, err
+	}
+	var affected int64
+	for _, row := range matched {
+		if err := tx.deleteIndexEntries(tableToDelete, row); err != nil {
+			return affected, err
+		}
+		if err := tx.freeOverflow(bt, tableToDelete, tableToDelete.cellAt(row, bt.key)); err != nil {
+			return affected, err
+		}
+		if _, err := bt.delete(tableToDelete.cellAt(row, bt.key)); err != nil {
+			return affected, err
+		}
+		affected++
+	}
+	return affected, nil
+}
+
+// DropTable removes the table from the catalog and deletes its file
+func (b *Backend) DropTable(q Query) error {
+	if err := b.lockWriter(context.Background()); err != nil {
 		return err
 	}
+	defer b.unlockWriter()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	tableIndex := -1
 	for i := range b.tables {
 		if q.TableName == b.tables[i].Name {
-			b.tables[i].lastPage = uint64(n)
-			b.tables[i].lastRowId = int64(lastrownum)
+			tableIndex = i
+			break
 		}
 	}
-	return nil
+	if tableIndex == -1 {
+		if q.IfExists {
+			return nil
+		}
+		return errors.New("Table does not exist")
+	}
+
+	indexes := b.tables[tableIndex].indexes
+	tables := append(append(make([]Table, 0, len(b.tables)-1), b.tables[:tableIndex]...), b.tables[tableIndex+1:]...)
+	if err := b.saveCatalog(tables); err != nil {
+		return err
+	}
+	b.detachReaders(map[string]bool{q.TableName: true})
+	for _, idx := range indexes {
+		if err := b.removeTreeFile(idx.file()); err != nil {
+			return err
+		}
+	}
+	return b.removeTreeFile(q.TableName)
 }
 
 func (b *Backend) checkTableExist(q Query) (Table, bool) {
@@ -424,110 +716,148 @@ func (b *Backend) checkTableExist(q Query) (Table, bool) {
 	return Table{}, false
 }
 
-func (b *Backend) writeTablesToDisk() {
-	buf := make([]byte, PAGESIZE)
-	byteIndex := 0
-	for _, table := range b.tables {
-		tmpBuf := table.toBytes()
-		binary.LittleEndian.PutUint32(buf[byteIndex:byteIndex+4], uint32(len(tmpBuf)))
-		byteIndex += 4
-		copy(buf[byteIndex:], tmpBuf)
-		byteIndex += len(tmpBuf)
-	}
-
+// writes the catalog of tables, they only replace the tables of the backend once the catalog is on disk
+func (b *Backend) saveCatalog(tables []Table) error {
 	f, err := os.OpenFile(b.mainFile.Name(), os.O_WRONLY, 0700)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	_, err = f.WriteAt(buf, 100)
+	defer f.Close()
+	chain, err := writeCatalog(f, tables, b.catalog)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	b.catalog = chain
+	b.tables = tables
+	return nil
 }
 
-func (b *Backend) Select(q Query) (driver.Rows, error) {
-	tmpTable, ok := b.checkTableExist(q)
+// Select streams the rows of the query, rows of a transaction still open when it writes one of their tables
+// read the rest of their rows first as the pages they read are changed in place
+func (tx *Transaction) Select(q Query) (driver.Rows, error) {
+	rows, err := tx.selectRows(q)
+	if err != nil {
+		return nil, err
+	}
+	rows.tables = []string{q.TableName}
+	for _, join := range q.Joins {
+		rows.tables = append(rows.tables, join.TableName)
+	}
+	if !tx.readonly {
+		rows.tx = tx
+		tx.readers[rows] = true
+	}
+	return rows, nil
+}
+
+func (tx *Transaction) selectRows(q Query) (*Rows, error) {
+	tmpTable, ok := tx.table(q.TableName)
 	if !ok {
 		return nil, errors.New("Table does not exist")
 	}
+	scan := func(filter *rowFilter) rowIterator {
+		return tx.newTableScan(&tmpTable, filter)
+	}
+	if len(q.Joins) > 0 || q.TableAlias != "" || q.qualifiesColumns() {
+		scope, err := newJoinScope(q, tx.table)
+		if err != nil {
+			return nil, err
+		}
+		if q, err = resolveJoin(q, scope); err != nil {
+			return nil, err
+		}
+		if len(q.Joins) > 0 {
+			plan, err := tx.newJoinPlan(q, scope)
+			if err != nil {
+				return nil, err
+			}
+			tmpTable, scan = plan.combined, plan.rows
+		}
+	}
+	if q.isAggregate() {
+		return tx.selectGroups(q, tmpTable, scan)
+	}
 
 	columnsRequest := []Column{}
-	tmpcol := q.Fields
-	if tmpcol[0] == "*" {
-		columnsRequest = append(columnsRequest, tmpTable.Columns...)
-	} else {
-		for _, col := range tmpTable.Columns {
-			for i, str := range tmpcol {
-				if col.columnName == str {
-					columnsRequest = append(columnsRequest, col)
-					tmpcol = removeColField(tmpcol, i)
-					continue
-				}
-			}
+	missing := []string{}
+	for _, field := range q.Fields {
+		if field == "*" {
+			columnsRequest = append(columnsRequest, tmpTable.Columns...)
+			continue
 		}
-		if len(tmpcol) != 0 {
-			return nil, fmt.Errorf("Columns not in table: %s", strings.Join(tmpcol, " "))
+		col, ok := tmpTable.getColumn(field)
+		if !ok {
+			missing = append(missing, field)
+			continue
 		}
+		columnsRequest = append(columnsRequest, col)
+	}
+	if len(missing) != 0 {
+		return nil, fmt.Errorf("Columns not in table: %s", strings.Join(missing, " "))
 	}
 
-	rows := &Rows{index: 0, columns: []ResultColumn{}}
+	filter, err := tmpTable.newRowFilter(q.Where)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := &Rows{columns: []ResultColumn{}}
 	for _, col := range columnsRequest {
-		rows.columns = append(rows.columns, ResultColumn{Name: col.columnName, ColumnType: col.columnType})
-	}
-	rows.rows = make([][]Cell, 0)
-	rowsize := tmpTable.GenerateRowBytes()
-	rowbitset := InitializeBitSet(uint64(len(tmpTable.Columns) + 1))
-	bitsetsize := int(rowbitset.Size())
-
-	startPage := PageID(0)
-	endPage := PageID(tmpTable.lastPage)
-	pages := b.bufferPool.SelectDataRange(tmpTable.Name, startPage, endPage)
-
-	for i, page := range pages {
-		rowNums := binary.LittleEndian.Uint16(page.buf[8:10])
-		checksum := page.buf[10:26]
-
-		checksumcheck := md5.Sum(page.buf[26:])
-		//fmt.Println(checksum, checksumcheck)
-		if !bytes.Equal(checksum, checksumcheck[:]) {
-			return nil, fmt.Errorf("page %d has been corrupted", i)
-		}
-		offset := 26
-		numrows := 0
-		for ; offset < PAGESIZE-(int(rowsize)+bitsetsize); offset += (int(rowsize) + bitsetsize) {
-			row := make([]Cell, len(columnsRequest))
-			tmprow := page.buf[offset : uint64(offset)+rowsize+uint64(bitsetsize)]
-			rowbitset.fromBytes(tmprow[:bitsetsize])
-			//fmt.Println(rowbitset.hasBit(len(tmpTable.Columns) + 1))
-			if !rowbitset.hasBit(len(tmpTable.Columns) + 1) {
+		rows.columns = append(rows.columns, ResultColumn{Name: resultName(q, col.columnName), ColumnType: col.columnType})
+	}
+
+	//fields only ordered by are read as hidden columns after the selected ones
+	keys := make([]sortKey, 0, len(q.OrderBy))
+	for _, field := range q.OrderBy {
+		k := orderColumn(q, columnsRequest, field.Field)
+		if k == -1 {
+			col, ok := tmpTable.getColumn(field.Field)
+			if !ok {
+				missing = append(missing, field.Field)
 				continue
 			}
+			k = len(columnsRequest)
+			columnsRequest = append(columnsRequest, col)
+		}
+		keys = append(keys, sortKey{column: k, colType: columnsRequest[k].columnType, desc: field.Desc, nullsFirst: field.NullsFirst})
+	}
+	if len(missing) != 0 {
+		return nil, fmt.Errorf("ORDER BY: columns not in table: %s", strings.Join(missing, " "))
+	}
 
-			for k, col := range columnsRequest {
-				if rowbitset.hasBit(col.columnIndex) {
-					row[k] = nil
-					continue
-				}
-				celloffset := bitsetsize + col.columnOffset
-				row[k] = make(Cell, col.columnSize)
-				copy(row[k], tmprow[celloffset:])
-			}
-			rows.rows = append(rows.rows, row)
+	//without ORDER BY the rows come in scan order so the scan stops once LIMIT rows were read
+	projected := &projectRows{input: &filterRows{input: scan(filter), filter: filter}, t: &tmpTable, columns: columnsRequest}
+	rows.source = tx.orderAndLimit(q, projected, keys, len(columnsRequest))
+	return rows, nil
+}
 
-			numrows++
-			if numrows >= int(rowNums) {
-				break
-			}
+// name of a result column, the alias given to its field if any
+func resultName(q Query, field string) string {
+	if alias, ok := q.Aliases[field]; ok {
+		return alias
+	}
+	return field
+}
+
+// field named by an alias of the select list, other names are returned unchanged
+func aliasedField(q Query, name string) string {
+	for field, alias := range q.Aliases {
+		if alias == name {
+			return field
 		}
-		b.bufferPool.UnpinPage(tmpTable.Name, page.slotid)
 	}
+	return name
+}
 
-	for i := range rows.rows {
-		fmt.Println(rows.rows[i])
+// index of the selected column an ORDER BY field names directly or through its alias, -1 when it is not selected
+func orderColumn(q Query, columns []Column, field string) int {
+	field = aliasedField(q, field)
+	for k, col := range columns {
+		if col.columnName == field {
+			return k
+		}
 	}
-	fmt.Println(len(rows.Columns()), rows.Columns())
-	fmt.Println(len(rows.columns), rows.columns)
-	return rows, nil
+	return -1
 }
 
 func removeColField(s []string, i int) []string {
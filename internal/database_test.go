@@ -1,6 +1,20 @@
 package internal
 
-import "testing"
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
 
 func TestRemoveColumns(t *testing.T) {
 	mystrings := []string{"some", "two", "last"}
@@ -19,3 +33,1145 @@ func TestRemoveColumns(t *testing.T) {
 		t.Error("mystrings did not shrink")
 	}
 }
+
+func mustParse(t *testing.T, sql string) Query {
+	q, err := Parse(sql)
+	require.NoError(t, err)
+	return q
+}
+
+func newTestDatabase(t *testing.T, statements ...string) *Backend {
+	b := CreateNewDatabase(t.TempDir())
+	for _, sql := range statements {
+		q := mustParse(t, sql)
+		switch q.Type {
+		case Create:
+			require.NoError(t, b.CreateTable(q))
+		case Insert:
+			_, err := b.Insert(q)
+			require.NoError(t, err)
+		case CreateIndex:
+			require.NoError(t, b.CreateIndex(q))
+		}
+	}
+	return b
+}
+
+func selectAll(t *testing.T, b *Backend, sql string) [][]driver.Value {
+	rows, err := b.Select(mustParse(t, sql))
+	require.NoError(t, err)
+	result := make([][]driver.Value, 0)
+	for {
+		dest := make([]driver.Value, len(rows.Columns()))
+		err := rows.Next(dest)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		result = append(result, dest)
+	}
+	return result
+}
+
+// cells of every row pulled from the operator tree of the rows
+func resultCells(t *testing.T, rows driver.Rows) [][]Cell {
+	result := make([][]Cell, 0)
+	for {
+		row, err := rows.(*Rows).source.next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		result = append(result, row)
+	}
+	require.NoError(t, rows.Close())
+	return result
+}
+
+func TestUpdate(t *testing.T) {
+	b := newTestDatabase(t,
+		"CREATE TABLE 'people' (id int Primary Key, name char(10), active bool, score float)",
+		"INSERT INTO 'people' (id,name,active,score) VALUES ('1','alice','true','1.5'),('2','bob','false','2.5'),('3','carol','true','3.5')",
+	)
+
+	n, err := b.Update(mustParse(t, "UPDATE 'people' SET name = 'bobby', score = '9' WHERE id = '2'"))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+
+	n, err = b.Update(mustParse(t, "UPDATE 'people' SET active = 'false' WHERE score < '4' AND active = 'true'"))
+	require.NoError(t, err)
+	require.Equal(t, int64(2), n)
+
+	require.Equal(t, [][]driver.Value{
+		{int64(1), "alice", false, 1.5},
+		{int64(2), "bobby", false, 9.0},
+		{int64(3), "carol", false, 3.5},
+	}, selectAll(t, b, "SELECT * FROM 'people'"))
+
+	n, err = b.Update(mustParse(t, "UPDATE 'people' SET name = 'x' WHERE id > '10'"))
+	require.NoError(t, err)
+	require.Equal(t, int64(0), n)
+
+	_, err = b.Update(mustParse(t, "UPDATE 'people' SET missing = 'x' WHERE id = '1'"))
+	require.Error(t, err)
+	_, err = b.Update(mustParse(t, "UPDATE 'people' SET score = 'abc' WHERE id = '1'"))
+	require.Error(t, err)
+}
+
+func TestDelete(t *testing.T) {
+	b := newTestDatabase(t,
+		"CREATE TABLE 'items' (id int Primary Key, name char(8))",
+		"INSERT INTO 'items' (id,name) VALUES ('1','a'),('2','b'),('3','c'),('4','d')",
+	)
+
+	n, err := b.Delete(mustParse(t, "DELETE FROM 'items' WHERE id = '2'"))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+	n, err = b.Delete(mustParse(t, "DELETE FROM 'items' WHERE name = 'z'"))
+	require.NoError(t, err)
+	require.Equal(t, int64(0), n)
+
+	require.Equal(t, [][]driver.Value{{int64(1), "a"}, {int64(3), "c"}, {int64(4), "d"}},
+		selectAll(t, b, "SELECT * FROM 'items'"))
+
+	//rows come back in primary key order
+	_, err = b.Insert(mustParse(t, "INSERT INTO 'items' (id,name) VALUES ('6','f'),('5','e')"))
+	require.NoError(t, err)
+	require.Equal(t, [][]driver.Value{{int64(1), "a"}, {int64(3), "c"}, {int64(4), "d"}, {int64(5), "e"}, {int64(6), "f"}},
+		selectAll(t, b, "SELECT * FROM 'items'"))
+
+	n, err = b.Delete(mustParse(t, "DELETE FROM 'items' WHERE id >= '4'"))
+	require.NoError(t, err)
+	require.Equal(t, int64(3), n)
+
+	reopened, err := OpenExistingDatabase(b.dir)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), reopened.tables[0].lastRowId)
+	_, err = reopened.Insert(mustParse(t, "INSERT INTO 'items' (name) VALUES ('g')"))
+	require.NoError(t, err)
+	require.Equal(t, [][]driver.Value{{int64(1), "a"}, {int64(3), "c"}, {int64(4), "g"}},
+		selectAll(t, reopened, "SELECT * FROM 'items'"))
+}
+
+func TestRowExistsBitWithSevenColumns(t *testing.T) {
+	b := newTestDatabase(t,
+		"CREATE TABLE 'wide' (a int Primary Key, b int, c int, d int, e int, f int, g int)",
+		"INSERT INTO 'wide' (a,b,c,d,e,f,g) VALUES ('1','2','3','4','5','6','7')",
+	)
+	require.Len(t, selectAll(t, b, "SELECT * FROM 'wide'"), 1)
+}
+
+func TestDropTable(t *testing.T) {
+	b := newTestDatabase(t,
+		"CREATE TABLE 'first' (id int Primary Key)",
+		"CREATE TABLE 'second' (id int Primary Key, name char(4))",
+		"INSERT INTO 'second' (id,name) VALUES ('1','a')",
+	)
+
+	require.NoError(t, b.DropTable(mustParse(t, "DROP TABLE 'first'")))
+	require.Error(t, b.DropTable(mustParse(t, "DROP TABLE 'first'")))
+	require.NoError(t, b.DropTable(mustParse(t, "DROP TABLE IF EXISTS 'first'")))
+	_, err := os.Stat(filepath.Join(b.dir, "first.db"))
+	require.True(t, os.IsNotExist(err))
+	_, ok := b.bufferPool.allpools["first"]
+	require.False(t, ok)
+
+	reopened, err := OpenExistingDatabase(b.dir)
+	require.NoError(t, err)
+	require.Len(t, reopened.tables, 1)
+	require.Equal(t, [][]driver.Value{{int64(1), "a"}}, selectAll(t, reopened, "SELECT * FROM 'second'"))
+
+	//name can be reused after the drop
+	require.NoError(t, reopened.CreateTable(mustParse(t, "CREATE TABLE 'first' (id int Primary Key)")))
+}
+
+func TestSelectWhere(t *testing.T) {
+	b := newTestDatabase(t,
+		"CREATE TABLE 'stats' (id int Primary Key, name char(10), active bool, score float, best float)",
+		"INSERT INTO 'stats' (id,name,active,score,best) VALUES ('1','alice','true','1.5','2'),('2','bob','false','2.5','2.5'),('3','carol','true','3.5','3')",
+		"INSERT INTO 'stats' (id,active) VALUES ('4','false')",
+	)
+	ids := func(sql string) []int64 {
+		result := []int64{}
+		for _, row := range selectAll(t, b, sql) {
+			result = append(result, row[0].(int64))
+		}
+		return result
+	}
+
+	require.Equal(t, []int64{2}, ids("SELECT id FROM 'stats' WHERE id = '2'"))
+	require.Equal(t, []int64{1, 3, 4}, ids("SELECT id FROM 'stats' WHERE id != '2'"))
+	require.Equal(t, []int64{3, 4}, ids("SELECT id FROM 'stats' WHERE id > '2'"))
+	require.Equal(t, []int64{1}, ids("SELECT id FROM 'stats' WHERE id < '2'"))
+	require.Equal(t, []int64{2, 3, 4}, ids("SELECT id FROM 'stats' WHERE id >= '2'"))
+	require.Equal(t, []int64{1, 2}, ids("SELECT id FROM 'stats' WHERE id <= '2'"))
+
+	require.Equal(t, []int64{2, 3}, ids("SELECT id FROM 'stats' WHERE score > '2'"))
+	require.Equal(t, []int64{1, 3}, ids("SELECT id FROM 'stats' WHERE active = 'true'"))
+	require.Equal(t, []int64{2}, ids("SELECT id FROM 'stats' WHERE name = 'bob'"))
+	require.Equal(t, []int64{1}, ids("SELECT id FROM 'stats' WHERE name < 'b'"))
+	require.Equal(t, []int64{2}, ids("SELECT id FROM 'stats' WHERE name > 'alice' AND active != 'true'"))
+
+	//field against field, INT against FLOAT widens to float
+	require.Equal(t, []int64{2}, ids("SELECT id FROM 'stats' WHERE score = best"))
+	require.Equal(t, []int64{1}, ids("SELECT id FROM 'stats' WHERE score < best"))
+	require.Equal(t, []int64{1, 2, 3}, ids("SELECT id FROM 'stats' WHERE id <= best"))
+
+	//null columns never satisfy a comparison
+	require.Equal(t, []int64{1, 2, 3}, ids("SELECT id FROM 'stats' WHERE name != 'dave'"))
+	require.Equal(t, []int64{}, ids("SELECT id FROM 'stats' WHERE score = best AND id = '4'"))
+
+	require.Equal(t, [][]driver.Value{{"carol", int64(3)}}, selectAll(t, b, "SELECT name, id FROM 'stats' WHERE id = '3'"))
+
+	_, err := b.Select(mustParse(t, "SELECT id FROM 'stats' WHERE missing = '1'"))
+	require.Error(t, err)
+	_, err = b.Select(mustParse(t, "SELECT id FROM 'stats' WHERE id = 'abc'"))
+	require.Error(t, err)
+	_, err = b.Select(mustParse(t, "SELECT id FROM 'stats' WHERE name = active"))
+	require.Error(t, err)
+}
+
+func TestSelectWhereExpression(t *testing.T) {
+	b := newTestDatabase(t,
+		"CREATE TABLE 'stats' (id int Primary Key, name char(10), score float)",
+		"INSERT INTO 'stats' (id,name,score) VALUES ('1','alice','1.5'),('2','bob','2.5'),('3','carol','3.5')",
+		"INSERT INTO 'stats' (id,score) VALUES ('4','4.5')",
+	)
+	ids := func(sql string) []int64 {
+		result := []int64{}
+		for _, row := range selectAll(t, b, sql) {
+			result = append(result, row[0].(int64))
+		}
+		return result
+	}
+
+	require.Equal(t, []int64{1, 3}, ids("SELECT id FROM 'stats' WHERE id = '1' OR name = 'carol'"))
+	require.Equal(t, []int64{1, 3, 4}, ids("SELECT id FROM 'stats' WHERE NOT id = '2'"))
+	require.Equal(t, []int64{1, 3}, ids("SELECT id FROM 'stats' WHERE id = '1' OR (score > '3' AND NOT id = '4')"))
+	require.Equal(t, []int64{2}, ids("SELECT id FROM 'stats' WHERE (id = '1' OR id = '2') AND NOT name = 'alice'"))
+
+	//null comparisons are unknown so NOT does not turn them into matches
+	require.Equal(t, []int64{1, 2, 3}, ids("SELECT id FROM 'stats' WHERE NOT name = 'dave'"))
+	require.Equal(t, []int64{}, ids("SELECT id FROM 'stats' WHERE NOT (name = 'dave' OR id = '1') AND id = '4'"))
+	require.Equal(t, []int64{4}, ids("SELECT id FROM 'stats' WHERE name = 'dave' OR id = '4'"))
+}
+
+func TestSelectManyPages(t *testing.T) {
+	b := newTestDatabase(t, "CREATE TABLE 'big' (id int Primary Key, filler char(255))")
+	values := make([]string, 0)
+	for i := 1; i <= 200; i++ {
+		values = append(values, fmt.Sprintf("('%d','row%d')", i, i))
+	}
+	_, err := b.Insert(mustParse(t, "INSERT INTO 'big' (id,filler) VALUES "+strings.Join(values, ",")))
+	require.NoError(t, err)
+
+	rows := selectAll(t, b, "SELECT id, filler FROM 'big'")
+	require.Len(t, rows, 200)
+	for i, row := range rows {
+		require.Equal(t, []driver.Value{int64(i + 1), fmt.Sprintf("row%d", i+1)}, row)
+	}
+	require.Equal(t, [][]driver.Value{{int64(150)}}, selectAll(t, b, "SELECT id FROM 'big' WHERE filler = 'row150'"))
+}
+
+func TestBind(t *testing.T) {
+	b := newTestDatabase(t, "CREATE TABLE 'people' (id int Primary Key, name char(10), active bool, score float)")
+
+	insert := mustParse(t, "INSERT INTO 'people' (id,name,active,score) VALUES (?,?,?,?)")
+	for i, name := range []string{"alice", "bob"} {
+		q, err := b.Bind(insert, []driver.Value{int64(i + 1), name, i == 0, int64(2)})
+		require.NoError(t, err)
+		_, err = b.Insert(q)
+		require.NoError(t, err)
+	}
+	require.Equal(t, make([]Value, 4), insert.Inserts[0], "parsed query must stay reusable")
+
+	selectByName := mustParse(t, "SELECT id, score FROM 'people' WHERE name = $1 OR id = $2")
+	q, err := b.Bind(selectByName, []driver.Value{[]byte("bob"), int64(1)})
+	require.NoError(t, err)
+	rows, err := b.Select(q)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(resultCells(t, rows)))
+
+	update := mustParse(t, "UPDATE 'people' SET score = ? WHERE id = ?")
+	q, err = b.Bind(update, []driver.Value{4.5, int64(2)})
+	require.NoError(t, err)
+	n, err := b.Update(q)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+	require.Equal(t, [][]driver.Value{{"alice", 2.0}, {"bob", 4.5}}, selectAll(t, b, "SELECT name, score FROM 'people'"))
+
+	_, err = b.Bind(insert, []driver.Value{int64(3), "carol", true})
+	require.EqualError(t, err, "expected 4 arguments, got 3")
+	_, err = b.Bind(insert, []driver.Value{"3", "carol", true, 1.0})
+	require.EqualError(t, err, "argument 1: cannot use string as INT for column id")
+	_, err = b.Bind(update, []driver.Value{true, int64(2)})
+	require.EqualError(t, err, "argument 1: cannot use bool as FLOAT for column score")
+}
+
+func TestInsertResult(t *testing.T) {
+	b := newTestDatabase(t,
+		"CREATE TABLE 'items' (id int Primary Key, name char(8))",
+	)
+
+	result, err := b.Insert(mustParse(t, "INSERT INTO 'items' (name) VALUES ('a'),('b'),('c')"))
+	require.NoError(t, err)
+	id, err := result.LastInsertId()
+	require.NoError(t, err)
+	require.Equal(t, int64(3), id)
+	n, err := result.RowsAffected()
+	require.NoError(t, err)
+	require.Equal(t, int64(3), n)
+	require.Equal(t, [][]driver.Value{{int64(1)}, {int64(2)}, {int64(3)}}, selectAll(t, b, "SELECT id FROM 'items'"))
+
+	//explicit rowid lower than the last one does not move the counter back
+	result, err = b.Insert(mustParse(t, "INSERT INTO 'items' (id,name) VALUES ('10','d'),('7','e')"))
+	require.NoError(t, err)
+	id, err = result.LastInsertId()
+	require.NoError(t, err)
+	require.Equal(t, int64(7), id)
+	require.Equal(t, int64(10), b.tables[0].lastRowId)
+}
+
+func TestConstraints(t *testing.T) {
+	b := newTestDatabase(t,
+		"CREATE TABLE 'users' (id int Primary Key, age int Unique, name char(8) Not Null, email char(16) Unique Not Null)",
+		"INSERT INTO 'users' (id,age,name,email) VALUES ('1','30','a','a@x'),('2','40','b','b@x')",
+	)
+	require.Equal(t, uint8(COL_UNIQUE), b.tables[0].Columns[1].columnConstraint)
+	require.Equal(t, uint8(COL_NOTNULL), b.tables[0].Columns[2].columnConstraint)
+	require.Equal(t, uint8(COL_NOTNULLUNIQUE), b.tables[0].Columns[3].columnConstraint)
+	require.Len(t, b.tables[0].indexes, 2, "UNIQUE columns are enforced by unique indexes")
+	for i, column := range []string{"age", "email"} {
+		idx := b.tables[0].indexes[i]
+		require.Equal(t, []string{column}, idx.Columns)
+		require.True(t, idx.Unique)
+		require.True(t, idx.backsUnique(&b.tables[0]))
+	}
+	require.ErrorContains(t, b.DropIndex(mustParse(t, "DROP INDEX users_age_unique")), "index users_age_unique enforces UNIQUE on column age")
+
+	requireViolation := func(err error, kind ConstraintKind, column string) {
+		t.Helper()
+		var constraintErr *ConstraintError
+		require.ErrorAs(t, err, &constraintErr)
+		require.Equal(t, ConstraintError{Kind: kind, Table: "users", Column: column}, *constraintErr)
+	}
+
+	_, err := b.Insert(mustParse(t, "INSERT INTO 'users' (id,name,email) VALUES ('1','c','c@x')"))
+	requireViolation(err, PrimaryKeyConstraint, "id")
+	_, err = b.Insert(mustParse(t, "INSERT INTO 'users' (age,name,email) VALUES ('30','c','c@x')"))
+	requireViolation(err, UniqueConstraint, "age")
+	_, err = b.Insert(mustParse(t, "INSERT INTO 'users' (name,email) VALUES ('c','c@x'),('d','c@x')"))
+	requireViolation(err, UniqueConstraint, "email")
+	_, err = b.Insert(mustParse(t, "INSERT INTO 'users' (age,email) VALUES ('50','c@x')"))
+	requireViolation(err, NotNullConstraint, "name")
+	require.Len(t, selectAll(t, b, "SELECT id FROM 'users'"), 2, "rejected inserts store nothing")
+
+	//NULL is not a duplicate of NULL in a UNIQUE column
+	_, err = b.Insert(mustParse(t, "INSERT INTO 'users' (name,email) VALUES ('c','c@x'),('d','d@x')"))
+	require.NoError(t, err)
+
+	_, err = b.Update(mustParse(t, "UPDATE 'users' SET age = '40' WHERE id = '1'"))
+	requireViolation(err, UniqueConstraint, "age")
+	_, err = b.Update(mustParse(t, "UPDATE 'users' SET email = 'z@x' WHERE id >= '3'"))
+	requireViolation(err, UniqueConstraint, "email")
+	n, err := b.Update(mustParse(t, "UPDATE 'users' SET age = '30' WHERE id = '1'"))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n, "a row keeps its own value")
+	_, err = b.Update(mustParse(t, "UPDATE 'users' SET age = '35' WHERE id = '1'"))
+	require.NoError(t, err)
+	_, err = b.Insert(mustParse(t, "INSERT INTO 'users' (age,name,email) VALUES ('30','e','e@x')"))
+	require.NoError(t, err, "the old value is free after an update")
+
+	//deleted and rolled back keys
+	_, err = b.Delete(mustParse(t, "DELETE FROM 'users' WHERE id = '2'"))
+	require.NoError(t, err)
+	_, err = b.Insert(mustParse(t, "INSERT INTO 'users' (id,age,name,email) VALUES ('2','40','b','b@x')"))
+	require.NoError(t, err)
+	tx := begin(t, b)
+	_, err = tx.Insert(mustParse(t, "INSERT INTO 'users' (id,name,email) VALUES ('9','f','f@x')"))
+	require.NoError(t, err)
+	require.NoError(t, tx.Rollback())
+	_, err = b.Insert(mustParse(t, "INSERT INTO 'users' (id,name,email) VALUES ('9','f','f@x')"))
+	require.NoError(t, err)
+
+	reopened, err := OpenExistingDatabase(b.dir)
+	require.NoError(t, err)
+	_, err = reopened.Insert(mustParse(t, "INSERT INTO 'users' (name,email) VALUES ('g','f@x')"))
+	var constraintErr *ConstraintError
+	require.ErrorAs(t, err, &constraintErr)
+	require.Equal(t, "UNIQUE constraint failed: users.email", constraintErr.Error())
+}
+
+func TestVariableLengthColumns(t *testing.T) {
+	b := newTestDatabase(t,
+		"CREATE TABLE 'posts' (id int Primary Key, title varchar(20), body text, tag char(4))",
+		"INSERT INTO 'posts' (id,title,body,tag) VALUES ('1','short','','a'),('2','a longer title','some text','b')",
+		"INSERT INTO 'posts' (id,tag) VALUES ('3','c')",
+	)
+	require.Equal(t, [][]driver.Value{
+		{int64(1), "short", "", "a"},
+		{int64(2), "a longer title", "some text", "b"},
+	}, selectAll(t, b, "SELECT * FROM 'posts' WHERE id <= '2'"))
+	require.Equal(t, [][]driver.Value{{int64(2)}}, selectAll(t, b, "SELECT id FROM 'posts' WHERE title = 'a longer title'"))
+	require.Equal(t, [][]driver.Value{{int64(1)}}, selectAll(t, b, "SELECT id FROM 'posts' WHERE title > tag"))
+
+	_, err := b.Insert(mustParse(t, "INSERT INTO 'posts' (title) VALUES ('twenty one characters')"))
+	require.Error(t, err)
+
+	//rows grow past the space of their leaf and move through splits
+	for i := 4; i <= 200; i++ {
+		_, err := b.Insert(mustParse(t, fmt.Sprintf("INSERT INTO 'posts' (id,title) VALUES ('%d','t%d')", i, i)))
+		require.NoError(t, err)
+	}
+	n, err := b.Update(mustParse(t, fmt.Sprintf("UPDATE 'posts' SET body = '%s' WHERE id >= '3'", strings.Repeat("y", 500))))
+	require.NoError(t, err)
+	require.Equal(t, int64(198), n)
+	table := b.tables[0]
+	require.Len(t, checkTree(t, newBtree(b.reader(), &table)), 200)
+	rows := selectAll(t, b, "SELECT id, title, body FROM 'posts' WHERE id >= '199'")
+	require.Equal(t, [][]driver.Value{
+		{int64(199), "t199", strings.Repeat("y", 500)},
+		{int64(200), "t200", strings.Repeat("y", 500)},
+	}, rows)
+
+	//and shrink back into fewer leaves
+	_, err = b.Update(mustParse(t, "UPDATE 'posts' SET body = 'z' WHERE id >= '3'"))
+	require.NoError(t, err)
+	_, err = b.Delete(mustParse(t, "DELETE FROM 'posts' WHERE id >= '100'"))
+	require.NoError(t, err)
+	table = b.tables[0]
+	require.Len(t, checkTree(t, newBtree(b.reader(), &table)), 99)
+
+	reopened, err := OpenExistingDatabase(b.dir)
+	require.NoError(t, err)
+	require.Equal(t, [][]driver.Value{{"t50", "z"}}, selectAll(t, reopened, "SELECT title, body FROM 'posts' WHERE id = '50'"))
+}
+
+func TestVariableLengthKeys(t *testing.T) {
+	b := newTestDatabase(t,
+		"CREATE TABLE 'users' (name varchar(64) Primary Key, city varchar(32), bio text)",
+		"CREATE INDEX by_city ON 'users' (city)",
+	)
+	tx := begin(t, b)
+	for i := 0; i < 1000; i++ {
+		_, err := tx.Insert(mustParse(t, fmt.Sprintf("INSERT INTO 'users' (name,city) VALUES ('user%d','city%d')", i, i%7)))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tx.Commit())
+	checkIndexes(t, b, "users")
+	require.Equal(t, [][]driver.Value{{"city3"}}, selectAll(t, b, "SELECT city FROM 'users' WHERE name = 'user10'"))
+	require.Len(t, selectAll(t, b, "SELECT name FROM 'users' WHERE city = 'city3'"), 143)
+	_, err := b.Insert(mustParse(t, "INSERT INTO 'users' (name) VALUES ('user10')"))
+	var constraintErr *ConstraintError
+	require.ErrorAs(t, err, &constraintErr)
+
+	//short keys take less room than the widest value of the column
+	require.Less(t, b.tables[0].lastPage, uint64(30))
+
+	require.Error(t, b.CreateTable(mustParse(t, "CREATE TABLE 'docs' (body text Primary Key)")))
+	require.Error(t, b.CreateTable(mustParse(t, "CREATE TABLE 'docs' (id int Primary Key, body text Unique)")))
+	require.Error(t, b.CreateIndex(mustParse(t, "CREATE INDEX by_bio ON 'users' (bio)")))
+	require.Error(t, b.CreateTable(mustParse(t, "CREATE TABLE 'docs' (id varchar(4000) Primary Key)")))
+}
+
+func TestOverflowValues(t *testing.T) {
+	b := newTestDatabase(t, "CREATE TABLE 'files' (id int Primary Key, name varchar(32), data blob, notes text)")
+	large := make([]byte, 3*PAGESIZE+100)
+	for i := range large {
+		large[i] = byte(i % 251)
+	}
+	bound, err := b.Bind(mustParse(t, "INSERT INTO 'files' (id,name,data,notes) VALUES (?,?,?,?)"), []driver.Value{int64(1), "image", large, strings.Repeat("n", 5000)})
+	require.NoError(t, err)
+	_, err = b.Insert(bound)
+	require.NoError(t, err)
+	_, err = b.Insert(mustParse(t, "INSERT INTO 'files' (id,name,data) VALUES ('2','small','abc')"))
+	require.NoError(t, err)
+	table := b.tables[0]
+	pagesWithValues := table.lastPage
+	require.Greater(t, pagesWithValues, uint64(4), "values moved to overflow pages")
+
+	rows := selectAll(t, b, "SELECT data, notes FROM 'files' WHERE name = 'image'")
+	require.Equal(t, [][]driver.Value{{large, strings.Repeat("n", 5000)}}, rows)
+	require.Equal(t, [][]driver.Value{{[]byte("abc")}}, selectAll(t, b, "SELECT data FROM 'files' WHERE id = '2'"))
+	require.Len(t, selectAll(t, b, fmt.Sprintf("SELECT id FROM 'files' WHERE notes = '%s'", strings.Repeat("n", 5000))), 1)
+
+	//a shorter value frees the old chain and the pages are reused by the next large value
+	_, err = b.Update(mustParse(t, "UPDATE 'files' SET notes = 'short' WHERE id = '1'"))
+	require.NoError(t, err)
+	require.NotEmpty(t, b.tables[0].freePages)
+	_, err = b.Update(mustParse(t, fmt.Sprintf("UPDATE 'files' SET notes = '%s' WHERE id = '2'", strings.Repeat("m", 5000))))
+	require.NoError(t, err)
+	require.Equal(t, pagesWithValues, b.tables[0].lastPage)
+
+	reopened, err := OpenExistingDatabase(b.dir)
+	require.NoError(t, err)
+	require.Equal(t, b.tables[0].lastPage, reopened.tables[0].lastPage)
+	require.ElementsMatch(t, b.tables[0].freePages, reopened.tables[0].freePages, "overflow pages are not mistaken for free ones")
+	rows = selectAll(t, reopened, "SELECT id, data, notes FROM 'files'")
+	require.Equal(t, [][]driver.Value{
+		{int64(1), large, "short"},
+		{int64(2), []byte("abc"), strings.Repeat("m", 5000)},
+	}, rows)
+
+	_, err = reopened.Delete(mustParse(t, "DELETE FROM 'files' WHERE id >= '1'"))
+	require.NoError(t, err)
+	require.Len(t, reopened.tables[0].freePages, int(reopened.tables[0].lastPage), "every page but the root is free")
+
+	require.Error(t, b.CreateTable(mustParse(t, "CREATE TABLE 'bad' (data blob Primary Key)")))
+	require.Error(t, b.CreateIndex(mustParse(t, "CREATE INDEX by_data ON 'files' (data)")))
+}
+
+func TestDateTimeColumns(t *testing.T) {
+	b := newTestDatabase(t,
+		"CREATE TABLE 'events' (id int Primary Key, day date, at timestamp, length interval)",
+		"INSERT INTO 'events' (id,day,at,length) VALUES ('1','2024-02-29','2024-02-29T13:45:30.123456Z','1h30m')",
+		"INSERT INTO 'events' (id,day,at,length) VALUES ('2','1969-12-31','1969-12-31 23:59:59','P1DT2H')",
+		"INSERT INTO 'events' (id,day,at,length) VALUES ('3','2024-03-01T22:00:00-05:00','2024-03-01T22:00:00-05:00','-PT90S')",
+	)
+	rows := selectAll(t, b, "SELECT day, at, length FROM 'events'")
+	require.Equal(t, [][]driver.Value{
+		{time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 29, 13, 45, 30, 123456000, time.UTC), int64(90 * time.Minute)},
+		{time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC), time.Date(1969, 12, 31, 23, 59, 59, 0, time.UTC), int64(26 * time.Hour)},
+		{time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 2, 3, 0, 0, 0, time.UTC), int64(-90 * time.Second)},
+	}, rows)
+
+	require.Equal(t, [][]driver.Value{{int64(1)}, {int64(3)}}, selectAll(t, b, "SELECT id FROM 'events' WHERE day >= '2024-01-01'"))
+	require.Equal(t, [][]driver.Value{{int64(3)}}, selectAll(t, b, "SELECT id FROM 'events' WHERE at > '2024-03-01 12:00:00'"))
+	require.Equal(t, [][]driver.Value{{int64(2)}}, selectAll(t, b, "SELECT id FROM 'events' WHERE length > 'P1D'"))
+	_, err := b.Select(mustParse(t, "SELECT id FROM 'events' WHERE length > '1d'"))
+	require.Error(t, err)
+	_, err = b.Insert(mustParse(t, "INSERT INTO 'events' (day) VALUES ('2024-13-01')"))
+	require.Error(t, err)
+
+	//bound values round trip
+	at := time.Date(2030, 6, 15, 8, 0, 0, 500, time.FixedZone("CEST", 2*60*60))
+	q, err := b.Bind(mustParse(t, "INSERT INTO 'events' (id,day,at,length) VALUES ('4',?,?,?)"), []driver.Value{at, at, int64(45 * time.Second)})
+	require.NoError(t, err)
+	_, err = b.Insert(q)
+	require.NoError(t, err)
+	q, err = b.Bind(mustParse(t, "SELECT day, at, length FROM 'events' WHERE at = ?"), []driver.Value{at.Truncate(time.Microsecond)})
+	require.NoError(t, err)
+	result, err := b.Select(q)
+	require.NoError(t, err)
+	dest := make([]driver.Value, 3)
+	require.NoError(t, result.Next(dest))
+	require.Equal(t, time.Date(2030, 6, 15, 0, 0, 0, 0, time.UTC), dest[0])
+	require.True(t, at.Truncate(time.Microsecond).Equal(dest[1].(time.Time)))
+	require.Equal(t, int64(45*time.Second), dest[2])
+}
+
+func TestKeywordColumnNames(t *testing.T) {
+	b := newTestDatabase(t,
+		"CREATE TABLE 'events' (id int Primary Key, date date, text text, limit int)",
+		"INSERT INTO 'events' (id, date, text, limit) VALUES (1, '2024-02-29', 'leap', 3)",
+		"INSERT INTO 'events' (id, date, text, limit) VALUES (2, '2023-01-01', 'new year', 5)",
+		"CREATE TABLE 'tags' (id int Primary Key, on int, text char(8))",
+		"INSERT INTO 'tags' (id, on, text) VALUES (1, 2, 'holiday')",
+	)
+	require.Equal(t, [][]driver.Value{{time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), "new year"}},
+		selectAll(t, b, "SELECT date, text FROM 'events' WHERE date < '2024-01-01' ORDER BY date LIMIT 1"))
+	_, err := b.Update(mustParse(t, "UPDATE 'events' SET limit = 4 WHERE date = '2024-02-29'"))
+	require.NoError(t, err)
+	require.Equal(t, [][]driver.Value{{int64(4)}, {int64(5)}}, selectAll(t, b, "SELECT limit FROM 'events' ORDER BY limit"))
+	require.NoError(t, b.CreateIndex(mustParse(t, "CREATE INDEX by_date ON 'events' (date)")))
+	require.Equal(t, [][]driver.Value{{"new year", "holiday"}},
+		selectAll(t, b, "SELECT e.text, g.text FROM 'events' AS e JOIN 'tags' AS g ON e.id = g.on"))
+}
+
+func TestDecimalColumns(t *testing.T) {
+	b := newTestDatabase(t,
+		"CREATE TABLE 'prices' (amount decimal(12, 2) Primary Key, rate decimal(5,4), qty int, ratio float)",
+		"INSERT INTO 'prices' (amount,rate,qty,ratio) VALUES ('0.10','0.0001','1','0.1')",
+		"INSERT INTO 'prices' (amount,rate,qty,ratio) VALUES ('-1234567890.005','1','2','2.5')",
+		"INSERT INTO 'prices' (amount,rate,qty,ratio) VALUES ('2','-3.14159','2','2')",
+		"INSERT INTO 'prices' (amount,rate,qty,ratio) VALUES ('1.5e2','0.5','150','0')",
+	)
+	rows := selectAll(t, b, "SELECT amount, rate FROM 'prices'")
+	require.Equal(t, [][]driver.Value{
+		{"-1234567890.01", "1.0000"},
+		{"0.10", "0.0001"},
+		{"2.00", "-3.1416"},
+		{"150.00", "0.5000"},
+	}, rows)
+
+	//comparisons are exact, also across scales and with INT columns
+	require.Equal(t, [][]driver.Value{{"0.10"}}, selectAll(t, b, "SELECT amount FROM 'prices' WHERE amount = '0.1'"))
+	require.Empty(t, selectAll(t, b, "SELECT amount FROM 'prices' WHERE amount = '0.101'"))
+	require.Equal(t, [][]driver.Value{{"0.10"}}, selectAll(t, b, "SELECT amount FROM 'prices' WHERE rate < amount AND amount < '1'"))
+	require.Equal(t, [][]driver.Value{{"2.00"}, {"150.00"}}, selectAll(t, b, "SELECT amount FROM 'prices' WHERE amount = qty"))
+	require.Equal(t, [][]driver.Value{{"-1234567890.01"}, {"0.10"}, {"2.00"}}, selectAll(t, b, "SELECT amount FROM 'prices' WHERE amount <= ratio"))
+
+	_, err := b.Insert(mustParse(t, "INSERT INTO 'prices' (amount) VALUES ('10000000000')"))
+	require.Error(t, err)
+	_, err = b.Insert(mustParse(t, "INSERT INTO 'prices' (amount) VALUES ('1.2.3')"))
+	require.Error(t, err)
+	_, err = b.Insert(mustParse(t, "INSERT INTO 'prices' (amount) VALUES ('2.001')"))
+	var constraintErr *ConstraintError
+	require.ErrorAs(t, err, &constraintErr, "2.001 rounds to the existing key 2.00")
+
+	//bound values round trip
+	q, err := b.Bind(mustParse(t, "INSERT INTO 'prices' (amount,rate) VALUES (?,?)"), []driver.Value{"99999999.99", 0.1})
+	require.NoError(t, err)
+	_, err = b.Insert(q)
+	require.NoError(t, err)
+	q, err = b.Bind(mustParse(t, "SELECT amount, rate FROM 'prices' WHERE amount > ?"), []driver.Value{int64(1000)})
+	require.NoError(t, err)
+	result, err := b.Select(q)
+	require.NoError(t, err)
+	dest := make([]driver.Value, 2)
+	require.NoError(t, result.Next(dest))
+	require.Equal(t, []driver.Value{"99999999.99", "0.1000"}, dest)
+
+	for _, sql := range []string{
+		"CREATE TABLE 'bad' (id int Primary Key, d decimal)",
+		"CREATE TABLE 'bad' (id int Primary Key, d decimal(39, 2))",
+		"CREATE TABLE 'bad' (id int Primary Key, d decimal(4, 5))",
+	} {
+		require.Error(t, b.CreateTable(mustParse(t, sql)), sql)
+	}
+	reopened, err := OpenExistingDatabase(b.dir)
+	require.NoError(t, err)
+	require.Equal(t, b.tables[0].Columns, reopened.tables[0].Columns)
+}
+
+func TestSmallIntegerColumns(t *testing.T) {
+	b := newTestDatabase(t,
+		"CREATE TABLE 'counts' (id smallint Primary Key, flag tinyint, n integer, big bigint, uflag tinyint unsigned, un integer unsigned, ubig bigint unsigned)",
+		"INSERT INTO 'counts' (id,flag,n,big,uflag,un,ubig) VALUES ('-32768','-128','-2147483648','-9223372036854775808','0','0','0')",
+		"INSERT INTO 'counts' (id,flag,n,big,uflag,un,ubig) VALUES ('32767','127','2147483647','9223372036854775807','255','4294967295','18446744073709551615')",
+		"INSERT INTO 'counts' (id,flag,n,big,uflag,un,ubig) VALUES ('5','5','5','5','5','5','5')",
+	)
+	table := b.tables[0]
+	require.Equal(t, 2+1+4+8+1+4+8, int(table.GenerateRowBytes()), "columns take only their width")
+	require.Equal(t, uint8(INT), table.Columns[3].columnType, "BIGINT is INT")
+
+	require.Equal(t, [][]driver.Value{
+		{int64(-32768), int64(-128), int64(-2147483648), int64(-9223372036854775808), int64(0), int64(0), int64(0)},
+		{int64(5), int64(5), int64(5), int64(5), int64(5), int64(5), int64(5)},
+		{int64(32767), int64(127), int64(2147483647), int64(9223372036854775807), int64(255), int64(4294967295), "18446744073709551615"},
+	}, selectAll(t, b, "SELECT * FROM 'counts'"))
+
+	//the largest UBIGINT is a valid driver value holding every digit
+	largest := selectAll(t, b, "SELECT ubig FROM 'counts' WHERE ubig = 18446744073709551615")
+	require.Len(t, largest, 1)
+	require.True(t, driver.IsValue(largest[0][0]))
+	n, err := strconv.ParseUint(largest[0][0].(string), 10, 64)
+	require.NoError(t, err)
+	require.Equal(t, uint64(math.MaxUint64), n)
+
+	for _, sql := range []string{
+		"INSERT INTO 'counts' (id,flag) VALUES ('1','128')",
+		"INSERT INTO 'counts' (id,n) VALUES ('1','2147483648')",
+		"INSERT INTO 'counts' (id,uflag) VALUES ('1','-1')",
+		"INSERT INTO 'counts' (id) VALUES ('32768')",
+	} {
+		_, err := b.Insert(mustParse(t, sql))
+		require.ErrorContains(t, err, "out of range", sql)
+	}
+
+	//columns of different widths and signedness compare by value
+	ids := func(sql string) []driver.Value {
+		result := []driver.Value{}
+		for _, row := range selectAll(t, b, sql) {
+			result = append(result, row[0])
+		}
+		return result
+	}
+	require.Equal(t, []driver.Value{int64(5)}, ids("SELECT id FROM 'counts' WHERE flag = ubig"))
+	require.Equal(t, []driver.Value{int64(-32768), int64(32767)}, ids("SELECT id FROM 'counts' WHERE n < un"))
+	require.Equal(t, []driver.Value{int64(-32768), int64(32767)}, ids("SELECT id FROM 'counts' WHERE ubig > big"))
+	require.Equal(t, []driver.Value{int64(-32768)}, ids("SELECT id FROM 'counts' WHERE flag < '0'"))
+	require.Equal(t, []driver.Value{int64(5), int64(32767)}, ids("SELECT id FROM 'counts' WHERE id >= '5'"))
+
+	//literals out of the range of a column compare by value instead of failing
+	all := []driver.Value{int64(-32768), int64(5), int64(32767)}
+	require.Equal(t, all, ids("SELECT id FROM 'counts' WHERE flag < 1000"))
+	require.Equal(t, all, ids("SELECT id FROM 'counts' WHERE uflag >= -1"))
+	require.Empty(t, ids("SELECT id FROM 'counts' WHERE un = -1 OR flag > 1000"))
+	require.Equal(t, all, ids("SELECT id FROM 'counts' WHERE id > -40000 AND id < 40000"))
+	require.Equal(t, all, ids("SELECT id FROM 'counts' WHERE big < 9223372036854775808"))
+	require.Equal(t, all, ids("SELECT id FROM 'counts' WHERE ubig > -99999999999999999999"))
+	require.Equal(t, []driver.Value{int64(5)}, ids("SELECT id FROM 'counts' WHERE n > '4.5' AND n < '5.5'"))
+	_, err = b.Select(mustParse(t, "SELECT id FROM 'counts' WHERE flag < 'many'"))
+	require.ErrorContains(t, err, "invalid TINYINT value for column flag: many")
+
+	reopened, err := OpenExistingDatabase(b.dir)
+	require.NoError(t, err)
+	require.Equal(t, b.tables[0].Columns, reopened.tables[0].Columns)
+}
+
+func TestNullValues(t *testing.T) {
+	b := newTestDatabase(t,
+		"CREATE TABLE 'people' (id int Primary Key, name varchar(20), age int, email char(20) Unique)",
+		"INSERT INTO 'people' (id,name,age,email) VALUES (NULL,'alice','30',NULL),('5',NULL,NULL,'b@x')",
+		"INSERT INTO 'people' (id,name,age,email) VALUES (NULL,'','40',NULL)",
+	)
+	require.Equal(t, [][]driver.Value{
+		{int64(1), "alice", int64(30), nil},
+		{int64(5), nil, nil, "b@x"},
+		{int64(6), "", int64(40), nil},
+	}, selectAll(t, b, "SELECT * FROM 'people'"))
+
+	ids := func(sql string) [][]driver.Value { return selectAll(t, b, sql) }
+	require.Equal(t, [][]driver.Value{{int64(5)}}, ids("SELECT id FROM 'people' WHERE name IS NULL"))
+	require.Equal(t, [][]driver.Value{{int64(1)}, {int64(6)}}, ids("SELECT id FROM 'people' WHERE name IS NOT NULL"))
+	require.Equal(t, [][]driver.Value{{int64(1)}}, ids("SELECT id FROM 'people' WHERE email IS NULL AND NOT age > '35'"))
+	require.Empty(t, ids("SELECT id FROM 'people' WHERE age = NULL OR age != NULL"))
+
+	//nulls scan into sql.Null types
+	rows, err := b.Select(mustParse(t, "SELECT name, age FROM 'people' WHERE id = '5'"))
+	require.NoError(t, err)
+	dest := make([]driver.Value, 2)
+	require.NoError(t, rows.Next(dest))
+	var name sql.NullString
+	var age sql.NullInt64
+	require.NoError(t, name.Scan(dest[0]))
+	require.NoError(t, age.Scan(dest[1]))
+	require.False(t, name.Valid)
+	require.False(t, age.Valid)
+
+	n, err := b.Update(mustParse(t, "UPDATE 'people' SET age = NULL, name = 'bob' WHERE id = '1'"))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+	require.Equal(t, [][]driver.Value{{"bob", nil}}, ids("SELECT name, age FROM 'people' WHERE id = '1'"))
+	_, err = b.Update(mustParse(t, "UPDATE 'people' SET id = NULL WHERE id = '1'"))
+	var constraintErr *ConstraintError
+	require.ErrorAs(t, err, &constraintErr)
+	require.Equal(t, NotNullConstraint, constraintErr.Kind)
+
+	//nil arguments bind as NULL
+	q, err := b.Bind(mustParse(t, "UPDATE 'people' SET email = ? WHERE id = ?"), []driver.Value{nil, int64(5)})
+	require.NoError(t, err)
+	_, err = b.Update(q)
+	require.NoError(t, err)
+	require.Equal(t, [][]driver.Value{{int64(1)}, {int64(5)}, {int64(6)}}, ids("SELECT id FROM 'people' WHERE email IS NULL"))
+}
+
+func TestTypedLiterals(t *testing.T) {
+	b := newTestDatabase(t,
+		"CREATE TABLE 'items' (id int Primary Key, name varchar(20), price float, amount decimal(8,2), active bool)",
+		"INSERT INTO 'items' (id,name,price,amount,active) VALUES (1, 'it''s', 2.5, 10, true), (2, 'plain', 3, 1.25e1, FALSE)",
+		"INSERT INTO 'items' (name,price,amount,active) VALUES ('quoted', '4', '7.5', 'true')",
+	)
+	require.Equal(t, [][]driver.Value{
+		{int64(1), "it's", 2.5, "10.00", true},
+		{int64(2), "plain", 3.0, "12.50", false},
+		{int64(3), "quoted", 4.0, "7.50", true},
+	}, selectAll(t, b, "SELECT * FROM 'items'"))
+
+	require.Equal(t, [][]driver.Value{{int64(2)}, {int64(3)}}, selectAll(t, b, "SELECT id FROM 'items' WHERE price >= 3 AND id > 1"))
+	require.Equal(t, [][]driver.Value{{int64(2)}}, selectAll(t, b, "SELECT id FROM 'items' WHERE active = false"))
+	n, err := b.Update(mustParse(t, "UPDATE 'items' SET price = 9, active = TRUE WHERE name = 'it''s'"))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+	require.Equal(t, [][]driver.Value{{9.0, true}}, selectAll(t, b, "SELECT price, active FROM 'items' WHERE id = 1"))
+
+	//unquoted literals of the wrong type are rejected with the column they were meant for
+	for sql, msg := range map[string]string{
+		"INSERT INTO 'items' (id,name) VALUES (4, 5)":          "type mismatch: cannot use integer 5 as VARCHAR for column name",
+		"INSERT INTO 'items' (id,active) VALUES (4, 1)":        "type mismatch: cannot use integer 1 as BOOL for column active",
+		"INSERT INTO 'items' (id) VALUES (4.5)":                "type mismatch: cannot use float 4.5 as INT for column id",
+		"UPDATE 'items' SET price = true WHERE id = 1":         "type mismatch: cannot use boolean true as FLOAT for column price",
+		"SELECT id FROM 'items' WHERE name = 1":                "WHERE: type mismatch: cannot compare VARCHAR column name with integer 1",
+		"DELETE FROM 'items' WHERE active = 'maybe' OR id = 2": "WHERE: invalid BOOL value for column active: maybe",
+	} {
+		q := mustParse(t, sql)
+		switch q.Type {
+		case Insert:
+			_, err = b.Insert(q)
+		case Update:
+			_, err = b.Update(q)
+		case Select:
+			_, err = b.Select(q)
+		case Delete:
+			_, err = b.Delete(q)
+		}
+		require.ErrorContains(t, err, msg, sql)
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	b := newTestDatabase(t,
+		"CREATE TABLE 'people' (id int Primary Key, name varchar(20), age int)",
+		"INSERT INTO 'people' (id,name,age) VALUES (1,'carol',30),(2,'alice',NULL),(3,'bob',25),(4,'dave',30)",
+	)
+	require.Equal(t, [][]driver.Value{{"bob"}, {"carol"}, {"dave"}, {"alice"}}, selectAll(t, b, "SELECT name FROM 'people' ORDER BY age"))
+	require.Equal(t, [][]driver.Value{{"alice"}, {"dave"}, {"carol"}, {"bob"}}, selectAll(t, b, "SELECT name FROM 'people' ORDER BY age DESC, name DESC"))
+	require.Equal(t, [][]driver.Value{{"alice"}, {"bob"}, {"carol"}}, selectAll(t, b, "SELECT name FROM 'people' WHERE id < 4 ORDER BY age NULLS FIRST"))
+	require.Equal(t, [][]driver.Value{{int64(3), int64(25)}, {int64(4), int64(30)}, {int64(1), int64(30)}}, selectAll(t, b, "SELECT id, age AS years FROM 'people' WHERE age >= 25 ORDER BY years, name DESC"))
+
+	_, err := b.Select(mustParse(t, "SELECT name FROM 'people' ORDER BY height"))
+	require.ErrorContains(t, err, "ORDER BY: columns not in table: height")
+
+	//a tiny sort memory spills every row to its own run which are merged back in order
+	dir := t.TempDir()
+	b = CreateNewDatabase(dir)
+	require.NoError(t, b.CreateTable(mustParse(t, "CREATE TABLE 'nums' (id int Primary Key, n int, label varchar(10))")))
+	values := []string{}
+	for i := 1; i <= 200; i++ {
+		values = append(values, fmt.Sprintf("(%d,%d,'l%d')", i, (i*37)%50, i))
+	}
+	_, err = b.Insert(mustParse(t, "INSERT INTO 'nums' (id,n,label) VALUES "+strings.Join(values, ",")))
+	require.NoError(t, err)
+	b.SetSortMemory(1)
+	rows := selectAll(t, b, "SELECT id FROM 'nums' ORDER BY n DESC")
+	require.Len(t, rows, 200)
+	prev := int64(50)
+	for i, row := range rows {
+		n := (row[0].(int64) * 37) % 50
+		require.LessOrEqual(t, n, prev)
+		if n == prev && i > 0 {
+			require.Greater(t, row[0].(int64), rows[i-1][0].(int64), "rows with equal keys keep their order")
+		}
+		prev = n
+	}
+	runs, err := filepath.Glob(filepath.Join(dir, "sort-*"))
+	require.NoError(t, err)
+	require.Empty(t, runs)
+
+	//the 200 runs are merged into groups first so at most sortMergeFanIn files are read at once
+	r, err := b.Select(mustParse(t, "SELECT id FROM 'nums' ORDER BY n"))
+	require.NoError(t, err)
+	dest := make([]driver.Value, 1)
+	require.NoError(t, r.Next(dest))
+	runs, err = filepath.Glob(filepath.Join(dir, "sort-*"))
+	require.NoError(t, err)
+	require.NotEmpty(t, runs)
+	require.LessOrEqual(t, len(runs), sortMergeFanIn)
+	require.NoError(t, r.Close())
+}
+
+// closedRows returns its rows and counts how often it is closed
+type closedRows struct {
+	rows   [][]Cell
+	closes int
+}
+
+func (c *closedRows) next() ([]Cell, error) {
+	if len(c.rows) == 0 {
+		return nil, io.EOF
+	}
+	row := c.rows[0]
+	c.rows = c.rows[1:]
+	return row, nil
+}
+
+func (c *closedRows) close() error {
+	c.closes++
+	return nil
+}
+
+func TestSortClosesInputOnce(t *testing.T) {
+	input := &closedRows{rows: [][]Cell{{Cell("b")}, {Cell("a")}}}
+	s := &sortRows{input: input, sorter: newRowSorter(t.TempDir(), SORTMEMORY, []sortKey{{column: 0, colType: VARCHAR}}), width: 1}
+	row, err := s.next()
+	require.NoError(t, err)
+	require.Equal(t, []Cell{Cell("a")}, row)
+	require.Equal(t, 1, input.closes)
+	require.NoError(t, s.close())
+	require.Equal(t, 1, input.closes)
+
+	//rows closed before being read close their input too
+	input = &closedRows{rows: [][]Cell{{Cell("a")}}}
+	s = &sortRows{input: input, sorter: newRowSorter(t.TempDir(), SORTMEMORY, []sortKey{{column: 0, colType: VARCHAR}}), width: 1}
+	require.NoError(t, s.close())
+	require.Equal(t, 1, input.closes)
+}
+
+func TestLimitOffset(t *testing.T) {
+	b := newTestDatabase(t, "CREATE TABLE 'nums' (id int Primary Key, n int, label char(200))")
+	values := []string{}
+	for i := 1; i <= 100; i++ {
+		values = append(values, fmt.Sprintf("(%d,%d,'l%d')", i, 100-i, i))
+	}
+	_, err := b.Insert(mustParse(t, "INSERT INTO 'nums' (id,n,label) VALUES "+strings.Join(values, ",")))
+	require.NoError(t, err)
+
+	ids := func(sql string) []int64 {
+		result := []int64{}
+		for _, row := range selectAll(t, b, sql) {
+			result = append(result, row[0].(int64))
+		}
+		return result
+	}
+	require.Equal(t, []int64{1, 2, 3}, ids("SELECT id FROM 'nums' LIMIT 3"))
+	require.Equal(t, []int64{11, 12}, ids("SELECT id FROM 'nums' LIMIT 2 OFFSET 10"))
+	require.Equal(t, []int64{53, 54}, ids("SELECT id FROM 'nums' WHERE id > 50 AND n != 49 LIMIT 2 OFFSET 1"))
+	require.Equal(t, []int64{97, 96}, ids("SELECT id FROM 'nums' ORDER BY n LIMIT 2 OFFSET 3"))
+	require.Equal(t, []int64{99, 100}, ids("SELECT id FROM 'nums' LIMIT 5 OFFSET 98"))
+	require.Empty(t, ids("SELECT id FROM 'nums' LIMIT 0"))
+	require.Empty(t, ids("SELECT id FROM 'nums' LIMIT 5 OFFSET 100"))
+
+	//the scan stops before the last leaf so its corruption goes unnoticed
+	tx := b.reader()
+	_, leaf, err := newBtree(tx, &b.tables[0]).descend(nil)
+	require.NoError(t, err)
+	first := leaf.id
+	for leaf.next() != 0 {
+		leaf, err = newBtree(tx, &b.tables[0]).readNode(leaf.next())
+		require.NoError(t, err)
+	}
+	require.NotEqual(t, first, leaf.id)
+	f, err := os.OpenFile(filepath.Join(b.dir, "nums.db"), os.O_WRONLY, 0700)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("x"), int64(leaf.id)*PAGESIZE+PAGESIZE-1)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.NoError(t, b.bufferPool.RemovePool("nums"))
+	b.bufferPool.NewPool("nums", b.dir)
+
+	require.Equal(t, []int64{1, 2}, ids("SELECT id FROM 'nums' LIMIT 2"))
+	rows, err := b.Select(mustParse(t, "SELECT id FROM 'nums'"))
+	require.NoError(t, err)
+	dest := make([]driver.Value, 1)
+	for err == nil {
+		err = rows.Next(dest)
+	}
+	require.ErrorContains(t, err, fmt.Sprintf("page %d has been corrupted", leaf.id))
+}
+
+func TestAggregates(t *testing.T) {
+	b := newTestDatabase(t,
+		"CREATE TABLE 'sales' (id int Primary Key, city varchar(10), qty smallint, price float, amount decimal(8,2), sold date)",
+		"INSERT INTO 'sales' (id,city,qty,price,amount,sold) VALUES (1,'paris',3,1.5,'10.10','2024-01-02'),(2,'rome',1,2,'5.00','2024-01-01')",
+		"INSERT INTO 'sales' (id,city,qty,price,amount,sold) VALUES (3,'paris',NULL,4,'0.05',NULL),(4,NULL,5,NULL,NULL,'2024-03-01'),(5,'paris',2,0.5,'1.00','2023-12-31')",
+	)
+	rows, err := b.Select(mustParse(t, "SELECT COUNT(*) AS n, COUNT(qty), SUM(qty), AVG(qty), SUM(amount), AVG(amount), MIN(city), MAX(sold) FROM 'sales'"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"n", "COUNT(qty)", "SUM(qty)", "AVG(qty)", "SUM(amount)", "AVG(amount)", "MIN(city)", "MAX(sold)"}, rows.Columns())
+	require.Equal(t, []ResultColumn{{"n", INT}, {"COUNT(qty)", INT}, {"SUM(qty)", INT}, {"AVG(qty)", FLOAT}, {"SUM(amount)", DECIMAL},
+		{"AVG(amount)", DECIMAL}, {"MIN(city)", VARCHAR}, {"MAX(sold)", DATE}}, rows.(*Rows).columns)
+	dest := make([]driver.Value, 8)
+	require.NoError(t, rows.Next(dest))
+	require.Equal(t, []driver.Value{int64(5), int64(4), int64(11), 2.75, "16.15", "4.03750000", "paris", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}, dest)
+
+	require.Equal(t, [][]driver.Value{
+		{"paris", int64(3), 6.0, "11.15"},
+		{"rome", int64(1), 2.0, "5.00"},
+		{nil, int64(1), nil, nil},
+	}, selectAll(t, b, "SELECT city, COUNT(*), SUM(price), SUM(amount) FROM 'sales' GROUP BY city"))
+	require.Equal(t, [][]driver.Value{{"rome", int64(1)}, {nil, int64(5)}}, selectAll(t, b,
+		"SELECT city, MAX(qty) AS most FROM 'sales' WHERE id > 1 GROUP BY city HAVING most IS NOT NULL AND COUNT(*) < 2 ORDER BY most"))
+	require.Equal(t, [][]driver.Value{{"paris"}}, selectAll(t, b, "SELECT city FROM 'sales' GROUP BY city ORDER BY COUNT(*) DESC LIMIT 1"))
+	require.Equal(t, [][]driver.Value{{"rome"}}, selectAll(t, b, "SELECT city FROM 'sales' GROUP BY city HAVING MIN(price) >= 2"))
+
+	//no matching row still gives the one group of a query without GROUP BY
+	require.Equal(t, [][]driver.Value{{int64(0), nil, nil}}, selectAll(t, b, "SELECT COUNT(*), SUM(qty), MIN(city) FROM 'sales' WHERE id > 10"))
+	require.Empty(t, selectAll(t, b, "SELECT city, COUNT(*) FROM 'sales' WHERE id > 10 GROUP BY city"))
+
+	for sql, msg := range map[string]string{
+		"SELECT city, COUNT(*) FROM 'sales'":                           "SELECT: column city must be in GROUP BY or used in an aggregate function",
+		"SELECT *, COUNT(*) FROM 'sales'":                              "SELECT: * cannot be used with GROUP BY or aggregate functions",
+		"SELECT SUM(city) FROM 'sales'":                                "SUM(city): cannot aggregate VARCHAR column city",
+		"SELECT AVG(height) FROM 'sales'":                              "AVG(height): column not in table: height",
+		"SELECT city FROM 'sales' GROUP BY town":                       "GROUP BY: column not in table: town",
+		"SELECT city FROM 'sales' GROUP BY city HAVING qty > 1":        "HAVING: column not in table: qty",
+		"SELECT city FROM 'sales' GROUP BY city HAVING COUNT(*) > 'x'": "HAVING: invalid INT value for column COUNT(*): x",
+		"SELECT city FROM 'sales' GROUP BY city ORDER BY price":        "ORDER BY: column price must be in GROUP BY or used in an aggregate function",
+	} {
+		_, err := b.Select(mustParse(t, sql))
+		require.ErrorContains(t, err, msg, sql)
+	}
+}
+
+func TestJoins(t *testing.T) {
+	b := newTestDatabase(t,
+		"CREATE TABLE 'people' (id int Primary Key, name varchar(10), city varchar(10))",
+		"CREATE TABLE 'orders' (id int Primary Key, person int, qty int, item varchar(10))",
+		"CREATE TABLE 'items' (id int Primary Key, name varchar(10), price float)",
+		"CREATE INDEX by_person ON 'orders' (person)",
+		"INSERT INTO 'people' (id,name,city) VALUES (1,'alice','paris'),(2,'bob','rome'),(3,'carol',NULL)",
+		"INSERT INTO 'orders' (id,person,qty,item) VALUES (10,1,2,'pen'),(11,2,1,'ink'),(12,1,5,'ink'),(13,NULL,7,'pen')",
+		"INSERT INTO 'items' (id,name,price) VALUES (1,'pen',1.5),(2,'ink',4)",
+	)
+	require.Equal(t, [][]driver.Value{
+		{"alice", int64(10), int64(2)},
+		{"alice", int64(12), int64(5)},
+		{"bob", int64(11), int64(1)},
+	}, selectAll(t, b, "SELECT p.name, o.id, qty FROM 'people' AS p JOIN 'orders' AS o ON o.person = p.id"))
+	require.Equal(t, [][]driver.Value{
+		{"alice", "pen", 1.5},
+		{"alice", "ink", 4.0},
+		{"bob", "ink", 4.0},
+		{"carol", nil, nil},
+	}, selectAll(t, b, "SELECT p.name, o.item, i.price FROM 'people' AS p LEFT JOIN 'orders' AS o ON person = p.id LEFT JOIN 'items' AS i ON i.name = item"))
+	require.Equal(t, [][]driver.Value{{"ink", "bob"}, {"pen", nil}}, selectAll(t, b,
+		"SELECT item, p.name AS buyer FROM 'orders' LEFT JOIN 'people' AS p ON p.id = person AND p.city = 'rome' WHERE qty != 5 AND qty != 2 ORDER BY item"))
+
+	//aggregates, GROUP BY and LIMIT run on the combined rows
+	require.Equal(t, [][]driver.Value{{"alice", int64(2), 5.5}, {"bob", int64(1), 4.0}}, selectAll(t, b,
+		"SELECT p.name, COUNT(*), SUM(price) FROM 'orders' AS o JOIN 'people' AS p ON p.id = o.person JOIN 'items' ON items.name = o.item GROUP BY p.name ORDER BY p.name"))
+	require.Equal(t, [][]driver.Value{{"alice"}}, selectAll(t, b, "SELECT p.name FROM 'people' AS p JOIN 'orders' ON person = p.id LIMIT 1"))
+	require.Equal(t, [][]driver.Value{{"alice"}}, selectAll(t, b, "SELECT p.name FROM people AS p JOIN orders ON person = p.id LIMIT 1"), "join tables may be unquoted like the FROM table")
+	require.Equal(t, [][]driver.Value{{"alice", int64(12)}}, selectAll(t, b, "SELECT p.name, o.id FROM people p JOIN 'orders' o ON o.person = p.id WHERE o.qty > 2"), "aliases may leave out AS")
+	require.Equal(t, [][]driver.Value{{"bob"}}, selectAll(t, b, "SELECT p.name FROM 'people' AS p WHERE p.city = 'rome'"))
+	require.Equal(t, [][]driver.Value{{int64(2), "bob"}}, selectAll(t, b, "SELECT people.id, name FROM 'people' WHERE people.id = 2"), "a single table qualifies columns by its name")
+	require.Equal(t, [][]driver.Value{{"paris", int64(1)}}, selectAll(t, b, "SELECT people.city, COUNT(*) FROM people GROUP BY people.city HAVING COUNT(people.id) = 1 ORDER BY people.city LIMIT 1"))
+	rows, err := b.Select(mustParse(t, "SELECT * FROM 'people' AS p JOIN 'items' ON p.id > 2"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"p.id", "p.name", "p.city", "items.id", "items.name", "items.price"}, rows.Columns())
+
+	q, err := b.Bind(mustParse(t, "SELECT o.id FROM 'people' AS p JOIN 'orders' AS o ON o.person = p.id WHERE p.name = ? AND qty > $2"), []driver.Value{"alice", int64(3)})
+	require.NoError(t, err)
+	rows, err = b.Select(q)
+	require.NoError(t, err)
+	dest := make([]driver.Value, 1)
+	require.NoError(t, rows.Next(dest))
+	require.Equal(t, int64(12), dest[0])
+	require.Equal(t, io.EOF, rows.Next(dest))
+
+	//the join operator follows the ON condition and the indexes of the joined table
+	tx := b.reader()
+	for sql, operators := range map[string][]joinOperator{
+		"SELECT * FROM 'orders' JOIN 'people' ON people.id = orders.person":                                                {indexNestedLoopJoin},
+		"SELECT * FROM 'people' JOIN 'orders' ON person = people.id":                                                       {indexNestedLoopJoin},
+		"SELECT * FROM 'orders' JOIN 'items' ON item = items.name":                                                         {hashJoin},
+		"SELECT * FROM 'people' JOIN 'orders' ON qty > people.id":                                                          {nestedLoopJoin},
+		"SELECT * FROM 'people' JOIN 'orders' ON qty = people.id":                                                          {hashJoin},
+		"SELECT * FROM 'orders' AS o JOIN 'items' AS i ON o.qty > 1 JOIN 'people' AS p ON p.id = o.person AND i.price = 4": {nestedLoopJoin, indexNestedLoopJoin},
+	} {
+		q := mustParse(t, sql)
+		scope, err := newJoinScope(q, tx.table)
+		require.NoError(t, err)
+		q, err = resolveJoin(q, scope)
+		require.NoError(t, err, sql)
+		plan, err := tx.newJoinPlan(q, scope)
+		require.NoError(t, err)
+		for i, step := range plan.steps {
+			require.Equal(t, operators[i], step.operator, sql)
+		}
+	}
+
+	for sql, msg := range map[string]string{
+		"SELECT name FROM 'people' JOIN 'items' ON price > 1":                       "SELECT: column name is ambiguous",
+		"SELECT x.name FROM 'people' JOIN 'items' ON price > 1":                     "SELECT: table not in query: x",
+		"SELECT people.qty FROM 'people' JOIN 'items' ON price > 1":                 "SELECT: column not in table people: qty",
+		"SELECT name FROM 'people' JOIN 'people' ON id = id":                        "table name people used more than once, give it an alias",
+		"SELECT name FROM 'people' JOIN 'missing' ON id = id":                       "Table does not exist",
+		"SELECT p.id FROM 'people' AS p JOIN 'orders' ON p.id = i.price":            "ON: table not in query: i",
+		"SELECT p.id FROM 'people' AS p JOIN 'orders' ON p.name = qty":              "ON: cannot compare VARCHAR column p.name with INT column orders.qty",
+		"SELECT p.id FROM 'people' AS p JOIN 'orders' ON p.id = 1 WHERE height > 1": "WHERE: column not in any table: height",
+	} {
+		_, err := b.Select(mustParse(t, sql))
+		require.ErrorContains(t, err, msg, sql)
+	}
+}
+
+func TestStreamingRows(t *testing.T) {
+	dir := t.TempDir()
+	b := CreateNewDatabase(dir)
+	require.NoError(t, b.CreateTable(mustParse(t, "CREATE TABLE 'nums' (id int Primary Key, n int, label char(200))")))
+	require.NoError(t, b.CreateTable(mustParse(t, "CREATE TABLE 'other' (id int Primary Key)")))
+	values := []string{}
+	for i := 1; i <= 100; i++ {
+		values = append(values, fmt.Sprintf("(%d,%d,'l%d')", i, 100-i, i))
+	}
+	_, err := b.Insert(mustParse(t, "INSERT INTO 'nums' (id,n,label) VALUES "+strings.Join(values, ",")))
+	require.NoError(t, err)
+	dest := make([]driver.Value, 1)
+	pinned := func() int32 {
+		pins := int32(0)
+		for _, slot := range b.bufferPool.allpools["nums"].slots {
+			pins += slot.pincount.Load()
+		}
+		return pins
+	}
+
+	//commits go through while rows are read, the rows keep the data committed when they were selected
+	rows, err := b.Select(mustParse(t, "SELECT id, n FROM 'nums'"))
+	require.NoError(t, err)
+	pair := make([]driver.Value, 2)
+	require.NoError(t, rows.Next(pair))
+	require.Equal(t, []driver.Value{int64(1), int64(99)}, pair)
+	require.Zero(t, pinned(), "pages are only pinned while read")
+	_, err = b.Insert(mustParse(t, "INSERT INTO 'other' (id) VALUES (1)"))
+	require.NoError(t, err)
+	require.NoError(t, rows.Next(pair))
+	require.Equal(t, []driver.Value{int64(2), int64(98)}, pair)
+	_, err = b.Update(mustParse(t, "UPDATE 'nums' SET n = 7 WHERE id = 100"))
+	require.NoError(t, err)
+	_, err = b.Insert(mustParse(t, "INSERT INTO 'nums' (id,n,label) VALUES (101,-1,'l101')"))
+	require.NoError(t, err)
+	require.Zero(t, pinned())
+	for i := int64(3); i <= 100; i++ {
+		require.NoError(t, rows.Next(pair))
+		require.Equal(t, []driver.Value{i, 100 - i}, pair, "rows read after the commit are the ones committed before it")
+	}
+	require.Equal(t, io.EOF, rows.Next(pair))
+	require.Equal(t, io.EOF, rows.Next(pair))
+	require.NoError(t, rows.Close())
+	require.Empty(t, b.readers, "rows are forgotten once read")
+	_, err = b.Delete(mustParse(t, "DELETE FROM 'nums' WHERE id = 101"))
+	require.NoError(t, err)
+
+	//rows of a transaction are read whole before the transaction changes their pages
+	tx := begin(t, b)
+	rows, err = tx.Select(mustParse(t, "SELECT id FROM 'nums'"))
+	require.NoError(t, err)
+	other, err := tx.Select(mustParse(t, "SELECT id FROM 'other'"))
+	require.NoError(t, err)
+	for i := int64(1); i <= 3; i++ {
+		require.NoError(t, rows.Next(dest))
+		require.Equal(t, i, dest[0])
+	}
+	_, err = tx.Delete(mustParse(t, "DELETE FROM 'nums' WHERE id > 10"))
+	require.NoError(t, err)
+	require.Len(t, tx.readers, 1, "rows of other tables keep streaming")
+	for i := int64(4); i <= 100; i++ {
+		require.NoError(t, rows.Next(dest))
+		require.Equal(t, i, dest[0])
+	}
+	require.Equal(t, io.EOF, rows.Next(dest))
+	require.NoError(t, other.Close())
+	require.Empty(t, tx.readers)
+	require.NoError(t, tx.Rollback())
+
+	//a dropped table is read whole before its file is removed
+	rows, err = b.Select(mustParse(t, "SELECT id FROM 'other'"))
+	require.NoError(t, err)
+	require.NoError(t, b.DropTable(mustParse(t, "DROP TABLE 'other'")))
+	require.NoError(t, rows.Next(dest))
+	require.Equal(t, int64(1), dest[0])
+	require.Equal(t, io.EOF, rows.Next(dest))
+
+	//closed rows read no more pages so the corrupted last leaf goes unnoticed
+	_, leaf, err := newBtree(b.reader(), &b.tables[0]).descend(nil)
+	require.NoError(t, err)
+	for leaf.next() != 0 {
+		leaf, err = newBtree(b.reader(), &b.tables[0]).readNode(leaf.next())
+		require.NoError(t, err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "nums.db"), os.O_WRONLY, 0700)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("x"), int64(leaf.id)*PAGESIZE+PAGESIZE-1)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	rows, err = b.Select(mustParse(t, "SELECT id FROM 'nums' WHERE n > 10"))
+	require.NoError(t, err)
+	for i := int64(1); i <= 3; i++ {
+		require.NoError(t, rows.Next(dest))
+		require.Equal(t, i, dest[0])
+	}
+	require.NoError(t, rows.Close())
+	rows, err = b.Select(mustParse(t, "SELECT id FROM 'nums' WHERE n > 10"))
+	require.NoError(t, err)
+	for err == nil {
+		err = rows.Next(dest)
+	}
+	require.ErrorContains(t, err, fmt.Sprintf("page %d has been corrupted", leaf.id))
+	require.NoError(t, rows.Close())
+
+	//closing sorted rows before the end removes the spilled runs
+	b.SetSortMemory(1)
+	rows, err = b.Select(mustParse(t, "SELECT id FROM 'nums' WHERE id < 50 ORDER BY n"))
+	require.NoError(t, err)
+	require.NoError(t, rows.Next(dest))
+	require.Equal(t, int64(49), dest[0])
+	runs, err := filepath.Glob(filepath.Join(dir, "sort-*"))
+	require.NoError(t, err)
+	require.NotEmpty(t, runs)
+	require.NoError(t, rows.Close())
+	runs, err = filepath.Glob(filepath.Join(dir, "sort-*"))
+	require.NoError(t, err)
+	require.Empty(t, runs)
+}
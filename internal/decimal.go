@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+/*
+DECIMAL(precision, scale) cells hold the value times 10^scale as a 16 byte little endian two's complement integer
+followed by the scale (1 byte) so cells of columns with different scales still compare exactly
+up to 38 digits are kept which always fits the 16 bytes
+*/
+const (
+	decimalSize         = 17
+	maxDecimalPrecision = 38
+)
+
+var twoTo128 = new(big.Int).Lsh(big.NewInt(1), 128)
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// parseDecimal reads a decimal literal like -12.50 or 1.5e3 exactly as an unscaled integer and its scale
+func parseDecimal(val string) (*big.Int, int, error) {
+	invalid := fmt.Errorf("invalid decimal: %s", val)
+	s := val
+	exponent := 0
+	if i := strings.IndexAny(s, "eE"); i != -1 {
+		n, err := strconv.Atoi(s[i+1:])
+		if err != nil || n > maxDecimalPrecision || n < -255 {
+			return nil, 0, invalid
+		}
+		s, exponent = s[:i], n
+	}
+	sign := ""
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		sign, s = s[:1], s[1:]
+	}
+	whole, fraction, _ := strings.Cut(s, ".")
+	digits := whole + fraction
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return nil, 0, invalid
+	}
+	unscaled, ok := new(big.Int).SetString(sign+digits, 10)
+	if !ok {
+		return nil, 0, invalid
+	}
+	scale := len(fraction) - exponent
+	if scale < 0 {
+		unscaled.Mul(unscaled, pow10(-scale))
+		scale = 0
+	}
+	if scale > 255 {
+		return nil, 0, invalid
+	}
+	return unscaled, scale, nil
+}
+
+// rescale changes the scale of an unscaled value rounding half away from zero when digits are dropped
+func rescale(unscaled *big.Int, from, to int) *big.Int {
+	if to >= from {
+		return new(big.Int).Mul(unscaled, pow10(to-from))
+	}
+	divisor := pow10(from - to)
+	q, r := new(big.Int).QuoRem(unscaled, divisor, new(big.Int))
+	twice := new(big.Int).Abs(r)
+	if twice.Lsh(twice, 1).Cmp(divisor) >= 0 {
+		q.Add(q, big.NewInt(int64(unscaled.Sign())))
+	}
+	return q
+}
+
+// decimal value of a literal for a DECIMAL(precision, scale) column
+func encodeDecimal(val string, precision, scale int) (Cell, error) {
+	unscaled, from, err := parseDecimal(val)
+	if err != nil {
+		return nil, err
+	}
+	unscaled = rescale(unscaled, from, scale)
+	if new(big.Int).Abs(unscaled).Cmp(pow10(precision)) >= 0 {
+		return nil, fmt.Errorf("value %s out of range for DECIMAL(%d,%d)", val, precision, scale)
+	}
+	return decimalCell(unscaled, scale), nil
+}
+
+// literal compared with a DECIMAL column keeps all of its digits
+func encodeDecimalLiteral(val string) (Cell, error) {
+	unscaled, scale, err := parseDecimal(val)
+	if err != nil {
+		return nil, err
+	}
+	if new(big.Int).Abs(unscaled).Cmp(pow10(maxDecimalPrecision)) >= 0 {
+		return nil, fmt.Errorf("decimal %s has more than %d digits", val, maxDecimalPrecision)
+	}
+	return decimalCell(unscaled, scale), nil
+}
+
+func decimalCell(unscaled *big.Int, scale int) Cell {
+	n := unscaled
+	if n.Sign() < 0 {
+		n = new(big.Int).Add(n, twoTo128)
+	}
+	b := make(Cell, decimalSize)
+	n.FillBytes(b[:16])
+	for i, j := 0, 15; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	b[16] = byte(scale)
+	return b
+}
+
+// AsDecimal returns the unscaled value and scale of a DECIMAL cell
+func (c *Cell) AsDecimal() (*big.Int, int) {
+	be := make([]byte, 16)
+	for i := range be {
+		be[i] = (*c)[15-i]
+	}
+	n := new(big.Int).SetBytes(be)
+	if be[0]&0x80 != 0 {
+		n.Sub(n, twoTo128)
+	}
+	return n, int((*c)[16])
+}
+
+// AsDecimalString formats a DECIMAL cell with all the digits of its scale, like 12.50
+func (c *Cell) AsDecimalString() string {
+	unscaled, scale := c.AsDecimal()
+	digits := new(big.Int).Abs(unscaled).String()
+	if scale > 0 {
+		if len(digits) <= scale {
+			digits = strings.Repeat("0", scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+	}
+	if unscaled.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+func compareDecimals(a *big.Int, ascale int, b *big.Int, bscale int) int {
+	if ascale < bscale {
+		a = rescale(a, ascale, bscale)
+	} else if bscale < ascale {
+		b = rescale(b, bscale, ascale)
+	}
+	return a.Cmp(b)
+}
+
+// unscaled value and scale of an integer or DECIMAL cell
+func cellAsDecimal(typ uint8, c Cell) (*big.Int, int) {
+	switch {
+	case isUnsigned(typ):
+		return new(big.Int).SetUint64(c.AsUnsigned()), 0
+	case isInteger(typ):
+		return big.NewInt(c.AsSigned()), 0
+	}
+	return c.AsDecimal()
+}
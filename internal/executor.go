@@ -0,0 +1,197 @@
+package internal
+
+import (
+	"errors"
+	"io"
+)
+
+/*
+SELECT runs as a tree of operators pulled one row at a time by Rows.Next, scans at the leaves of the tree
+read the table B+trees one leaf at a time so a result is never held whole and reading stops with the rows asked for
+operators below the projection pass rows as stored in the table, or combined rows for a join, the ones above pass result cells
+sorting and aggregation read all the rows of their input on their first pull before returning any
+*/
+
+// rowIterator returns stored rows one at a time, next returns io.EOF after the last one
+// a row is only valid until the following call to next
+type rowIterator interface {
+	next() ([]byte, error)
+	close() error
+}
+
+// resultIterator returns the cells of result rows one at a time, next returns io.EOF after the last one
+type resultIterator interface {
+	next() ([]Cell, error)
+	close() error
+}
+
+// calls fn with every row of the iterator and closes it
+func forEachRow(it rowIterator, fn func(row []byte) error) error {
+	for {
+		row, err := it.next()
+		if err == io.EOF {
+			return it.close()
+		}
+		if err == nil {
+			err = fn(row)
+		}
+		if err != nil {
+			it.close()
+			return err
+		}
+	}
+}
+
+// filterRows returns the rows of its input satisfying the filter
+type filterRows struct {
+	input  rowIterator
+	filter *rowFilter
+}
+
+func (f *filterRows) next() ([]byte, error) {
+	for {
+		row, err := f.input.next()
+		if err != nil || f.filter.match(row) {
+			return row, err
+		}
+	}
+}
+
+func (f *filterRows) close() error {
+	return f.input.close()
+}
+
+// sliceRows returns rows already read
+type sliceRows [][]byte
+
+func (s *sliceRows) next() ([]byte, error) {
+	if len(*s) == 0 {
+		return nil, io.EOF
+	}
+	row := (*s)[0]
+	*s = (*s)[1:]
+	return row, nil
+}
+
+func (s *sliceRows) close() error {
+	*s = nil
+	return nil
+}
+
+// projectRows copies the cells of the requested columns out of the rows of its input
+type projectRows struct {
+	input   rowIterator
+	t       *Table
+	columns []Column
+}
+
+func (p *projectRows) next() ([]Cell, error) {
+	row, err := p.input.next()
+	if err != nil {
+		return nil, err
+	}
+	rowbitset := p.t.newRowBitSet()
+	rowbitset.fromBytes(row[:rowbitset.Size()])
+	cells := make([]Cell, len(p.columns))
+	for k, col := range p.columns {
+		if !rowbitset.hasBit(col.columnIndex) {
+			cells[k] = append(Cell{}, p.t.cellAt(row, col)...)
+		}
+	}
+	return cells, nil
+}
+
+func (p *projectRows) close() error {
+	return p.input.close()
+}
+
+// sortRows reads every row of its input on its first pull and returns them in the order of the keys
+type sortRows struct {
+	input  resultIterator
+	sorter *rowSorter
+	width  int //cells of the rows, hidden columns included
+	sorted *sortedRows
+}
+
+func (s *sortRows) next() ([]Cell, error) {
+	if s.sorted == nil {
+		for {
+			row, err := s.input.next()
+			if err == io.EOF {
+				break
+			}
+			if err == nil {
+				err = s.sorter.add(row)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		//the input is done with, its pages are released before the sorted rows are read
+		if err := s.closeInput(); err != nil {
+			return nil, err
+		}
+		sorted, err := s.sorter.sorted(s.width)
+		if err != nil {
+			return nil, err
+		}
+		s.sorted = sorted
+	}
+	return s.sorted.next()
+}
+
+// close removes the runs spilled by the sorter whether they were read or not
+func (s *sortRows) close() error {
+	err := s.closeInput()
+	if s.sorted != nil {
+		return errors.Join(err, s.sorted.close())
+	}
+	return errors.Join(err, s.sorter.discard())
+}
+
+// closeInput closes the input the first time only, next closes it once read and close may follow
+func (s *sortRows) closeInput() error {
+	if s.input == nil {
+		return nil
+	}
+	err := s.input.close()
+	s.input = nil
+	return err
+}
+
+// limitRows skips the OFFSET first rows of its input and returns at most LIMIT rows, never pulling the ones after
+type limitRows struct {
+	input    resultIterator
+	offset   uint64
+	limit    *uint64
+	returned uint64
+}
+
+func (l *limitRows) next() ([]Cell, error) {
+	if l.limit != nil && l.returned == *l.limit {
+		return nil, io.EOF
+	}
+	for ; l.offset > 0; l.offset-- {
+		if _, err := l.input.next(); err != nil {
+			return nil, err
+		}
+	}
+	row, err := l.input.next()
+	if err != nil {
+		return nil, err
+	}
+	l.returned++
+	return row, nil
+}
+
+func (l *limitRows) close() error {
+	return l.input.close()
+}
+
+// orders the rows of input by the keys of width cells and applies OFFSET and LIMIT after
+func (tx *Transaction) orderAndLimit(q Query, input resultIterator, keys []sortKey, width int) resultIterator {
+	if len(keys) > 0 {
+		input = &sortRows{input: input, sorter: newRowSorter(tx.b.dir, tx.b.sortMemory, keys), width: width}
+	}
+	return &limitRows{input: input, offset: q.Offset, limit: q.Limit}
+}
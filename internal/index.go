@@ -0,0 +1,454 @@
+package internal
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+Secondary index stored as a B+tree in its own file <table>.<index>.idx.db
+an entry is every indexed cell preceded by a byte set to 1 when the cell is not null,
+followed by the primary key of the row so entries are unique and lead back to the row
+nulls sort before every value and entries are compared column by column so a prefix of an entry can be searched
+VARCHAR cells and the primary key are zero padded to the size of their column so every entry has the same size
+*/
+type Index struct {
+	Name      string
+	Table     string
+	Columns   []string
+	Unique    bool
+	treePages //dynamic at runtime
+}
+
+func (idx *Index) file() string {
+	return fmt.Sprintf("%s.%s.idx", idx.Table, idx.Name)
+}
+
+func (idx *Index) toBytes() []byte {
+	buf := make([]byte, 0)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(idx.Name)))
+	buf = append(buf, idx.Name...)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(idx.Table)))
+	buf = append(buf, idx.Table...)
+	if idx.Unique {
+		buf = append(buf, 1)
+	} else {
+		buf = append(buf, 0)
+	}
+	buf = append(buf, byte(len(idx.Columns)))
+	for _, col := range idx.Columns {
+		buf = append(buf, byte(len(col)))
+		buf = append(buf, col...)
+	}
+	return buf
+}
+
+func indexFromBytes(buf []byte) Index {
+	idx := Index{}
+	byteIndex := 0
+	nameSize := int(binary.LittleEndian.Uint16(buf[byteIndex : byteIndex+2]))
+	byteIndex += 2
+	idx.Name = string(buf[byteIndex : byteIndex+nameSize])
+	byteIndex += nameSize
+	tableSize := int(binary.LittleEndian.Uint16(buf[byteIndex : byteIndex+2]))
+	byteIndex += 2
+	idx.Table = string(buf[byteIndex : byteIndex+tableSize])
+	byteIndex += tableSize
+	idx.Unique = buf[byteIndex] == 1
+	byteIndex += 1
+	columns := int(buf[byteIndex])
+	byteIndex += 1
+	for i := 0; i < columns; i++ {
+		colSize := int(buf[byteIndex])
+		byteIndex += 1
+		idx.Columns = append(idx.Columns, string(buf[byteIndex:byteIndex+colSize]))
+		byteIndex += colSize
+	}
+	return idx
+}
+
+// indexed columns of the table in index order
+func (idx *Index) columns(t *Table) []Column {
+	cols := make([]Column, 0, len(idx.Columns))
+	for _, name := range idx.Columns {
+		col, _ := t.getColumn(name)
+		cols = append(cols, col)
+	}
+	return cols
+}
+
+func newIndexBtree(tx *Transaction, t *Table, idx *Index) *btree {
+	cols := idx.columns(t)
+	primary, _ := t.primaryColumn()
+	keysize := int(primary.columnSize)
+	for _, col := range cols {
+		keysize += 1 + int(col.columnSize)
+	}
+	return &btree{
+		tx:       tx,
+		file:     idx.file(),
+		pages:    &idx.treePages,
+		keyOf:    func(entry []byte) Cell { return Cell(entry) },
+		keysize:  keysize,
+		prefixes: true,
+		compareKeys: func(a, b Cell) int {
+			for _, col := range cols {
+				width := 1 + int(col.columnSize)
+				if len(a) < width || len(b) < width {
+					return 0 //one side is a prefix of the other
+				}
+				if a[0] != b[0] {
+					return int(a[0]) - int(b[0])
+				}
+				if a[0] == 1 {
+					if cmp := compareCells(col.columnType, a[1:width], col.columnType, b[1:width]); cmp != 0 {
+						return cmp
+					}
+				}
+				a, b = a[width:], b[width:]
+			}
+			if len(a) == 0 || len(b) == 0 {
+				return 0
+			}
+			return compareCells(primary.columnType, a, primary.columnType, b)
+		},
+		duplicate: fmt.Errorf("duplicate entry in index %s", idx.Name),
+	}
+}
+
+// entry of a row in the index, without the primary key when prefix is set
+func (idx *Index) entry(t *Table, row []byte, prefix bool) []byte {
+	rowbitset := t.newRowBitSet()
+	rowbitset.fromBytes(row[:rowbitset.Size()])
+	entry := make([]byte, 0)
+	for _, col := range idx.columns(t) {
+		if rowbitset.hasBit(col.columnIndex) {
+			entry = append(entry, 0)
+			entry = append(entry, make([]byte, col.columnSize)...)
+			continue
+		}
+		entry = appendPadded(append(entry, 1), t.cellAt(row, col), col)
+	}
+	if !prefix {
+		primary, _ := t.primaryColumn()
+		entry = appendPadded(entry, t.cellAt(row, primary), primary)
+	}
+	return entry
+}
+
+func appendPadded(entry []byte, cell Cell, col Column) []byte {
+	entry = append(entry, cell...)
+	return append(entry, make([]byte, int(col.columnSize)-len(cell))...)
+}
+
+// primary key at the end of an entry as stored in the rows of the table
+func primaryOf(t *Table, entry []byte) Cell {
+	primary, _ := t.primaryColumn()
+	key := Cell(entry[len(entry)-int(primary.columnSize):])
+	if primary.isVariable() {
+		key = Cell(strings.TrimRight(string(key), "\x00"))
+	}
+	return key
+}
+
+func (idx *Index) violation() error {
+	return &ConstraintError{Kind: UniqueConstraint, Table: idx.Table, Column: strings.Join(idx.Columns, ",")}
+}
+
+// primary keys of the entries starting with prefix
+func (tx *Transaction) indexedKeys(t *Table, idx *Index, prefix []byte) ([]string, error) {
+	bt := newIndexBtree(tx, t, idx)
+	keys := make([]string, 0)
+	err := bt.scan(prefix, prefix, func(entry []byte) error {
+		keys = append(keys, string(primaryOf(t, entry)))
+		return nil
+	})
+	return keys, err
+}
+
+// reports whether a unique index has entries with the same values as a row whose primary key is not in allowed
+// entries with a null are never equal to each other
+func (tx *Transaction) uniqueIndexTaken(t *Table, idx *Index, row []byte, allowed map[string]bool) (bool, error) {
+	if !idx.Unique || hasNullCell(t, idx, row) {
+		return false, nil
+	}
+	keys, err := tx.indexedKeys(t, idx, idx.entry(t, row, true))
+	if err != nil {
+		return false, err
+	}
+	for _, key := range keys {
+		if !allowed[key] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func hasNullCell(t *Table, idx *Index, row []byte) bool {
+	rowbitset := t.newRowBitSet()
+	rowbitset.fromBytes(row[:rowbitset.Size()])
+	for _, col := range idx.columns(t) {
+		if rowbitset.hasBit(col.columnIndex) {
+			return true
+		}
+	}
+	return false
+}
+
+// checks rows about to be written against the unique secondary indexes and each other
+// primary keys in replaced belong to rows the statement rewrites so their current entries do not count
+func (tx *Transaction) checkUniqueIndexes(t *Table, rows [][]byte, replaced map[string]bool) error {
+	for i := range t.indexes {
+		idx := &t.indexes[i]
+		if !idx.Unique {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, row := range rows {
+			if hasNullCell(t, idx, row) {
+				continue
+			}
+			prefix := string(idx.entry(t, row, true))
+			taken, err := tx.uniqueIndexTaken(t, idx, row, replaced)
+			if err != nil {
+				return err
+			}
+			if taken || seen[prefix] {
+				return idx.violation()
+			}
+			seen[prefix] = true
+		}
+	}
+	return nil
+}
+
+func (tx *Transaction) insertIndexEntries(t *Table, row []byte) error {
+	for i := range t.indexes {
+		if err := newIndexBtree(tx, t, &t.indexes[i]).insert(t.indexes[i].entry(t, row, false)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *Transaction) deleteIndexEntries(t *Table, row []byte) error {
+	for i := range t.indexes {
+		if _, err := newIndexBtree(tx, t, &t.indexes[i]).delete(t.indexes[i].entry(t, row, false)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanRows calls fn with every row that may satisfy the filter, fn must not modify the table
+func (tx *Transaction) scanRows(t *Table, filter *rowFilter, fn func(row []byte) error) error {
+	return forEachRow(tx.newTableScan(t, filter), fn)
+}
+
+// tableScan reads the rows that may satisfy a filter from the part of the table B+tree
+// or of a secondary index allowed by the WHERE clause, one leaf at a time
+// values stored in overflow pages are loaded back into the rows
+type tableScan struct {
+	tx     *Transaction
+	t      *Table
+	table  *btree
+	cursor *treeCursor
+	index  *Index //index read by the cursor, nil when it reads the table B+tree
+}
+
+func (tx *Transaction) newTableScan(t *Table, filter *rowFilter) *tableScan {
+	s := &tableScan{tx: tx, t: t, table: newBtree(tx, t)}
+	from, to := filter.keyRange(s.table.key)
+	if from != nil || to != nil {
+		s.cursor = s.table.cursor(from, to)
+		return s
+	}
+	idx, from, to := filter.indexRange(t)
+	if idx == nil {
+		s.cursor = s.table.cursor(nil, nil)
+		return s
+	}
+	s.index = idx
+	s.cursor = newIndexBtree(tx, t, idx).cursor(from, to)
+	return s
+}
+
+func (s *tableScan) next() ([]byte, error) {
+	row, err := s.cursor.next()
+	if err != nil {
+		return nil, err
+	}
+	if s.index != nil {
+		entry := row
+		var ok bool
+		if row, ok, err = s.table.get(primaryOf(s.t, entry)); err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("index %s points to a missing row", s.index.Name)
+		}
+	}
+	return s.tx.loadRow(s.t, row)
+}
+
+func (s *tableScan) close() error {
+	return s.cursor.close()
+}
+
+// creates a table or index file holding an empty B+tree
+func (b *Backend) createTreeFile(name string) error {
+	f, err := os.Create(filepath.Join(b.dir, fmt.Sprintf("%s.db", name)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buf := [PAGESIZE]byte{}
+	binary.LittleEndian.PutUint64(buf[0:8], 0)  //pagenum
+	binary.LittleEndian.PutUint16(buf[8:10], 0) //rownums
+	buf[nodeTypeOffset] = nodeLeaf              //empty root of the B+tree
+	checksum := md5.Sum(buf[26:])
+	copy(buf[10:26], checksum[:])
+	_, err = f.Write(buf[:])
+	return err
+}
+
+func (b *Backend) findIndex(name string) (tableIndex int, indexIndex int, ok bool) {
+	for i := range b.tables {
+		for j := range b.tables[i].indexes {
+			if b.tables[i].indexes[j].Name == name {
+				return i, j, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// CreateIndex builds the index from the rows already in the table in a transaction of its own
+func (b *Backend) CreateIndex(q Query) error {
+	tx, err := b.Begin()
+	if err != nil {
+		return err
+	}
+	idx, err := tx.createIndex(q)
+	if err != nil {
+		if idx != nil {
+			b.bufferPool.RemovePool(idx.file())
+			os.Remove(filepath.Join(b.dir, fmt.Sprintf("%s.db", idx.file())))
+		}
+		return errors.Join(err, tx.Rollback())
+	}
+	//the index is only published once the catalog holds it, no other writer gets in before
+	tx.done = true
+	defer b.unlockWriter()
+	if err := tx.publish(true); err != nil {
+		b.bufferPool.RemovePool(idx.file())
+		os.Remove(filepath.Join(b.dir, fmt.Sprintf("%s.db", idx.file())))
+		return err
+	}
+	return nil
+}
+
+func (tx *Transaction) createIndex(q Query) (*Index, error) {
+	if _, _, exists := tx.b.findIndex(q.IndexName); exists {
+		return nil, errors.New("Index already exist")
+	}
+	t, err := tx.writableTable(q.TableName)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	missing := make([]string, 0)
+	for _, field := range q.Fields {
+		col, ok := t.getColumn(field)
+		if !ok {
+			missing = append(missing, field)
+		}
+		if col.columnType == TEXT || col.columnType == BLOB {
+			return nil, fmt.Errorf("CREATE INDEX: cannot index %s column %s", typeName(col.columnType), field)
+		}
+		if seen[field] {
+			return nil, fmt.Errorf("CREATE INDEX: column indexed twice: %s", field)
+		}
+		seen[field] = true
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("Columns not in table: %s", strings.Join(missing, " "))
+	}
+
+	t.indexes = append(t.indexes, Index{Name: q.IndexName, Table: t.Name, Columns: q.Fields, Unique: q.Unique})
+	idx := &t.indexes[len(t.indexes)-1]
+	bt := newIndexBtree(tx, t, idx)
+	if bt.keysize > bt.maxRowSize() || bt.internalCapacity() < 2 {
+		return nil, errors.New("CREATE INDEX: indexed columns too large for a page")
+	}
+	if err := tx.b.createTreeFile(idx.file()); err != nil {
+		return nil, err
+	}
+	tx.b.bufferPool.NewPool(idx.file(), tx.b.dir)
+
+	rows := make([][]byte, 0)
+	all, _ := t.newRowFilter(nil)
+	err = tx.scanRows(t, all, func(row []byte) error {
+		rows = append(rows, append([]byte{}, row...))
+		return nil
+	})
+	if err != nil {
+		return idx, err
+	}
+	seenEntries := make(map[string]bool)
+	for _, row := range rows {
+		if idx.Unique && !hasNullCell(t, idx, row) {
+			prefix := string(idx.entry(t, row, true))
+			if seenEntries[prefix] {
+				return idx, idx.violation()
+			}
+			seenEntries[prefix] = true
+		}
+		if err := bt.insert(idx.entry(t, row, false)); err != nil {
+			return idx, err
+		}
+	}
+	return idx, nil
+}
+
+func (b *Backend) DropIndex(q Query) error {
+	if err := b.lockWriter(context.Background()); err != nil {
+		return err
+	}
+	defer b.unlockWriter()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	i, j, ok := b.findIndex(q.IndexName)
+	if !ok {
+		if q.IfExists {
+			return nil
+		}
+		return errors.New("Index does not exist")
+	}
+	idx := b.tables[i].indexes[j]
+	if idx.backsUnique(&b.tables[i]) {
+		return fmt.Errorf("index %s enforces UNIQUE on column %s and cannot be dropped", idx.Name, idx.Columns[0])
+	}
+	tables := append([]Table{}, b.tables...)
+	tables[i].indexes = append(append([]Index{}, tables[i].indexes[:j]...), tables[i].indexes[j+1:]...)
+	if err := b.saveCatalog(tables); err != nil {
+		return err
+	}
+	b.detachReaders(map[string]bool{idx.Table: true})
+	return b.removeTreeFile(idx.file())
+}
+
+func (b *Backend) removeTreeFile(name string) error {
+	if err := b.bufferPool.RemovePool(name); err != nil {
+		return err
+	}
+	return os.Remove(filepath.Join(b.dir, fmt.Sprintf("%s.db", name)))
+}
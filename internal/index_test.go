@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newIndexedDatabase(t *testing.T, rows int, statements ...string) *Backend {
+	b := newTestDatabase(t, "CREATE TABLE 'people' (id int Primary Key, city char(16), age int, name char(16))")
+	values := make([]string, 0)
+	for i := 1; i <= rows; i++ {
+		values = append(values, fmt.Sprintf("('%d','c%d','%d','n%d')", i, i%10, i%50, i))
+	}
+	_, err := b.Insert(mustParse(t, "INSERT INTO 'people' (id,city,age,name) VALUES "+strings.Join(values, ",")))
+	require.NoError(t, err)
+	for _, sql := range statements {
+		require.NoError(t, b.CreateIndex(mustParse(t, sql)))
+	}
+	return b
+}
+
+// checks every index of the table holds exactly one entry per row
+func checkIndexes(t *testing.T, b *Backend, table string) {
+	t.Helper()
+	tx := b.reader()
+	tab, ok := tx.table(table)
+	require.True(t, ok)
+	rows := len(checkTree(t, newBtree(tx, &tab)))
+	for i := range tab.indexes {
+		require.Len(t, checkTree(t, newIndexBtree(tx, &tab, &tab.indexes[i])), rows, "index %s", tab.indexes[i].Name)
+	}
+}
+
+func TestIndexSelect(t *testing.T) {
+	b := newIndexedDatabase(t, 2000,
+		"CREATE INDEX city_age ON 'people' (city, age)",
+		"CREATE INDEX by_name ON 'people' (name)",
+	)
+	checkIndexes(t, b, "people")
+
+	table := b.tables[0]
+	filter, err := table.newRowFilter(mustParse(t, "SELECT id FROM 'people' WHERE city = 'c3' AND age > '20'").Where)
+	require.NoError(t, err)
+	idx, from, to := filter.indexRange(&table)
+	require.Equal(t, "city_age", idx.Name)
+	require.Len(t, from, 1+16+1+8, "city and age bound the start")
+	require.Len(t, to, 1+16, "only the city bounds the end")
+
+	filter, err = table.newRowFilter(mustParse(t, "SELECT id FROM 'people' WHERE city = 'c3' OR age > '20'").Where)
+	require.NoError(t, err)
+	idx, _, _ = filter.indexRange(&table)
+	require.Nil(t, idx, "OR cannot use an index")
+
+	//results through an index match the full scan
+	for _, where := range []string{
+		"city = 'c3'",
+		"city = 'c3' AND age = '13'",
+		"city = 'c3' AND age > '20' AND age <= '40'",
+		"name = 'n1234'",
+		"name >= 'n1990' AND name < 'n1999'",
+		"city < 'c2'",
+	} {
+		got := selectAll(t, b, "SELECT id FROM 'people' WHERE "+where)
+		filter, err := table.newRowFilter(mustParse(t, "SELECT id FROM 'people' WHERE "+where).Where)
+		require.NoError(t, err)
+		expected := 0
+		err = newBtree(b.reader(), &table).scan(nil, nil, func(row []byte) error {
+			if filter.match(row) {
+				expected++
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.NotZero(t, expected, where)
+		require.Len(t, got, expected, where)
+	}
+	require.Equal(t, [][]driver.Value{{int64(1234)}}, selectAll(t, b, "SELECT id FROM 'people' WHERE name = 'n1234'"))
+}
+
+func TestIndexMaintenance(t *testing.T) {
+	b := newIndexedDatabase(t, 500, "CREATE INDEX by_city ON 'people' (city)")
+
+	_, err := b.Update(mustParse(t, "UPDATE 'people' SET city = 'moved' WHERE age < '10'"))
+	require.NoError(t, err)
+	_, err = b.Delete(mustParse(t, "DELETE FROM 'people' WHERE city = 'c5'"))
+	require.NoError(t, err)
+	_, err = b.Insert(mustParse(t, "INSERT INTO 'people' (city,age) VALUES ('moved','99')"))
+	require.NoError(t, err)
+	checkIndexes(t, b, "people")
+
+	require.Len(t, selectAll(t, b, "SELECT id FROM 'people' WHERE city = 'moved'"), 101)
+	require.Empty(t, selectAll(t, b, "SELECT id FROM 'people' WHERE city = 'c5'"))
+	require.Len(t, selectAll(t, b, "SELECT id FROM 'people' WHERE city = 'c1'"), 40)
+
+	//a rolled back transaction leaves the index untouched
+	tx := begin(t, b)
+	_, err = tx.Delete(mustParse(t, "DELETE FROM 'people' WHERE city = 'moved'"))
+	require.NoError(t, err)
+	require.Empty(t, selectRows(t, tx, "SELECT id FROM 'people' WHERE city = 'moved'"))
+	require.NoError(t, tx.Rollback())
+	require.Len(t, selectAll(t, b, "SELECT id FROM 'people' WHERE city = 'moved'"), 101)
+}
+
+func selectRows(t *testing.T, tx *Transaction, sql string) [][]Cell {
+	rows, err := tx.Select(mustParse(t, sql))
+	require.NoError(t, err)
+	return resultCells(t, rows)
+}
+
+func TestUniqueIndex(t *testing.T) {
+	b := newIndexedDatabase(t, 100, "CREATE UNIQUE INDEX by_name ON 'people' (name)")
+
+	var constraintErr *ConstraintError
+	_, err := b.Insert(mustParse(t, "INSERT INTO 'people' (name) VALUES ('n5')"))
+	require.ErrorAs(t, err, &constraintErr)
+	require.Equal(t, ConstraintError{Kind: UniqueConstraint, Table: "people", Column: "name"}, *constraintErr)
+	_, err = b.Insert(mustParse(t, "INSERT INTO 'people' (name) VALUES ('x'),('x')"))
+	require.ErrorAs(t, err, &constraintErr)
+	_, err = b.Update(mustParse(t, "UPDATE 'people' SET name = 'n5' WHERE id = '6'"))
+	require.ErrorAs(t, err, &constraintErr)
+	_, err = b.Update(mustParse(t, "UPDATE 'people' SET name = 'same' WHERE id <= '2'"))
+	require.ErrorAs(t, err, &constraintErr)
+	require.Len(t, selectAll(t, b, "SELECT id FROM 'people'"), 100, "rejected statements store nothing")
+	checkIndexes(t, b, "people")
+
+	//rows keep their own value, NULLs never collide
+	_, err = b.Update(mustParse(t, "UPDATE 'people' SET name = 'n5' WHERE id = '5'"))
+	require.NoError(t, err)
+	_, err = b.Insert(mustParse(t, "INSERT INTO 'people' (city) VALUES ('a'),('b')"))
+	require.NoError(t, err)
+	_, err = b.Delete(mustParse(t, "DELETE FROM 'people' WHERE id = '5'"))
+	require.NoError(t, err)
+	_, err = b.Insert(mustParse(t, "INSERT INTO 'people' (name) VALUES ('n5')"))
+	require.NoError(t, err, "deleted values are free")
+
+	//existing duplicates stop the index from being built
+	err = b.CreateIndex(mustParse(t, "CREATE UNIQUE INDEX by_city ON 'people' (city)"))
+	require.ErrorAs(t, err, &constraintErr)
+	require.Len(t, b.tables[0].indexes, 1)
+	require.NoFileExists(t, filepath.Join(b.dir, "people.by_city.idx.db"))
+	require.NoError(t, b.CreateIndex(mustParse(t, "CREATE UNIQUE INDEX by_city_age ON 'people' (city, age, name)")))
+}
+
+func TestIndexDDL(t *testing.T) {
+	b := newIndexedDatabase(t, 300, "CREATE INDEX by_city ON 'people' (city)")
+	require.FileExists(t, filepath.Join(b.dir, "people.by_city.idx.db"))
+
+	require.Error(t, b.CreateIndex(mustParse(t, "CREATE INDEX by_city ON 'people' (age)")), "name taken")
+	require.Error(t, b.CreateIndex(mustParse(t, "CREATE INDEX other ON 'people' (missing)")))
+	require.Error(t, b.CreateIndex(mustParse(t, "CREATE INDEX other ON 'missing' (city)")))
+	require.NoError(t, b.CreateIndex(mustParse(t, "CREATE INDEX by_age ON 'people' (age)")))
+
+	//definitions and trees survive a reopen
+	reopened, err := OpenExistingDatabase(b.dir)
+	require.NoError(t, err)
+	require.Len(t, reopened.tables[0].indexes, 2)
+	require.Equal(t, b.tables[0].indexes[0].lastPage, reopened.tables[0].indexes[0].lastPage)
+	require.Len(t, selectAll(t, reopened, "SELECT id FROM 'people' WHERE age = '7'"), 6)
+	_, err = reopened.Insert(mustParse(t, "INSERT INTO 'people' (city,age) VALUES ('c1','7')"))
+	require.NoError(t, err)
+	checkIndexes(t, reopened, "people")
+
+	require.NoError(t, reopened.DropIndex(mustParse(t, "DROP INDEX by_age")))
+	require.NoFileExists(t, filepath.Join(b.dir, "people.by_age.idx.db"))
+	require.Error(t, reopened.DropIndex(mustParse(t, "DROP INDEX by_age")))
+	require.NoError(t, reopened.DropIndex(mustParse(t, "DROP INDEX IF EXISTS by_age")))
+	require.Len(t, selectAll(t, reopened, "SELECT id FROM 'people' WHERE age = '7'"), 7)
+
+	reopened, err = OpenExistingDatabase(b.dir)
+	require.NoError(t, err)
+	require.Len(t, reopened.tables[0].indexes, 1)
+	require.NoError(t, reopened.DropTable(mustParse(t, "DROP TABLE 'people'")))
+	entries, err := os.ReadDir(b.dir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		require.False(t, strings.HasPrefix(entry.Name(), "people"), entry.Name())
+	}
+}
@@ -0,0 +1,516 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+/*
+SELECT with JOIN reads combined rows of a table holding the columns of every joined table one after the other,
+each named after its table like p.name, so WHERE, GROUP BY and ORDER BY run on them as on the rows of a single table
+every row of the first table is joined with the tables after it in order, each JOIN picking its operator from ON
+index nested loop when ON compares the joined table by equality on its primary key or the first column of an index,
+the matching rows are then read through the B+tree for every row joined so far
+hash join when ON compares it by equality on another column of the same type, its rows are read once into a hash table
+nested loop scanning the whole joined table for every row joined so far otherwise
+a LEFT JOIN without any match keeps the row with the columns of the joined table null
+*/
+type joinOperator uint8
+
+const (
+	nestedLoopJoin joinOperator = iota
+	indexNestedLoopJoin
+	hashJoin
+)
+
+// a table of a SELECT and the name qualifying its columns, its alias or its own name
+type scopeTable struct {
+	table  Table
+	name   string
+	offset int //index of its first column in the combined rows
+}
+
+type joinScope []scopeTable
+
+func newJoinScope(q Query, table func(name string) (Table, bool)) (joinScope, error) {
+	scope := make(joinScope, 0, len(q.Joins)+1)
+	add := func(tableName, alias string) error {
+		t, ok := table(tableName)
+		if !ok {
+			return errors.New("Table does not exist")
+		}
+		name := tableName
+		if alias != "" {
+			name = alias
+		}
+		offset := 0
+		for _, st := range scope {
+			if st.name == name {
+				return fmt.Errorf("table name %s used more than once, give it an alias", name)
+			}
+			offset += len(st.table.Columns)
+		}
+		scope = append(scope, scopeTable{table: t, name: name, offset: offset})
+		return nil
+	}
+	if err := add(q.TableName, q.TableAlias); err != nil {
+		return nil, err
+	}
+	for _, join := range q.Joins {
+		if err := add(join.TableName, join.Alias); err != nil {
+			return nil, err
+		}
+	}
+	return scope, nil
+}
+
+// resolve returns the name of the column a field refers to in the combined rows
+// fields without table name must be in exactly one table, with a single table columns keep their own names
+func (s joinScope) resolve(field string) (string, error) {
+	found := ""
+	if qualifier, name, ok := strings.Cut(field, "."); ok {
+		for _, st := range s {
+			if st.name != qualifier {
+				continue
+			}
+			if _, ok := st.table.getColumn(name); !ok {
+				return "", fmt.Errorf("column not in table %s: %s", qualifier, name)
+			}
+			found = field
+		}
+		if found == "" {
+			return "", fmt.Errorf("table not in query: %s", qualifier)
+		}
+	} else {
+		for _, st := range s {
+			if _, ok := st.table.getColumn(field); !ok {
+				continue
+			}
+			if found != "" {
+				return "", fmt.Errorf("column %s is ambiguous", field)
+			}
+			found = st.name + "." + field
+		}
+		if found == "" {
+			return "", fmt.Errorf("column not in any table: %s", field)
+		}
+	}
+	if len(s) == 1 {
+		_, name, _ := strings.Cut(found, ".")
+		return name, nil
+	}
+	return found, nil
+}
+
+// table holding the combined rows, its columns are qualified by their table unless there is a single table
+func (s joinScope) combined() Table {
+	if len(s) == 1 {
+		return s[0].table
+	}
+	t := Table{Name: s[0].table.Name}
+	for _, st := range s {
+		for _, col := range st.table.Columns {
+			col.columnName = st.name + "." + col.columnName
+			col.columnConstraint = 0
+			t.Columns = append(t.Columns, col)
+		}
+	}
+	t.GenerateFields()
+	return t
+}
+
+// column of the combined rows a field refers to
+func (s joinScope) column(field string) (Column, error) {
+	name, err := s.resolve(field)
+	if err != nil {
+		return Column{}, err
+	}
+	t := s.combined()
+	col, _ := t.getColumn(name)
+	return col, nil
+}
+
+// resolveJoin returns a copy of the query with every field naming its column in the combined rows
+// fields keep the name they were written with in the result unless they have an alias
+// qualifiesColumns reports whether a clause names a column by its table like t.id, which also holds for a single table
+func (q *Query) qualifiesColumns() bool {
+	names := append([]string{}, q.Fields...)
+	names = append(names, q.GroupBy...)
+	for _, field := range q.OrderBy {
+		names = append(names, field.Field)
+	}
+	for _, aggregate := range q.Aggregates {
+		names = append(names, aggregate.Field)
+	}
+	for _, c := range append(q.Where.Conditions(), q.Having.Conditions()...) {
+		names = append(names, c.Operand1)
+		if c.Operand2IsField {
+			names = append(names, c.Operand2)
+		}
+	}
+	for _, name := range names {
+		if strings.Contains(name, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+func resolveJoin(q Query, scope joinScope) (Query, error) {
+	r := q.clone()
+	isResult := func(field string) bool {
+		if _, ok := q.Aggregates[field]; ok {
+			return true
+		}
+		return aliasedField(q, field) != field
+	}
+	//HAVING may also name aggregates and aliases of the select list
+	resolveExpression := func(clause string, e *Expression) error {
+		for _, leaf := range e.leaves() {
+			c := &leaf.Condition
+			var err error
+			if clause == "WHERE" || !isResult(c.Operand1) {
+				if c.Operand1, err = scope.resolve(c.Operand1); err != nil {
+					return fmt.Errorf("%s: %w", clause, err)
+				}
+			}
+			if c.Operand2IsField && (clause == "WHERE" || !isResult(c.Operand2)) {
+				if c.Operand2, err = scope.resolve(c.Operand2); err != nil {
+					return fmt.Errorf("%s: %w", clause, err)
+				}
+			}
+		}
+		return nil
+	}
+
+	r.Fields = make([]string, 0, len(q.Fields))
+	r.Aliases = make(map[string]string)
+	for field, alias := range q.Aliases {
+		if _, ok := q.Aggregates[field]; ok {
+			r.Aliases[field] = alias
+		}
+	}
+	for _, field := range q.Fields {
+		if _, ok := q.Aggregates[field]; ok || field == "*" {
+			r.Fields = append(r.Fields, field)
+			continue
+		}
+		if qualifier, ok := strings.CutSuffix(field, ".*"); ok {
+			found := false
+			for _, st := range scope {
+				if st.name != qualifier {
+					continue
+				}
+				found = true
+				for _, col := range st.table.Columns {
+					name, _ := scope.resolve(qualifier + "." + col.columnName)
+					r.Fields = append(r.Fields, name)
+				}
+			}
+			if !found {
+				return r, fmt.Errorf("SELECT: table not in query: %s", qualifier)
+			}
+			continue
+		}
+		name, err := scope.resolve(field)
+		if err != nil {
+			return r, fmt.Errorf("SELECT: %w", err)
+		}
+		r.Fields = append(r.Fields, name)
+		if alias, ok := q.Aliases[field]; ok {
+			r.Aliases[name] = alias
+		} else if name != field {
+			r.Aliases[name] = field
+		}
+	}
+	if err := resolveExpression("WHERE", r.Where); err != nil {
+		return r, err
+	}
+	if err := resolveExpression("HAVING", r.Having); err != nil {
+		return r, err
+	}
+	for i := range r.Joins {
+		//ON only sees the tables joined so far
+		on := scope[:i+2]
+		for _, leaf := range r.Joins[i].On.leaves() {
+			c := &leaf.Condition
+			var err error
+			if c.Operand1, err = on.resolve(c.Operand1); err != nil {
+				return r, fmt.Errorf("ON: %w", err)
+			}
+			if c.Operand2IsField {
+				if c.Operand2, err = on.resolve(c.Operand2); err != nil {
+					return r, fmt.Errorf("ON: %w", err)
+				}
+			}
+		}
+	}
+	r.GroupBy = nil
+	for _, field := range q.GroupBy {
+		name, err := scope.resolve(field)
+		if err != nil {
+			return r, fmt.Errorf("GROUP BY: %w", err)
+		}
+		r.GroupBy = append(r.GroupBy, name)
+	}
+	r.OrderBy = append([]OrderField(nil), q.OrderBy...)
+	for i, field := range r.OrderBy {
+		if isResult(field.Field) {
+			continue
+		}
+		name, err := scope.resolve(field.Field)
+		if err != nil {
+			return r, fmt.Errorf("ORDER BY: %w", err)
+		}
+		r.OrderBy[i].Field = name
+	}
+	if q.Aggregates != nil {
+		r.Aggregates = make(map[string]Aggregate, len(q.Aggregates))
+		for name, agg := range q.Aggregates {
+			if agg.Field != "*" {
+				field, err := scope.resolve(agg.Field)
+				if err != nil {
+					return r, fmt.Errorf("%s: %w", name, err)
+				}
+				agg.Field = field
+			}
+			r.Aggregates[name] = agg
+		}
+	}
+	return r, nil
+}
+
+// joinPlan reads the combined rows of the tables of a SELECT
+type joinPlan struct {
+	tx       *Transaction
+	scope    joinScope
+	combined Table
+	steps    []*joinStep
+}
+
+// a JOIN of a table to the combined rows of the tables before it
+type joinStep struct {
+	joinType JoinType
+	table    scopeTable
+	on       *rowFilter //bound to the combined rows
+	operator joinOperator
+	outer    Column //column of the combined rows compared with inner by index nested loop and hash joins
+	inner    Column //column of the joined table
+	hashed   map[string][][]byte
+}
+
+func (tx *Transaction) newJoinPlan(q Query, scope joinScope) (*joinPlan, error) {
+	p := &joinPlan{tx: tx, scope: scope, combined: scope.combined()}
+	for i, join := range q.Joins {
+		inner := scope[i+1]
+		on, err := p.combined.newClauseFilter("ON", join.On)
+		if err != nil {
+			return nil, err
+		}
+		step := &joinStep{joinType: join.Type, table: inner, on: on}
+		for _, c := range on.conjuncts() {
+			if !c.rightIsField || c.operator != Eq {
+				continue
+			}
+			outer, col := c.left, c.right
+			if outer.columnIndex >= inner.offset {
+				outer, col = col, outer
+			}
+			if outer.columnIndex >= inner.offset || col.columnIndex < inner.offset || !hashable(outer, col) {
+				continue
+			}
+			step.outer, step.inner = outer, inner.table.Columns[col.columnIndex-inner.offset]
+			step.operator = hashJoin
+			if indexed(&inner.table, step.inner) {
+				step.operator = indexNestedLoopJoin
+				break
+			}
+		}
+		p.steps = append(p.steps, step)
+	}
+	return p, nil
+}
+
+// cells of columns of the same type are equal exactly when their bytes are
+func hashable(a, b Column) bool {
+	if a.columnType != b.columnType || a.columnType == FLOAT {
+		return false
+	}
+	return (a.columnType != CHAR || a.columnSize == b.columnSize) && (a.columnType != DECIMAL || a.scale == b.scale)
+}
+
+// reports whether rows of the table can be looked up by the column through its B+tree or an index
+func indexed(t *Table, col Column) bool {
+	if primary, ok := t.primaryColumn(); ok && primary.columnIndex == col.columnIndex {
+		return true
+	}
+	for i := range t.indexes {
+		if t.indexes[i].columns(t)[0].columnIndex == col.columnIndex {
+			return true
+		}
+	}
+	return false
+}
+
+// rows returns the combined rows, they are filtered by the caller
+func (p *joinPlan) rows(_ *rowFilter) rowIterator {
+	first := p.scope[0]
+	all, _ := first.table.newRowFilter(nil)
+	var it rowIterator = &combineRows{p: p, input: p.tx.newTableScan(&first.table, all), cells: make([]Cell, len(p.combined.Columns))}
+	for _, step := range p.steps {
+		it = &joinRows{p: p, step: step, input: it, cells: make([]Cell, len(p.combined.Columns))}
+	}
+	return it
+}
+
+// combineRows turns the rows of the first table into combined rows, the columns of the joined tables are null
+type combineRows struct {
+	p     *joinPlan
+	input rowIterator
+	cells []Cell
+}
+
+func (c *combineRows) next() ([]byte, error) {
+	row, err := c.input.next()
+	if err != nil {
+		return nil, err
+	}
+	setCells(c.cells, c.p.scope[0], row)
+	return c.p.row(c.cells), nil
+}
+
+func (c *combineRows) close() error {
+	return c.input.close()
+}
+
+// joinRows joins every combined row of the tables before a step with the rows of the table of the step
+type joinRows struct {
+	p       *joinPlan
+	step    *joinStep
+	input   rowIterator
+	cells   []Cell      //combined row of the input being joined
+	inner   rowIterator //rows of the joined table that may match it, nil before the first input row
+	matched bool
+}
+
+func (j *joinRows) next() ([]byte, error) {
+	step := j.step
+	for {
+		if j.inner == nil {
+			outer, err := j.input.next()
+			if err != nil {
+				return nil, err
+			}
+			if err := j.open(outer); err != nil {
+				return nil, err
+			}
+		}
+		row, err := j.inner.next()
+		if err == nil {
+			setCells(j.cells, step.table, row)
+			combined := j.p.row(j.cells)
+			if !step.on.match(combined) {
+				continue
+			}
+			j.matched = true
+			return combined, nil
+		}
+		if err != io.EOF {
+			return nil, err
+		}
+		if err := j.inner.close(); err != nil {
+			return nil, err
+		}
+		j.inner = nil
+		if !j.matched && step.joinType == LeftJoin {
+			for i := range step.table.table.Columns {
+				j.cells[step.table.offset+i] = nil
+			}
+			return j.p.row(j.cells), nil
+		}
+	}
+}
+
+// starts reading the rows of the joined table for a combined row of the input
+func (j *joinRows) open(outer []byte) error {
+	step := j.step
+	rowbitset := j.p.combined.newRowBitSet()
+	rowbitset.fromBytes(outer[:rowbitset.Size()])
+	for i, col := range j.p.combined.Columns {
+		j.cells[i] = nil
+		if !rowbitset.hasBit(i) {
+			j.cells[i] = append(Cell{}, j.p.combined.cellAt(outer, col)...)
+		}
+	}
+	j.matched = false
+	key := j.cells[step.outer.columnIndex]
+	switch {
+	case step.operator == nestedLoopJoin:
+		all, _ := step.table.table.newRowFilter(nil)
+		j.inner = j.p.tx.newTableScan(&step.table.table, all)
+	case key == nil: //null never equals anything
+		j.inner = &sliceRows{}
+	case step.operator == indexNestedLoopJoin:
+		eq := &rowFilter{table: &step.table.table, where: &boundExpression{exprType: ConditionExpression,
+			condition: boundCondition{left: step.inner, literal: key, literalType: step.inner.columnType, operator: Eq}}}
+		j.inner = &filterRows{input: j.p.tx.newTableScan(&step.table.table, eq), filter: eq}
+	default:
+		if step.hashed == nil {
+			if err := j.p.buildHash(step); err != nil {
+				return err
+			}
+		}
+		matches := sliceRows(step.hashed[string(key)])
+		j.inner = &matches
+	}
+	return nil
+}
+
+func (j *joinRows) close() error {
+	err := j.input.close()
+	if j.inner != nil {
+		err = errors.Join(err, j.inner.close())
+	}
+	return err
+}
+
+// reads the rows of the table of a hash join by the value of its join column, rows with a null value never match
+func (p *joinPlan) buildHash(step *joinStep) error {
+	t := &step.table.table
+	step.hashed = make(map[string][][]byte)
+	rowbitset := t.newRowBitSet()
+	all, _ := t.newRowFilter(nil)
+	return p.tx.scanRows(t, all, func(row []byte) error {
+		rowbitset.fromBytes(row[:rowbitset.Size()])
+		if rowbitset.hasBit(step.inner.columnIndex) {
+			return nil
+		}
+		key := string(t.cellAt(row, step.inner))
+		step.hashed[key] = append(step.hashed[key], append([]byte{}, row...))
+		return nil
+	})
+}
+
+// puts the cells of a row of a table in the cells of the combined row
+func setCells(cells []Cell, st scopeTable, row []byte) {
+	rowbitset := st.table.newRowBitSet()
+	rowbitset.fromBytes(row[:rowbitset.Size()])
+	for i, col := range st.table.Columns {
+		cells[st.offset+i] = nil
+		if !rowbitset.hasBit(i) {
+			cells[st.offset+i] = st.table.cellAt(row, col)
+		}
+	}
+}
+
+func (p *joinPlan) row(cells []Cell) []byte {
+	rowbitset := p.combined.newRowBitSet()
+	for i, cell := range cells {
+		if cell == nil {
+			rowbitset.setBit(i)
+		}
+	}
+	return p.combined.buildRow(rowbitset, cells)
+}
@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"strings"
+)
+
+/*
+Lexer splitting a statement into tokens before it is parsed
+- reserved words come out upper cased, multi word ones like PRIMARY KEY as a single token
+- type names and words like JOIN or LIMIT are not reserved, they come out as identifiers the parser reads as keywords where it expects one
+- quoted strings come out without their quotes, a quote is written twice inside a string
+- numbers, TRUE, FALSE and NULL are typed literals so they need no quotes
+- identifiers may be qualified by a table name or alias like p.name
+lexing stops at the first character no token starts with and leaves an invalid token there
+*/
+type tokenKind int
+
+const (
+	tokenInvalid tokenKind = iota
+	tokenKeyword
+	tokenIdentifier
+	tokenString
+	tokenInteger
+	tokenFloat
+	tokenBoolean
+	tokenNull
+	tokenPlaceholder
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int //offset in the statement, used to point at errors
+}
+
+func lex(sql string) []token {
+	tokens := make([]token, 0)
+	i := 0
+	for {
+		for i < len(sql) && isSpace(sql[i]) {
+			i++
+		}
+		if i >= len(sql) {
+			return tokens
+		}
+		tok, length := lexToken(sql, i)
+		tokens = append(tokens, tok)
+		if tok.kind == tokenInvalid {
+			return tokens
+		}
+		i += length
+	}
+}
+
+// token starting at offset i and the number of bytes it takes
+func lexToken(sql string, i int) (token, int) {
+	c := sql[i]
+	switch {
+	case c == '\'':
+		return lexString(sql, i)
+	case c == '$':
+		end := i + 1
+		for end < len(sql) && isDigit(sql[end]) {
+			end++
+		}
+		return token{kind: tokenPlaceholder, text: sql[i:end], pos: i}, end - i
+	}
+	for _, rWord := range reservedWords {
+		end := min(len(sql), i+len(rWord))
+		if strings.ToUpper(sql[i:end]) != rWord || continuesWord(sql, end, rWord) {
+			continue
+		}
+		switch rWord {
+		case "NULL":
+			return token{kind: tokenNull, text: rWord, pos: i}, len(rWord)
+		case "TRUE", "FALSE":
+			return token{kind: tokenBoolean, text: strings.ToLower(rWord), pos: i}, len(rWord)
+		}
+		return token{kind: tokenKeyword, text: rWord, pos: i}, len(rWord)
+	}
+	if length, kind := numberLength(sql[i:]); length > 0 && (i+length == len(sql) || !isWordByte(sql[i+length])) {
+		return token{kind: kind, text: sql[i : i+length], pos: i}, length
+	}
+	//a field may be qualified by the name of its table like p.name or p.*
+	end := i
+	for end < len(sql) && (isWordByte(sql[end]) || sql[end] == '*' || (sql[end] == '.' && end > i)) {
+		end++
+	}
+	if end == i {
+		return token{kind: tokenInvalid, pos: i}, 0
+	}
+	return token{kind: tokenIdentifier, text: sql[i:end], pos: i}, end - i
+}
+
+// quoted string at offset i, a quote inside it is written twice and a backslash is an ordinary character
+// a string closed right after a backslash and followed by a word was most likely written with \' for a quote
+// and comes out as an invalid token explaining so rather than as a shorter string
+func lexString(sql string, i int) (token, int) {
+	var sb strings.Builder
+	for j := i + 1; j < len(sql); j++ {
+		switch {
+		case sql[j] == '\'' && j+1 < len(sql) && sql[j+1] == '\'':
+			sb.WriteByte('\'')
+			j++
+		case sql[j] == '\'' && sql[j-1] == '\\' && j+1 < len(sql) && isWordByte(sql[j+1]):
+			return token{kind: tokenInvalid, text: "quotes inside strings are written twice, a backslash does not escape them", pos: j}, 0
+		case sql[j] == '\'':
+			return token{kind: tokenString, text: sb.String(), pos: i}, j + 1 - i
+		default:
+			sb.WriteByte(sql[j])
+		}
+	}
+	return token{kind: tokenInvalid, pos: i}, 0
+}
+
+// length of the signed integer or float like -12, 2.5 or 1e-3 at the start of s, zero when there is none
+func numberLength(s string) (int, tokenKind) {
+	kind := tokenInteger
+	i := 0
+	if i < len(s) && (s[i] == '-' || s[i] == '+') {
+		i++
+	}
+	digits := 0
+	for ; i < len(s) && isDigit(s[i]); i++ {
+		digits++
+	}
+	if i < len(s) && s[i] == '.' {
+		kind = tokenFloat
+		for i++; i < len(s) && isDigit(s[i]); i++ {
+			digits++
+		}
+	}
+	if digits == 0 {
+		return 0, kind
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		j := i + 1
+		if j < len(s) && (s[j] == '-' || s[j] == '+') {
+			j++
+		}
+		if j < len(s) && isDigit(s[j]) {
+			for i = j; i < len(s) && isDigit(s[i]); i++ {
+			}
+			kind = tokenFloat
+		}
+	}
+	return i, kind
+}
+
+// reports whether a reserved word ending at end is only the prefix of a longer identifier
+func continuesWord(sql string, end int, rWord string) bool {
+	if end >= len(sql) || !isWordByte(rWord[len(rWord)-1]) {
+		return false
+	}
+	return isWordByte(sql[end])
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
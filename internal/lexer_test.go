@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLexer(t *testing.T) {
+	var tests = []struct {
+		name string
+		sql  string
+		want []token
+	}{
+		{"keywords are upper cased", "select a\nfrom 'b'", []token{
+			{tokenKeyword, "SELECT", 0}, {tokenIdentifier, "a", 7}, {tokenKeyword, "FROM", 9}, {tokenString, "b", 14},
+		}},
+		{"typed literals", "(1, -2.5, 3e2, true, FALSE, null, 'x')", []token{
+			{tokenKeyword, "(", 0}, {tokenInteger, "1", 1}, {tokenKeyword, ",", 2}, {tokenFloat, "-2.5", 4}, {tokenKeyword, ",", 8},
+			{tokenFloat, "3e2", 10}, {tokenKeyword, ",", 13}, {tokenBoolean, "true", 15}, {tokenKeyword, ",", 19},
+			{tokenBoolean, "false", 21}, {tokenKeyword, ",", 26}, {tokenNull, "NULL", 28}, {tokenKeyword, ",", 32},
+			{tokenString, "x", 34}, {tokenKeyword, ")", 37},
+		}},
+		{"quotes inside strings", "'it''s' '' 'a\\''b'", []token{
+			{tokenString, "it's", 0}, {tokenString, "", 8}, {tokenString, "a\\'b", 11},
+		}},
+		{"backslashes are ordinary characters", "'C:\\' = path", []token{
+			{tokenString, "C:\\", 0}, {tokenKeyword, "=", 6}, {tokenIdentifier, "path", 8},
+		}},
+		{"words starting with reserved words or digits are identifiers", "order_id >= 2x AND trueish", []token{
+			{tokenIdentifier, "order_id", 0}, {tokenKeyword, ">=", 9}, {tokenIdentifier, "2x", 12}, {tokenKeyword, "AND", 15},
+			{tokenIdentifier, "trueish", 19},
+		}},
+		{"qualified identifiers", "p.name, p.* LEFT JOIN", []token{
+			{tokenIdentifier, "p.name", 0}, {tokenKeyword, ",", 6}, {tokenIdentifier, "p.*", 8}, {tokenKeyword, "LEFT JOIN", 12},
+		}},
+		{"placeholders", "? $12", []token{{tokenKeyword, "?", 0}, {tokenPlaceholder, "$12", 2}}},
+		{"lexing stops at an unterminated string", "a = 'b", []token{
+			{tokenIdentifier, "a", 0}, {tokenKeyword, "=", 2}, {tokenInvalid, "", 4},
+		}},
+		{"lexing stops at a backslash escaped quote", "'it\\'s'", []token{
+			{tokenInvalid, "quotes inside strings are written twice, a backslash does not escape them", 4},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, lex(tt.sql))
+		})
+	}
+}
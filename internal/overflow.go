@@ -0,0 +1,191 @@
+package internal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+/*
+Values too large for the row to fit in a leaf are moved to a chain of overflow pages of the table file
+- byte 26 = node type 3 so overflow pages are never read as tree nodes
+- bytes 27-35 = next overflow page, 0 on the last page
+- bytes 8-10 = number of value bytes in the page, stored from byte 35
+the row keeps first page (8 bytes) | length (8 bytes) of the value with the overflow bit set in its length
+rows handed out by table scans have every value loaded back so only storing and freeing deal with overflow pages
+*/
+const (
+	nodeOverflow     byte = 3
+	overflowFlag          = 1 << 31
+	overflowRefSize       = 16
+	overflowPageData      = PAGESIZE - nodeCellsOffset
+)
+
+// VARCHAR, TEXT and BLOB columns other than the primary key may move to overflow pages
+func (t *Table) canOverflow(col Column) bool {
+	primary, _ := t.primaryColumn()
+	return col.isVariable() && col.columnIndex != primary.columnIndex
+}
+
+// largest values to move out so the stored row takes at most limit bytes, false when it cannot fit
+func (t *Table) overflowColumns(row []byte, limit int) ([]Column, bool) {
+	rowbitset := t.newRowBitSet()
+	rowbitset.fromBytes(row[:rowbitset.Size()])
+	candidates := make([]Column, 0)
+	for _, col := range t.Columns {
+		if t.canOverflow(col) && !rowbitset.hasBit(col.columnIndex) && len(t.cellAt(row, col)) > overflowRefSize {
+			candidates = append(candidates, col)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return len(t.cellAt(row, candidates[i])) > len(t.cellAt(row, candidates[j]))
+	})
+	size := len(row)
+	moved := make([]Column, 0)
+	for _, col := range candidates {
+		if size <= limit {
+			break
+		}
+		size -= len(t.cellAt(row, col)) - overflowRefSize
+		moved = append(moved, col)
+	}
+	return moved, size <= limit
+}
+
+// row as written to the tree with the values that do not fit moved to overflow pages
+func (tx *Transaction) storeRow(bt *btree, t *Table, row []byte) ([]byte, error) {
+	moved, ok := t.overflowColumns(row, bt.maxRowSize())
+	if !ok {
+		return nil, bt.rowTooLarge(row)
+	}
+	if len(moved) == 0 {
+		return row, nil
+	}
+	rowbitset := t.newRowBitSet()
+	rowbitset.fromBytes(row[:rowbitset.Size()])
+	cells := make([]Cell, len(t.Columns))
+	for i, col := range t.Columns {
+		if !rowbitset.hasBit(i) {
+			cells[i] = t.cellAt(row, col)
+		}
+	}
+	for _, col := range moved {
+		first := tx.writeOverflow(bt, cells[col.columnIndex])
+		ref := binary.LittleEndian.AppendUint64(nil, uint64(first))
+		cells[col.columnIndex] = binary.LittleEndian.AppendUint64(ref, uint64(len(cells[col.columnIndex])))
+	}
+	stored := t.buildRow(rowbitset, cells)
+	for _, col := range moved {
+		celloffset := int(rowbitset.Size()) + col.columnOffset
+		binary.LittleEndian.PutUint32(stored[celloffset+4:celloffset+8], overflowFlag)
+	}
+	return stored, nil
+}
+
+// writes value to a new chain of overflow pages returning its first page
+func (tx *Transaction) writeOverflow(bt *btree, value []byte) PageID {
+	pages := make([]node, (len(value)+overflowPageData-1)/overflowPageData)
+	for i := range pages {
+		pages[i] = bt.allocate(nodeOverflow)
+	}
+	for i, n := range pages {
+		chunk := value[i*overflowPageData:]
+		if len(chunk) > overflowPageData {
+			chunk = chunk[:overflowPageData]
+		}
+		copy(n.buf[nodeCellsOffset:], chunk)
+		n.setCount(len(chunk))
+		if i+1 < len(pages) {
+			n.setNext(pages[i+1].id)
+		}
+	}
+	return pages[0].id
+}
+
+// first page and length of every overflowed value of a stored row
+func (t *Table) overflowRefs(row []byte) ([]PageID, []int) {
+	rowbitset := t.newRowBitSet()
+	rowbitset.fromBytes(row[:rowbitset.Size()])
+	pages, lengths := make([]PageID, 0), make([]int, 0)
+	for _, col := range t.Columns {
+		if !col.isVariable() || rowbitset.hasBit(col.columnIndex) {
+			continue
+		}
+		if offset, _, overflowed := t.varSlot(row, col); overflowed {
+			pages = append(pages, PageID(binary.LittleEndian.Uint64(row[offset:offset+8])))
+			lengths = append(lengths, int(binary.LittleEndian.Uint64(row[offset+8:offset+16])))
+		}
+	}
+	return pages, lengths
+}
+
+// row with its overflowed values read back, rows without any are returned as they are
+func (tx *Transaction) loadRow(t *Table, row []byte) ([]byte, error) {
+	if pages, _ := t.overflowRefs(row); len(pages) == 0 {
+		return row, nil
+	}
+	rowbitset := t.newRowBitSet()
+	rowbitset.fromBytes(row[:rowbitset.Size()])
+	cells := make([]Cell, len(t.Columns))
+	for i, col := range t.Columns {
+		if rowbitset.hasBit(i) {
+			continue
+		}
+		cells[i] = t.cellAt(row, col)
+		if !col.isVariable() {
+			continue
+		}
+		if offset, _, overflowed := t.varSlot(row, col); overflowed {
+			first := PageID(binary.LittleEndian.Uint64(row[offset : offset+8]))
+			length := int(binary.LittleEndian.Uint64(row[offset+8 : offset+16]))
+			value, err := tx.readOverflow(t.Name, first, length)
+			if err != nil {
+				return nil, err
+			}
+			cells[i] = value
+		}
+	}
+	return t.buildRow(rowbitset, cells), nil
+}
+
+func (tx *Transaction) readOverflow(file string, id PageID, length int) (Cell, error) {
+	value := make(Cell, 0, length)
+	for len(value) < length {
+		buf, err := tx.readPage(file, id)
+		if err != nil {
+			return nil, err
+		}
+		n := node{id: id, buf: buf}
+		if buf[nodeTypeOffset] != nodeOverflow || n.count() > overflowPageData {
+			return nil, fmt.Errorf("page %d is not an overflow page", id)
+		}
+		value = append(value, buf[nodeCellsOffset:nodeCellsOffset+n.count()]...)
+		if id = n.next(); id == 0 {
+			break
+		}
+	}
+	if len(value) != length {
+		return nil, fmt.Errorf("overflow value of %d bytes cut short at %d bytes", length, len(value))
+	}
+	return value, nil
+}
+
+// frees the overflow pages of the row stored under key before it is deleted or replaced
+func (tx *Transaction) freeOverflow(bt *btree, t *Table, key Cell) error {
+	row, ok, err := bt.get(key)
+	if err != nil || !ok {
+		return err
+	}
+	pages, _ := t.overflowRefs(row)
+	for _, id := range pages {
+		for id != 0 {
+			n, err := bt.writableNode(id)
+			if err != nil {
+				return err
+			}
+			id = n.next()
+			bt.free(n)
+		}
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package internal
 import (
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -32,7 +33,7 @@ func ParseMany(sqls []string) ([]Query, error) {
 }
 
 func parse(sql string) (Query, error) {
-	return (&parser{0, strings.TrimSpace(sql), stepType, Query{}, nil, ""}).parse()
+	return (&parser{0, lex(sql), sql, stepType, Query{}, nil, "", 0, ""}).parse()
 }
 
 type step int
@@ -43,6 +44,11 @@ const (
 	stepSelectFrom
 	stepSelectComma
 	stepSelectFromTable
+	stepSelectTableAlias
+	stepJoin
+	stepJoinTable
+	stepJoinAlias
+	stepJoinOn
 	stepInsertTable
 	stepInsertFieldsOpeningParens
 	stepInsertFields
@@ -60,10 +66,21 @@ const (
 	stepUpdateComma
 	stepDeleteFromTable
 	stepWhere
-	stepWhereField
-	stepWhereOperator
-	stepWhereValue
-	stepWhereAnd
+	stepWhereEnd
+	stepGroupBy
+	stepGroupByField
+	stepGroupByComma
+	stepHaving
+	stepHavingEnd
+	stepOrderBy
+	stepOrderByField
+	stepOrderByDirection
+	stepOrderByComma
+	stepLimit
+	stepLimitValue
+	stepOffset
+	stepOffsetValue
+	stepLimitEnd
 	stepCreateTable
 	stepCreateFieldsOpeningParens
 	stepCreateFields
@@ -72,26 +89,54 @@ const (
 	stepCreateConstraints
 	stepCreateCommaOrClosingParens
 	stepDropTable
+	stepCreateIndexName
+	stepCreateIndexOn
+	stepCreateIndexTable
+	stepCreateIndexOpeningParens
+	stepCreateIndexField
+	stepCreateIndexCommaOrClosingParens
+	stepCreateIndexEnd
+	stepDropIndex
 )
 
 type parser struct {
-	i               int
+	i               int //index of the next token
+	tokens          []token
 	sql             string
 	step            step
 	query           Query
 	err             error
 	nextUpdateField string
+	conditionCount  int
+	clause          string //WHERE or HAVING while their expression is parsed
 }
 
+// reservedWords never name a column, words like AS, JOIN, ON, LIMIT, OFFSET or type names like DATE and TEXT are left out
+// so they lex as identifiers and are only read as keywords where the parser expects them
 var reservedWords = []string{
-	"(", ")", ">=", "<=", "!=", ",", "=", ">", "<", "SELECT", "INSERT INTO", "VALUES", "UPDATE", "DELETE FROM",
-	"WHERE", "FROM", "SET", "AS", "CREATE TABLE", "DROP TABLE",
-	"PRIMARY KEY", "NOT NULL", "UNIQUE",
+	"(", ")", ">=", "<=", "!=", ",", "=", ">", "<", "?", "SELECT", "INSERT INTO", "VALUES", "UPDATE", "DELETE FROM",
+	"WHERE", "FROM", "SET", "INNER JOIN", "LEFT JOIN", "LEFT OUTER JOIN", "GROUP BY", "HAVING", "ORDER BY", "ASC", "DESC", "NULLS FIRST", "NULLS LAST", "CREATE TABLE", "DROP TABLE", "IF EXISTS",
+	"CREATE INDEX", "CREATE UNIQUE INDEX", "DROP INDEX",
+	"PRIMARY KEY", "NOT NULL", "UNIQUE", "IS NOT NULL", "IS NULL", "NULL", "TRUE", "FALSE", "AND", "OR", "NOT",
+	"TINYINT UNSIGNED", "SMALLINT UNSIGNED", "INTEGER UNSIGNED", "BIGINT UNSIGNED",
 	"INT", "FLOAT", "BOOL", "CHAR",
 }
 
+// reservedTypes are indexed by the type constants below
 var reservedTypes = []string{
-	"INT", "FLOAT", "BOOL", "CHAR",
+	"INT", "FLOAT", "BOOL", "CHAR", "VARCHAR", "TEXT", "BLOB", "DATE", "TIMESTAMP", "INTERVAL", "DECIMAL",
+	"TINYINT", "SMALLINT", "INTEGER", "TINYINT UNSIGNED", "SMALLINT UNSIGNED", "INTEGER UNSIGNED", "BIGINT UNSIGNED",
+}
+
+// functions a SELECT field, HAVING condition or ORDER BY field may aggregate rows with
+var aggregateFuncs = map[string]AggregateFunc{"COUNT": Count, "SUM": Sum, "AVG": Avg, "MIN": Min, "MAX": Max}
+
+// keywords starting a JOIN clause, INNER is the default
+var joinTypes = map[string]JoinType{"JOIN": InnerJoin, "INNER JOIN": InnerJoin, "LEFT JOIN": LeftJoin, "LEFT OUTER JOIN": LeftJoin}
+
+// other names accepted for a type in CREATE TABLE, replaced by the type they stand for
+var typeAliases = map[string]string{
+	"BIGINT": "INT",
 }
 
 var reservedConstraints = []string{
@@ -103,9 +148,30 @@ const (
 	FLOAT
 	BOOL
 	CHAR
+	VARCHAR
+	TEXT
+	BLOB
+	DATE
+	TIMESTAMP
+	INTERVAL
+	DECIMAL
+	TINYINT
+	SMALLINT
+	INTEGER
+	UTINYINT
+	USMALLINT
+	UINTEGER
+	UBIGINT
 )
 
 func (p *parser) parse() (Query, error) {
+	//invalid tokens with a text tell why lexing stopped
+	if n := len(p.tokens); n > 0 && p.tokens[n-1].kind == tokenInvalid && p.tokens[n-1].text != "" {
+		p.i = n - 1
+		p.err = fmt.Errorf("%s", p.tokens[n-1].text)
+		p.logError()
+		return Query{}, p.err
+	}
 	q, err := p.doParse()
 	p.err = err
 	if p.err == nil {
@@ -117,7 +183,7 @@ func (p *parser) parse() (Query, error) {
 
 func (p *parser) doParse() (Query, error) {
 	for {
-		if p.i >= len(p.sql) {
+		if p.i >= len(p.tokens) {
 			return p.query, p.err
 		}
 		switch p.step {
@@ -133,7 +199,7 @@ func (p *parser) doParse() (Query, error) {
 				p.step = stepInsertTable
 			case "UPDATE":
 				p.query.Type = Update
-				p.query.Updates = map[string]string{}
+				p.query.Updates = map[string]Value{}
 				p.pop()
 				p.step = stepUpdateTable
 			case "DELETE FROM":
@@ -148,18 +214,33 @@ func (p *parser) doParse() (Query, error) {
 				p.query.Type = Drop
 				p.pop()
 				p.step = stepDropTable
+			case "CREATE INDEX", "CREATE UNIQUE INDEX":
+				p.query.Type = CreateIndex
+				p.query.Unique = strings.ToUpper(p.peek()) == "CREATE UNIQUE INDEX"
+				p.pop()
+				p.step = stepCreateIndexName
+			case "DROP INDEX":
+				p.query.Type = DropIndex
+				p.pop()
+				p.step = stepDropIndex
 			default:
 				return p.query, fmt.Errorf("invalid query type")
 			}
 		case stepSelectField:
-			identifier := p.peek()
-			if !isIdentifierOrAsterisk(identifier) {
+			p.clause = "SELECT"
+			identifier, isAggregate, err := p.parseAggregate()
+			if err != nil {
+				return p.query, err
+			}
+			if !isAggregate && !isIdentifierOrAsterisk(identifier) {
 				return p.query, fmt.Errorf("at SELECT: expected field to SELECT")
 			}
 			p.query.Fields = append(p.query.Fields, identifier)
-			p.pop()
+			if !isAggregate {
+				p.pop()
+			}
 			maybeFrom := p.peek()
-			if strings.ToUpper(maybeFrom) == "AS" {
+			if p.peekKeyword() == "AS" {
 				p.pop()
 				alias := p.peek()
 				if !isIdentifier(alias) {
@@ -198,7 +279,66 @@ func (p *parser) doParse() (Query, error) {
 			}
 			p.query.TableName = tableName
 			p.pop()
-			p.step = stepWhere
+			p.step = stepSelectTableAlias
+		case stepSelectTableAlias:
+			if p.peekKeyword() == "AS" {
+				p.pop()
+				alias := p.peek()
+				if !isIdentifier(alias) {
+					return p.query, fmt.Errorf("at SELECT: expected table alias for \"" + p.query.TableName + " as\"")
+				}
+				p.query.TableAlias = alias
+				p.pop()
+			} else if p.peekBareAlias() {
+				p.query.TableAlias = p.pop()
+			}
+			p.step = stepJoin
+		case stepJoin:
+			joinType, ok := joinTypes[p.peekKeyword()]
+			if !ok {
+				p.step = stepWhere
+				continue
+			}
+			p.query.Joins = append(p.query.Joins, Join{Type: joinType})
+			p.pop()
+			p.step = stepJoinTable
+		case stepJoinTable:
+			tableName := p.peek()
+			if len(tableName) == 0 {
+				return p.query, fmt.Errorf("at JOIN: expected quoted table name")
+			}
+			p.query.Joins[len(p.query.Joins)-1].TableName = tableName
+			p.pop()
+			p.step = stepJoinAlias
+		case stepJoinAlias:
+			join := &p.query.Joins[len(p.query.Joins)-1]
+			if p.peekKeyword() == "AS" {
+				p.pop()
+				alias := p.peek()
+				if !isIdentifier(alias) {
+					return p.query, fmt.Errorf("at JOIN: expected table alias for \"" + join.TableName + " as\"")
+				}
+				join.Alias = alias
+				p.pop()
+			} else if p.peekBareAlias() {
+				join.Alias = p.pop()
+			}
+			p.step = stepJoinOn
+		case stepJoinOn:
+			if p.peekKeyword() != "ON" {
+				return p.query, fmt.Errorf("at JOIN: expected ON")
+			}
+			p.pop()
+			p.clause = "ON"
+			if p.i >= len(p.tokens) {
+				return p.query, fmt.Errorf("at ON: empty ON clause")
+			}
+			on, err := p.parseOrExpression()
+			if err != nil {
+				return p.query, err
+			}
+			p.query.Joins[len(p.query.Joins)-1].On = on
+			p.step = stepJoin
 		case stepDeleteFromTable:
 			tableName := p.peek()
 			if len(tableName) == 0 {
@@ -238,11 +378,15 @@ func (p *parser) doParse() (Query, error) {
 			p.pop()
 			p.step = stepUpdateValue
 		case stepUpdateValue:
-			quotedValue, ln := p.peekQuotedStringWithLength()
-			if ln == 0 {
-				return p.query, fmt.Errorf("at UPDATE: expected quoted value")
+			value, ok := p.peekValue()
+			if !ok {
+				number := p.placeholderNumber(p.peek())
+				if number == 0 {
+					return p.query, fmt.Errorf("at UPDATE: expected value")
+				}
+				p.query.Params = append(p.query.Params, Param{Number: number, Kind: ParamUpdate, Field: p.nextUpdateField})
 			}
-			p.query.Updates[p.nextUpdateField] = quotedValue
+			p.query.Updates[p.nextUpdateField] = value
 			p.nextUpdateField = ""
 			p.pop()
 			maybeWhere := p.peek()
@@ -261,65 +405,136 @@ func (p *parser) doParse() (Query, error) {
 
 		case stepWhere:
 			whereRWord := p.peek()
+			if next, ok := p.selectClause(); ok {
+				p.step = next
+				continue
+			}
 			if strings.ToUpper(whereRWord) != "WHERE" {
 				return p.query, fmt.Errorf("expected WHERE")
 			}
 			p.pop()
-			p.step = stepWhereField
-		case stepWhereField:
+			p.clause = "WHERE"
+			if p.i >= len(p.tokens) {
+				return p.query, fmt.Errorf("at WHERE: empty WHERE clause")
+			}
+			where, err := p.parseOrExpression()
+			if err != nil {
+				return p.query, err
+			}
+			p.query.Where = where
+			p.step = stepWhereEnd
+		case stepWhereEnd:
+			if next, ok := p.selectClause(); ok {
+				p.step = next
+				continue
+			}
+			return p.query, fmt.Errorf("at WHERE: unexpected token after condition")
+		case stepGroupBy:
+			p.pop()
+			p.step = stepGroupByField
+		case stepGroupByField:
 			identifier := p.peek()
 			if !isIdentifier(identifier) {
-				return p.query, fmt.Errorf("at WHERE: expected field")
-			}
-			p.query.Conditions = append(p.query.Conditions, Condition{Operand1: identifier, Operand1IsField: true})
-			p.pop()
-			p.step = stepWhereOperator
-		case stepWhereOperator:
-			operator := p.peek()
-			currentCondition := p.query.Conditions[len(p.query.Conditions)-1]
-			switch operator {
-			case "=":
-				currentCondition.Operator = Eq
-			case ">":
-				currentCondition.Operator = Gt
-			case ">=":
-				currentCondition.Operator = Gte
-			case "<":
-				currentCondition.Operator = Lt
-			case "<=":
-				currentCondition.Operator = Lte
-			case "!=":
-				currentCondition.Operator = Ne
-			default:
-				return p.query, fmt.Errorf("at WHERE: unknown operator")
+				return p.query, fmt.Errorf("at GROUP BY: expected field to group by")
 			}
-			p.query.Conditions[len(p.query.Conditions)-1] = currentCondition
+			p.query.GroupBy = append(p.query.GroupBy, identifier)
 			p.pop()
-			p.step = stepWhereValue
-		case stepWhereValue:
-			currentCondition := p.query.Conditions[len(p.query.Conditions)-1]
-			identifier := p.peek()
-			if isIdentifier(identifier) {
-				currentCondition.Operand2 = identifier
-				currentCondition.Operand2IsField = true
-			} else {
-				quotedValue, ln := p.peekQuotedStringWithLength()
-				if ln == 0 {
-					return p.query, fmt.Errorf("at WHERE: expected quoted value")
-				}
-				currentCondition.Operand2 = quotedValue
-				currentCondition.Operand2IsField = false
+			p.step = stepGroupByComma
+		case stepGroupByComma:
+			if next, ok := p.selectClause(); ok {
+				p.step = next
+				continue
+			}
+			if p.peek() != "," {
+				return p.query, fmt.Errorf("at GROUP BY: expected comma")
+			}
+			p.pop()
+			p.step = stepGroupByField
+		case stepHaving:
+			p.pop()
+			p.clause = "HAVING"
+			if p.i >= len(p.tokens) {
+				return p.query, fmt.Errorf("at HAVING: empty HAVING clause")
+			}
+			having, err := p.parseOrExpression()
+			if err != nil {
+				return p.query, err
+			}
+			p.query.Having = having
+			p.step = stepHavingEnd
+		case stepHavingEnd:
+			if next, ok := p.selectClause(); ok {
+				p.step = next
+				continue
+			}
+			return p.query, fmt.Errorf("at HAVING: unexpected token after condition")
+		case stepOrderBy:
+			p.pop()
+			p.step = stepOrderByField
+		case stepOrderByField:
+			p.clause = "ORDER BY"
+			identifier, isAggregate, err := p.parseAggregate()
+			if err != nil {
+				return p.query, err
+			}
+			if !isAggregate && !isIdentifier(identifier) {
+				return p.query, fmt.Errorf("at ORDER BY: expected field to order by")
+			}
+			p.query.OrderBy = append(p.query.OrderBy, OrderField{Field: identifier})
+			if !isAggregate {
+				p.pop()
+			}
+			p.step = stepOrderByDirection
+		case stepOrderByDirection:
+			//nulls are larger than any value unless NULLS FIRST or NULLS LAST says otherwise
+			field := &p.query.OrderBy[len(p.query.OrderBy)-1]
+			if word := p.peek(); word == "ASC" || word == "DESC" {
+				field.Desc = word == "DESC"
+				p.pop()
+			}
+			field.NullsFirst = field.Desc
+			if word := p.peek(); word == "NULLS FIRST" || word == "NULLS LAST" {
+				field.NullsFirst = word == "NULLS FIRST"
+				p.pop()
+			}
+			p.step = stepOrderByComma
+		case stepOrderByComma:
+			if next, ok := p.selectClause(); ok {
+				p.step = next
+				continue
 			}
-			p.query.Conditions[len(p.query.Conditions)-1] = currentCondition
+			if p.peek() != "," {
+				return p.query, fmt.Errorf("at ORDER BY: expected comma")
+			}
+			p.pop()
+			p.step = stepOrderByField
+		case stepLimit:
 			p.pop()
-			p.step = stepWhereAnd
-		case stepWhereAnd:
-			andRWord := p.peek()
-			if strings.ToUpper(andRWord) != "AND" {
-				return p.query, fmt.Errorf("expected AND")
+			p.step = stepLimitValue
+		case stepLimitValue:
+			n, ok := p.peekCount()
+			if !ok {
+				return p.query, fmt.Errorf("at LIMIT: expected number of rows")
 			}
+			p.query.Limit = &n
 			p.pop()
-			p.step = stepWhereField
+			p.step = stepOffset
+		case stepOffset:
+			if p.peekKeyword() != "OFFSET" {
+				return p.query, fmt.Errorf("at LIMIT: unexpected token after number of rows")
+			}
+			p.pop()
+			p.step = stepOffsetValue
+		case stepOffsetValue:
+			n, ok := p.peekCount()
+			if !ok {
+				return p.query, fmt.Errorf("at OFFSET: expected number of rows")
+			}
+			p.query.Offset = n
+			p.pop()
+			p.step = stepLimitEnd
+		case stepLimitEnd:
+			return p.query, fmt.Errorf("at OFFSET: unexpected token after number of rows")
 
 		case stepInsertTable:
 			tableName := p.peek()
@@ -367,15 +582,20 @@ func (p *parser) doParse() (Query, error) {
 			if openingParens != "(" {
 				return p.query, fmt.Errorf("at INSERT INTO: expected opening parens")
 			}
-			p.query.Inserts = append(p.query.Inserts, []string{})
+			p.query.Inserts = append(p.query.Inserts, []Value{})
 			p.pop()
 			p.step = stepInsertValues
 		case stepInsertValues:
-			quotedValue, ln := p.peekQuotedStringWithLength()
-			if ln == 0 {
-				return p.query, fmt.Errorf("at INSERT INTO: expected quoted value")
+			value, ok := p.peekValue()
+			if !ok {
+				number := p.placeholderNumber(p.peek())
+				if number == 0 {
+					return p.query, fmt.Errorf("at INSERT INTO: expected value")
+				}
+				row := len(p.query.Inserts) - 1
+				p.query.Params = append(p.query.Params, Param{Number: number, Kind: ParamInsert, Row: row, Column: len(p.query.Inserts[row])})
 			}
-			p.query.Inserts[len(p.query.Inserts)-1] = append(p.query.Inserts[len(p.query.Inserts)-1], quotedValue)
+			p.query.Inserts[len(p.query.Inserts)-1] = append(p.query.Inserts[len(p.query.Inserts)-1], value)
 			p.pop()
 			p.step = stepInsertValuesCommaOrClosingParens
 		case stepInsertValuesCommaOrClosingParens:
@@ -425,10 +645,13 @@ func (p *parser) doParse() (Query, error) {
 			p.pop()
 			p.step = stepCreateColumnType
 		case stepCreateColumnType:
-			datatype := p.peek()
+			datatype := p.peekKeyword()
 			if !isDataType(datatype) {
 				return p.query, fmt.Errorf("at CREATE TABLE: expected valid data type for column")
 			}
+			if alias, ok := typeAliases[datatype]; ok {
+				datatype = alias
+			}
 			p.query.TableConstruction[len(p.query.TableConstruction)-1] = append(p.query.TableConstruction[len(p.query.TableConstruction)-1], datatype)
 			p.pop()
 			p.step = stepCreateColumnSize
@@ -444,9 +667,21 @@ func (p *parser) doParse() (Query, error) {
 			}
 			//maybeCommaOrParens = "("
 			p.pop()
+			construct := p.query.TableConstruction[len(p.query.TableConstruction)-1]
 			columnSize := p.peek()
-			p.query.TableConstruction[len(p.query.TableConstruction)-1] = append(p.query.TableConstruction[len(p.query.TableConstruction)-1], columnSize)
+			construct = append(construct, columnSize)
 			p.pop()
+			//DECIMAL(precision, scale) has a scale of 0 when it is left out
+			if strings.ToUpper(construct[1]) == "DECIMAL" {
+				scale := "0"
+				if p.peek() == "," {
+					p.pop()
+					scale = p.peek()
+					p.pop()
+				}
+				construct = append(construct, scale)
+			}
+			p.query.TableConstruction[len(p.query.TableConstruction)-1] = construct
 			closingParens := p.peek()
 			if closingParens != ")" {
 				return p.query, fmt.Errorf("at CREATE TABLE: expected closing parens for size value")
@@ -473,85 +708,352 @@ func (p *parser) doParse() (Query, error) {
 			}
 		case stepDropTable:
 			tableName := p.peek()
+			if strings.ToUpper(tableName) == "IF EXISTS" && !p.query.IfExists {
+				p.query.IfExists = true
+				p.pop()
+				continue
+			}
 			if len(tableName) == 0 {
 				return p.query, fmt.Errorf("at DROP TABLE: expected quoted table name")
 			}
 			p.query.TableName = tableName
 			p.pop()
+		case stepCreateIndexName:
+			indexName := p.peek()
+			if !isIdentifier(indexName) {
+				return p.query, fmt.Errorf("at CREATE INDEX: expected index name")
+			}
+			p.query.IndexName = indexName
+			p.pop()
+			p.step = stepCreateIndexOn
+		case stepCreateIndexOn:
+			if p.peekKeyword() != "ON" {
+				return p.query, fmt.Errorf("at CREATE INDEX: expected ON")
+			}
+			p.pop()
+			p.step = stepCreateIndexTable
+		case stepCreateIndexTable:
+			tableName := p.peek()
+			if len(tableName) == 0 {
+				return p.query, fmt.Errorf("at CREATE INDEX: expected quoted table name")
+			}
+			p.query.TableName = tableName
+			p.pop()
+			p.step = stepCreateIndexOpeningParens
+		case stepCreateIndexOpeningParens:
+			if p.peek() != "(" {
+				return p.query, fmt.Errorf("at CREATE INDEX: expected opening parens")
+			}
+			p.pop()
+			p.step = stepCreateIndexField
+		case stepCreateIndexField:
+			identifier := p.peek()
+			if !isIdentifier(identifier) {
+				return p.query, fmt.Errorf("at CREATE INDEX: expected field to index")
+			}
+			p.query.Fields = append(p.query.Fields, identifier)
+			p.pop()
+			p.step = stepCreateIndexCommaOrClosingParens
+		case stepCreateIndexCommaOrClosingParens:
+			commaOrParens := p.peek()
+			if commaOrParens != "," && commaOrParens != ")" {
+				return p.query, fmt.Errorf("at CREATE INDEX: expected comma or closing parens")
+			}
+			p.pop()
+			if commaOrParens == "," {
+				p.step = stepCreateIndexField
+			} else {
+				p.step = stepCreateIndexEnd
+			}
+		case stepCreateIndexEnd:
+			return p.query, fmt.Errorf("at CREATE INDEX: unexpected token after closing parens")
+		case stepDropIndex:
+			indexName := p.peek()
+			if strings.ToUpper(indexName) == "IF EXISTS" && !p.query.IfExists {
+				p.query.IfExists = true
+				p.pop()
+				continue
+			}
+			if !isIdentifier(indexName) {
+				return p.query, fmt.Errorf("at DROP INDEX: expected index name")
+			}
+			p.query.IndexName = indexName
+			p.pop()
 		}
 
 	}
 }
 
-func (p *parser) peek() string {
-	peeked, _ := p.peekWithLength()
-	return peeked
+// WHERE expressions are parsed by precedence with NOT binding tightest then AND then OR
+func (p *parser) parseOrExpression() (*Expression, error) {
+	left, err := p.parseAndExpression()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "OR" {
+		p.pop()
+		right, err := p.parseAndExpression()
+		if err != nil {
+			return nil, err
+		}
+		left = &Expression{Type: OrExpression, Left: left, Right: right}
+	}
+	return left, nil
 }
 
-func (p *parser) peekWithLength() (string, int) {
-	if p.i >= len(p.sql) {
-		return "", 0
+func (p *parser) parseAndExpression() (*Expression, error) {
+	left, err := p.parseNotExpression()
+	if err != nil {
+		return nil, err
 	}
-	for _, rWord := range reservedWords {
-		token := strings.ToUpper(p.sql[p.i:min(len(p.sql), p.i+len(rWord))])
-		if token == rWord {
-			return token, len(token)
+	for p.peek() == "AND" {
+		p.pop()
+		right, err := p.parseNotExpression()
+		if err != nil {
+			return nil, err
 		}
+		left = &Expression{Type: AndExpression, Left: left, Right: right}
 	}
-	if p.sql[p.i] == '\'' { //Quoted string
-		return p.peekQuotedStringWithLength()
-	}
-	return p.peekIdentifierWithLength()
+	return left, nil
 }
 
-func (p *parser) peekQuotedStringWithLength() (string, int) {
-	if len(p.sql) < p.i || p.sql[p.i] != '\'' {
-		return "", 0
+func (p *parser) parseNotExpression() (*Expression, error) {
+	if p.peek() == "NOT" {
+		p.pop()
+		operand, err := p.parseNotExpression()
+		if err != nil {
+			return nil, err
+		}
+		return &Expression{Type: NotExpression, Left: operand}, nil
 	}
-	for i := p.i + 1; i < len(p.sql); i++ {
-		if p.sql[i] == '\'' && p.sql[i-1] != '\\' {
-			return p.sql[p.i+1 : i], len(p.sql[p.i+1:i]) + 2 //+2 for the two quotes
+	if p.peek() == "(" {
+		p.pop()
+		inner, err := p.parseOrExpression()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("at %s: expected closing parens", p.clause)
 		}
+		p.pop()
+		return inner, nil
 	}
-	return "", 0
+	return p.parseCondition()
 }
 
-func (p *parser) peekIdentifierWithLength() (string, int) {
-	r, _ := regexp.Compile(`[a-zA-Z0-9_*]`)
-	for i := p.i; i < len(p.sql); i++ {
-		if matched := r.MatchString(string(p.sql[i])); !matched {
-			return p.sql[p.i:i], len(p.sql[p.i:i])
+func (p *parser) parseCondition() (*Expression, error) {
+	identifier, isAggregate, err := p.parseAggregate()
+	if err != nil {
+		return nil, err
+	}
+	if !isAggregate && !isIdentifier(identifier) {
+		return nil, fmt.Errorf("at %s: expected field", p.clause)
+	}
+	condition := Condition{Operand1: identifier, Operand1IsField: true}
+	if !isAggregate {
+		p.pop()
+	}
+
+	if p.i >= len(p.tokens) {
+		return nil, fmt.Errorf("at %s: condition without operator", p.clause)
+	}
+	switch p.peek() {
+	case "=":
+		condition.Operator = Eq
+	case ">":
+		condition.Operator = Gt
+	case ">=":
+		condition.Operator = Gte
+	case "<":
+		condition.Operator = Lt
+	case "<=":
+		condition.Operator = Lte
+	case "!=":
+		condition.Operator = Ne
+	case "IS NULL", "IS NOT NULL":
+		condition.Operator = IsNull
+		if p.peek() == "IS NOT NULL" {
+			condition.Operator = IsNotNull
 		}
+		p.pop()
+		if p.clause == "WHERE" {
+			p.conditionCount++
+		}
+		return &Expression{Type: ConditionExpression, Condition: condition}, nil
+	default:
+		return nil, fmt.Errorf("at %s: unknown operator", p.clause)
+	}
+	p.pop()
+
+	identifier, isAggregate, err = p.parseAggregate()
+	if err != nil {
+		return nil, err
 	}
-	return p.sql[p.i:], len(p.sql[p.i:])
+	if isAggregate {
+		condition.Operand2 = identifier
+		condition.Operand2IsField = true
+		return &Expression{Type: ConditionExpression, Condition: condition}, nil
+	}
+	if value, ok := p.peekValue(); ok {
+		condition.Operand2 = value.Text
+		condition.Operand2Kind = value.Kind
+	} else if number := p.placeholderNumber(identifier); number > 0 && p.clause == "WHERE" {
+		p.query.Params = append(p.query.Params, Param{Number: number, Kind: ParamWhere, Condition: p.conditionCount})
+	} else if isIdentifier(identifier) {
+		condition.Operand2 = identifier
+		condition.Operand2IsField = true
+	} else {
+		return nil, fmt.Errorf("at %s: expected value", p.clause)
+	}
+	p.pop()
+	if p.clause == "WHERE" {
+		p.conditionCount++
+	}
+	return &Expression{Type: ConditionExpression, Condition: condition}, nil
 }
 
-func (p *parser) pop() string {
-	peeked, length := p.peekWithLength()
-	p.i += length
-	p.popWhitespace()
-	return peeked
+// parseAggregate reads a call like COUNT(*) or SUM(price) at the cursor returning its field name
+// and registering it in the query, any other token is left at the cursor and returned as is
+func (p *parser) parseAggregate() (string, bool, error) {
+	name := p.peek()
+	fn, ok := aggregateFuncs[strings.ToUpper(name)]
+	if !ok || p.i+1 >= len(p.tokens) || p.tokens[p.i+1].text != "(" {
+		return name, false, nil
+	}
+	if p.clause == "WHERE" || p.clause == "ON" {
+		return "", false, fmt.Errorf("at %s: aggregate functions are not allowed", p.clause)
+	}
+	p.pop()
+	p.pop()
+	field := p.peek()
+	if !isIdentifier(field) && (field != "*" || fn != Count) {
+		return "", false, fmt.Errorf("at %s: expected field to aggregate", p.clause)
+	}
+	p.pop()
+	if p.peek() != ")" {
+		return "", false, fmt.Errorf("at %s: expected closing parens", p.clause)
+	}
+	p.pop()
+	name = fmt.Sprintf("%s(%s)", fn, field)
+	if p.query.Aggregates == nil {
+		p.query.Aggregates = make(map[string]Aggregate)
+	}
+	p.query.Aggregates[name] = Aggregate{Func: fn, Field: field}
+	return name, true, nil
 }
 
-func (p *parser) popWhitespace() {
-	for ; p.i < len(p.sql) && p.sql[p.i] == ' '; p.i++ {
+// step of the clause at the cursor when a SELECT may continue with it, clauses only come in the order of their steps
+func (p *parser) selectClause() (step, bool) {
+	if p.query.Type != Select {
+		return 0, false
 	}
+	next, ok := map[string]step{"GROUP BY": stepGroupBy, "HAVING": stepHaving, "ORDER BY": stepOrderBy, "LIMIT": stepLimit}[p.peekKeyword()]
+	return next, ok && next > p.step
 }
 
-func (p *parser) validate() error {
-	if len(p.query.Conditions) == 0 && p.step == stepWhereField {
-		return fmt.Errorf("at WHERE: empty WHERE clause")
+// returns the argument number of a ? or $N token and zero for any other token
+// ? takes the number after the highest one used so far
+func (p *parser) placeholderNumber(token string) int {
+	if token == "?" {
+		return p.query.NumParams() + 1
+	}
+	if len(token) < 2 || token[0] != '$' {
+		return 0
+	}
+	n, err := strconv.Atoi(token[1:])
+	if err != nil || n < 1 {
+		return 0
+	}
+	return n
+}
+
+func (p *parser) peek() string {
+	return p.peekToken().text
+}
+
+// upper cased word at the cursor for the keywords that are not reserved, empty for quoted strings and literals
+func (p *parser) peekKeyword() string {
+	tok := p.peekToken()
+	if tok.kind != tokenKeyword && tok.kind != tokenIdentifier {
+		return ""
+	}
+	return strings.ToUpper(tok.text)
+}
+
+// reports whether the token at the cursor is a table alias given without AS, any word but the ones continuing the query
+func (p *parser) peekBareAlias() bool {
+	if p.peekToken().kind != tokenIdentifier || !isIdentifier(p.peek()) {
+		return false
+	}
+	switch p.peekKeyword() {
+	case "AS", "ON", "JOIN", "LIMIT", "OFFSET":
+		return false
+	}
+	return true
+}
+
+// token at the cursor, an invalid token past the end
+func (p *parser) peekToken() token {
+	if p.i >= len(p.tokens) {
+		return token{kind: tokenInvalid, pos: len(p.sql)}
+	}
+	return p.tokens[p.i]
+}
+
+// unsigned integer at the cursor for LIMIT and OFFSET
+func (p *parser) peekCount() (uint64, bool) {
+	tok := p.peekToken()
+	if tok.kind != tokenInteger {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(tok.text, 10, 64)
+	return n, err == nil
+}
+
+// literal value at the cursor, false when the token is not a literal
+func (p *parser) peekValue() (Value, bool) {
+	tok := p.peekToken()
+	switch tok.kind {
+	case tokenString:
+		return Value{Kind: StringValue, Text: tok.text}, true
+	case tokenInteger:
+		return Value{Kind: IntValue, Text: tok.text}, true
+	case tokenFloat:
+		return Value{Kind: FloatValue, Text: tok.text}, true
+	case tokenBoolean:
+		return Value{Kind: BoolValue, Text: tok.text}, true
+	case tokenNull:
+		return Value{Kind: NullValue}, true
 	}
+	return Value{}, false
+}
+
+// moves past the token at the cursor, an invalid token is never passed
+func (p *parser) pop() string {
+	tok := p.peekToken()
+	if tok.kind != tokenInvalid {
+		p.i++
+	}
+	return tok.text
+}
+
+func (p *parser) validate() error {
 	if p.query.Type == UnknownType {
 		return fmt.Errorf("query type cannot be empty")
 	}
+	if (p.query.Type == CreateIndex || p.query.Type == DropIndex) && p.query.IndexName == "" {
+		return fmt.Errorf("index name cannot be empty")
+	}
+	if p.query.Type == DropIndex {
+		return nil
+	}
 	if p.query.TableName == "" {
 		return fmt.Errorf("table name cannot be empty")
 	}
-	if len(p.query.Conditions) == 0 && (p.query.Type == Update || p.query.Type == Delete) {
+	if p.query.Where == nil && (p.query.Type == Update || p.query.Type == Delete) {
 		return fmt.Errorf("at WHERE: WHERE clause is mandatory for UPDATE & DELETE")
 	}
-	for _, c := range p.query.Conditions {
+	for _, c := range p.query.Where.Conditions() {
 		if c.Operator == UnknownOperator {
 			return fmt.Errorf("at WHERE: condition without operator")
 		}
@@ -575,6 +1077,30 @@ func (p *parser) validate() error {
 	if p.query.Type == Create && len(p.query.TableConstruction) == 0 {
 		return fmt.Errorf("at CREATE TABLE: can't have empty table")
 	}
+	if p.query.Type == CreateIndex && len(p.query.Fields) == 0 {
+		return fmt.Errorf("at CREATE INDEX: need at least one field to index")
+	}
+	if p.query.Type == Select && p.step == stepJoinTable {
+		return fmt.Errorf("at JOIN: expected quoted table name")
+	}
+	if p.query.Type == Select && (p.step == stepJoinAlias || p.step == stepJoinOn) {
+		return fmt.Errorf("at JOIN: expected ON")
+	}
+	if p.query.Type == Select && (p.step == stepGroupBy || p.step == stepGroupByField) {
+		return fmt.Errorf("at GROUP BY: expected field to group by")
+	}
+	if p.query.Type == Select && (p.step == stepOrderBy || p.step == stepOrderByField) {
+		return fmt.Errorf("at ORDER BY: expected field to order by")
+	}
+	if p.query.Type == Select && p.step == stepLimitValue {
+		return fmt.Errorf("at LIMIT: expected number of rows")
+	}
+	if p.query.Type == Select && p.step == stepOffsetValue {
+		return fmt.Errorf("at OFFSET: expected number of rows")
+	}
+	if p.query.Type == CreateIndex && p.step != stepCreateIndexEnd {
+		return fmt.Errorf("at CREATE INDEX: expected closing parens")
+	}
 	return nil
 }
 
@@ -583,7 +1109,7 @@ func (p *parser) logError() {
 		return
 	}
 	fmt.Println(p.sql)
-	fmt.Println(strings.Repeat(" ", p.i) + "^")
+	fmt.Println(strings.Repeat(" ", p.peekToken().pos) + "^")
 	fmt.Println(p.err)
 }
 
@@ -608,7 +1134,8 @@ func isDataType(s string) bool {
 			return true
 		}
 	}
-	return false
+	_, ok := typeAliases[strings.ToUpper(s)]
+	return ok
 }
 
 func isConstraint(s string) bool {
@@ -14,6 +14,10 @@ type testCase struct {
 	Err      error
 }
 
+func limit(n uint64) *uint64 {
+	return &n
+}
+
 func TestSelectSQL(t *testing.T) {
 	ts := []testCase{
 		{
@@ -92,9 +96,7 @@ func TestSelectSQL(t *testing.T) {
 				Type:      Select,
 				TableName: "b",
 				Fields:    []string{"a", "c", "d"},
-				Conditions: []Condition{
-					{Operand1: "a", Operand1IsField: true, Operator: Eq, Operand2: "", Operand2IsField: false},
-				},
+				Where:     &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "a", Operand1IsField: true, Operator: Eq, Operand2: "", Operand2IsField: false}},
 			},
 			Err: nil,
 		},
@@ -105,9 +107,7 @@ func TestSelectSQL(t *testing.T) {
 				Type:      Select,
 				TableName: "b",
 				Fields:    []string{"a", "c", "d"},
-				Conditions: []Condition{
-					{Operand1: "a", Operand1IsField: true, Operator: Lt, Operand2: "1", Operand2IsField: false},
-				},
+				Where:     &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "a", Operand1IsField: true, Operator: Lt, Operand2: "1", Operand2IsField: false}},
 			},
 			Err: nil,
 		},
@@ -118,9 +118,7 @@ func TestSelectSQL(t *testing.T) {
 				Type:      Select,
 				TableName: "b",
 				Fields:    []string{"a", "c", "d"},
-				Conditions: []Condition{
-					{Operand1: "a", Operand1IsField: true, Operator: Lte, Operand2: "1", Operand2IsField: false},
-				},
+				Where:     &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "a", Operand1IsField: true, Operator: Lte, Operand2: "1", Operand2IsField: false}},
 			},
 			Err: nil,
 		},
@@ -131,9 +129,7 @@ func TestSelectSQL(t *testing.T) {
 				Type:      Select,
 				TableName: "b",
 				Fields:    []string{"a", "c", "d"},
-				Conditions: []Condition{
-					{Operand1: "a", Operand1IsField: true, Operator: Gt, Operand2: "1", Operand2IsField: false},
-				},
+				Where:     &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "a", Operand1IsField: true, Operator: Gt, Operand2: "1", Operand2IsField: false}},
 			},
 			Err: nil,
 		},
@@ -144,9 +140,7 @@ func TestSelectSQL(t *testing.T) {
 				Type:      Select,
 				TableName: "b",
 				Fields:    []string{"a", "c", "d"},
-				Conditions: []Condition{
-					{Operand1: "a", Operand1IsField: true, Operator: Gte, Operand2: "1", Operand2IsField: false},
-				},
+				Where:     &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "a", Operand1IsField: true, Operator: Gte, Operand2: "1", Operand2IsField: false}},
 			},
 			Err: nil,
 		},
@@ -157,9 +151,7 @@ func TestSelectSQL(t *testing.T) {
 				Type:      Select,
 				TableName: "b",
 				Fields:    []string{"a", "c", "d"},
-				Conditions: []Condition{
-					{Operand1: "a", Operand1IsField: true, Operator: Ne, Operand2: "1", Operand2IsField: false},
-				},
+				Where:     &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "a", Operand1IsField: true, Operator: Ne, Operand2: "1", Operand2IsField: false}},
 			},
 			Err: nil,
 		},
@@ -170,9 +162,7 @@ func TestSelectSQL(t *testing.T) {
 				Type:      Select,
 				TableName: "b",
 				Fields:    []string{"a", "c", "d"},
-				Conditions: []Condition{
-					{Operand1: "a", Operand1IsField: true, Operator: Ne, Operand2: "b", Operand2IsField: true},
-				},
+				Where:     &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "a", Operand1IsField: true, Operator: Ne, Operand2: "b", Operand2IsField: true}},
 			},
 			Err: nil,
 		},
@@ -180,10 +170,10 @@ func TestSelectSQL(t *testing.T) {
 			Name: "SELECT * works",
 			SQL:  "SELECT * FROM 'b'",
 			Expected: Query{
-				Type:       Select,
-				TableName:  "b",
-				Fields:     []string{"*"},
-				Conditions: nil,
+				Type:      Select,
+				TableName: "b",
+				Fields:    []string{"*"},
+				Where:     nil,
 			},
 			Err: nil,
 		},
@@ -191,10 +181,10 @@ func TestSelectSQL(t *testing.T) {
 			Name: "SELECT a, * works",
 			SQL:  "SELECT a, * FROM 'b'",
 			Expected: Query{
-				Type:       Select,
-				TableName:  "b",
-				Fields:     []string{"a", "*"},
-				Conditions: nil,
+				Type:      Select,
+				TableName: "b",
+				Fields:    []string{"a", "*"},
+				Where:     nil,
 			},
 			Err: nil,
 		},
@@ -205,13 +195,358 @@ func TestSelectSQL(t *testing.T) {
 				Type:      Select,
 				TableName: "b",
 				Fields:    []string{"a", "c", "d"},
-				Conditions: []Condition{
-					{Operand1: "a", Operand1IsField: true, Operator: Ne, Operand2: "1", Operand2IsField: false},
-					{Operand1: "b", Operand1IsField: true, Operator: Eq, Operand2: "2", Operand2IsField: false},
+				Where: &Expression{
+					Type:  AndExpression,
+					Left:  &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "a", Operand1IsField: true, Operator: Ne, Operand2: "1", Operand2IsField: false}},
+					Right: &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "b", Operand1IsField: true, Operator: Eq, Operand2: "2", Operand2IsField: false}},
+				},
+			},
+			Err: nil,
+		},
+		{
+			Name: "SELECT with ORDER BY works",
+			SQL:  "SELECT a, b FROM 'c' ORDER BY a, b DESC, d ASC NULLS FIRST, e DESC NULLS LAST",
+			Expected: Query{
+				Type:      Select,
+				TableName: "c",
+				Fields:    []string{"a", "b"},
+				OrderBy: []OrderField{
+					{Field: "a"},
+					{Field: "b", Desc: true, NullsFirst: true},
+					{Field: "d", NullsFirst: true},
+					{Field: "e", Desc: true},
+				},
+			},
+			Err: nil,
+		},
+		{
+			Name: "SELECT with WHERE and ORDER BY works",
+			SQL:  "SELECT a FROM 'b' WHERE a > '1' order by a desc",
+			Expected: Query{
+				Type:      Select,
+				TableName: "b",
+				Fields:    []string{"a"},
+				Where:     &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "a", Operand1IsField: true, Operator: Gt, Operand2: "1"}},
+				OrderBy:   []OrderField{{Field: "a", Desc: true, NullsFirst: true}},
+			},
+			Err: nil,
+		},
+		{
+			Name:     "SELECT with ORDER BY without field fails",
+			SQL:      "SELECT a FROM 'b' ORDER BY",
+			Expected: Query{Type: Select, TableName: "b", Fields: []string{"a"}},
+			Err:      fmt.Errorf("at ORDER BY: expected field to order by"),
+		},
+		{
+			Name:     "SELECT with ORDER BY fields without comma fails",
+			SQL:      "SELECT a FROM 'b' ORDER BY a b",
+			Expected: Query{Type: Select, TableName: "b", Fields: []string{"a"}, OrderBy: []OrderField{{Field: "a"}}},
+			Err:      fmt.Errorf("at ORDER BY: expected comma"),
+		},
+		{
+			Name: "SELECT with aggregates, GROUP BY and HAVING works",
+			SQL:  "SELECT city, count(*) AS n, SUM(age) FROM 'people' WHERE age > 1 GROUP BY city HAVING COUNT(*) > 2 AND MAX(age) != n ORDER BY n DESC",
+			Expected: Query{
+				Type:      Select,
+				TableName: "people",
+				Fields:    []string{"city", "COUNT(*)", "SUM(age)"},
+				Aliases:   map[string]string{"COUNT(*)": "n"},
+				Aggregates: map[string]Aggregate{
+					"COUNT(*)": {Func: Count, Field: "*"},
+					"SUM(age)": {Func: Sum, Field: "age"},
+					"MAX(age)": {Func: Max, Field: "age"},
+				},
+				Where:   &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "age", Operand1IsField: true, Operator: Gt, Operand2: "1", Operand2Kind: IntValue}},
+				GroupBy: []string{"city"},
+				Having: &Expression{
+					Type:  AndExpression,
+					Left:  &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "COUNT(*)", Operand1IsField: true, Operator: Gt, Operand2: "2", Operand2Kind: IntValue}},
+					Right: &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "MAX(age)", Operand1IsField: true, Operator: Ne, Operand2: "n", Operand2IsField: true}},
+				},
+				OrderBy: []OrderField{{Field: "n", Desc: true, NullsFirst: true}},
+			},
+			Err: nil,
+		},
+		{
+			Name: "SELECT with GROUP BY on several fields and ORDER BY aggregate works",
+			SQL:  "SELECT a, b FROM 'c' GROUP BY a, b ORDER BY MIN(d) LIMIT 1",
+			Expected: Query{
+				Type:       Select,
+				TableName:  "c",
+				Fields:     []string{"a", "b"},
+				Aggregates: map[string]Aggregate{"MIN(d)": {Func: Min, Field: "d"}},
+				GroupBy:    []string{"a", "b"},
+				OrderBy:    []OrderField{{Field: "MIN(d)"}},
+				Limit:      limit(1),
+			},
+			Err: nil,
+		},
+		{
+			Name:     "SELECT with SUM(*) fails",
+			SQL:      "SELECT SUM(*) FROM 'a'",
+			Expected: Query{Type: Select},
+			Err:      fmt.Errorf("at SELECT: expected field to aggregate"),
+		},
+		{
+			Name:     "SELECT with unclosed aggregate fails",
+			SQL:      "SELECT COUNT(a FROM 'a'",
+			Expected: Query{Type: Select},
+			Err:      fmt.Errorf("at SELECT: expected closing parens"),
+		},
+		{
+			Name:     "WHERE with aggregate fails",
+			SQL:      "SELECT a FROM 'b' WHERE COUNT(a) > 1",
+			Expected: Query{Type: Select, TableName: "b", Fields: []string{"a"}},
+			Err:      fmt.Errorf("at WHERE: aggregate functions are not allowed"),
+		},
+		{
+			Name:     "GROUP BY after ORDER BY fails",
+			SQL:      "SELECT a FROM 'b' ORDER BY a GROUP BY a",
+			Expected: Query{Type: Select, TableName: "b", Fields: []string{"a"}, OrderBy: []OrderField{{Field: "a"}}},
+			Err:      fmt.Errorf("at ORDER BY: expected comma"),
+		},
+		{
+			Name:     "GROUP BY without field fails",
+			SQL:      "SELECT a FROM 'b' GROUP BY",
+			Expected: Query{Type: Select, TableName: "b", Fields: []string{"a"}},
+			Err:      fmt.Errorf("at GROUP BY: expected field to group by"),
+		},
+		{
+			Name:     "HAVING with placeholder fails",
+			SQL:      "SELECT a FROM 'b' GROUP BY a HAVING COUNT(*) > ?",
+			Expected: Query{Type: Select, TableName: "b", Fields: []string{"a"}, GroupBy: []string{"a"}, Aggregates: map[string]Aggregate{"COUNT(*)": {Func: Count, Field: "*"}}},
+			Err:      fmt.Errorf("at HAVING: expected value"),
+		},
+		{
+			Name: "SELECT with JOIN and LEFT JOIN works",
+			SQL:  "SELECT p.name, o.* FROM 'people' AS p JOIN 'orders' AS o ON o.person = p.id LEFT OUTER JOIN 'items' ON item = id AND qty > 1 WHERE o.qty > 2",
+			Expected: Query{
+				Type:       Select,
+				TableName:  "people",
+				TableAlias: "p",
+				Fields:     []string{"p.name", "o.*"},
+				Joins: []Join{
+					{Type: InnerJoin, TableName: "orders", Alias: "o", On: &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "o.person", Operand1IsField: true, Operator: Eq, Operand2: "p.id", Operand2IsField: true}}},
+					{Type: LeftJoin, TableName: "items", On: &Expression{Type: AndExpression, Left: &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "item", Operand1IsField: true, Operator: Eq, Operand2: "id", Operand2IsField: true}},
+						Right: &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "qty", Operand1IsField: true, Operator: Gt, Operand2: "1", Operand2Kind: IntValue}}}},
+				},
+				Where: &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "o.qty", Operand1IsField: true, Operator: Gt, Operand2: "2", Operand2Kind: IntValue}},
+			},
+			Err: nil,
+		},
+		{
+			Name: "SELECT with unquoted JOIN table works",
+			SQL:  "SELECT a FROM people JOIN orders AS o ON o.person = id",
+			Expected: Query{
+				Type:      Select,
+				TableName: "people",
+				Fields:    []string{"a"},
+				Joins: []Join{
+					{Type: InnerJoin, TableName: "orders", Alias: "o", On: &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "o.person", Operand1IsField: true, Operator: Eq, Operand2: "id", Operand2IsField: true}}},
 				},
 			},
 			Err: nil,
 		},
+		{
+			Name: "SELECT with table aliases without AS works",
+			SQL:  "SELECT x.a FROM 'people' x JOIN orders o ON o.person = x.id LEFT JOIN 'items' ON item = id LIMIT 2",
+			Expected: Query{
+				Type:       Select,
+				TableName:  "people",
+				TableAlias: "x",
+				Fields:     []string{"x.a"},
+				Joins: []Join{
+					{Type: InnerJoin, TableName: "orders", Alias: "o", On: &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "o.person", Operand1IsField: true, Operator: Eq, Operand2: "x.id", Operand2IsField: true}}},
+					{Type: LeftJoin, TableName: "items", On: &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "item", Operand1IsField: true, Operator: Eq, Operand2: "id", Operand2IsField: true}}},
+				},
+				Limit: limit(2),
+			},
+			Err: nil,
+		},
+		{
+			Name:     "JOIN without ON fails",
+			SQL:      "SELECT a FROM 'b' INNER JOIN 'c' WHERE a = 1",
+			Expected: Query{},
+			Err:      fmt.Errorf("at JOIN: expected ON"),
+		},
+		{
+			Name:     "JOIN without table fails",
+			SQL:      "SELECT a FROM 'b' LEFT JOIN",
+			Expected: Query{},
+			Err:      fmt.Errorf("at JOIN: expected quoted table name"),
+		},
+		{
+			Name:     "ON with aggregate fails",
+			SQL:      "SELECT a FROM 'b' JOIN 'c' ON MAX(a) = b",
+			Expected: Query{},
+			Err:      fmt.Errorf("at ON: aggregate functions are not allowed"),
+		},
+		{
+			Name: "SELECT with LIMIT works",
+			SQL:  "SELECT a FROM 'b' LIMIT 10",
+			Expected: Query{
+				Type:      Select,
+				TableName: "b",
+				Fields:    []string{"a"},
+				Limit:     limit(10),
+			},
+			Err: nil,
+		},
+		{
+			Name: "SELECT with WHERE, ORDER BY, LIMIT and OFFSET works",
+			SQL:  "SELECT a FROM 'b' WHERE a = '1' ORDER BY a DESC LIMIT 0 OFFSET 20",
+			Expected: Query{
+				Type:      Select,
+				TableName: "b",
+				Fields:    []string{"a"},
+				Where:     &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "a", Operand1IsField: true, Operator: Eq, Operand2: "1"}},
+				OrderBy:   []OrderField{{Field: "a", Desc: true, NullsFirst: true}},
+				Limit:     limit(0),
+				Offset:    20,
+			},
+			Err: nil,
+		},
+		{
+			Name:     "SELECT with negative LIMIT fails",
+			SQL:      "SELECT a FROM 'b' LIMIT -1",
+			Expected: Query{Type: Select, TableName: "b", Fields: []string{"a"}},
+			Err:      fmt.Errorf("at LIMIT: expected number of rows"),
+		},
+		{
+			Name:     "SELECT with OFFSET without number fails",
+			SQL:      "SELECT a FROM 'b' LIMIT 1 OFFSET",
+			Expected: Query{Type: Select, TableName: "b", Fields: []string{"a"}, Limit: limit(1)},
+			Err:      fmt.Errorf("at OFFSET: expected number of rows"),
+		},
+		{
+			Name:     "SELECT with OFFSET without LIMIT fails",
+			SQL:      "SELECT a FROM 'b' OFFSET 1",
+			Expected: Query{Type: Select, TableName: "b", Fields: []string{"a"}},
+			Err:      fmt.Errorf("expected WHERE"),
+		},
+	}
+
+	for _, tc := range ts {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual, err := ParseMany([]string{tc.SQL})
+			if tc.Err != nil && err == nil {
+				t.Errorf("Error should have been %v", tc.Err)
+			}
+			if tc.Err == nil && err != nil {
+				t.Errorf("Error should have been nil but was %v", err)
+			}
+			if tc.Err != nil && err != nil {
+				require.Equal(t, tc.Err, err, "Unexpected error")
+			}
+			if len(actual) > 0 {
+				require.Equal(t, tc.Expected, actual[0], "Query didn't match expectation")
+			}
+		})
+	}
+}
+
+func TestWhereExpressionSQL(t *testing.T) {
+	cond := func(field string, op Operator, value string) *Expression {
+		return &Expression{Type: ConditionExpression, Condition: Condition{Operand1: field, Operand1IsField: true, Operator: op, Operand2: value}}
+	}
+	ts := []testCase{
+		{
+			Name: "WHERE with OR works",
+			SQL:  "SELECT a FROM 'b' WHERE a = '1' OR b = '2'",
+			Expected: Query{
+				Type:      Select,
+				TableName: "b",
+				Fields:    []string{"a"},
+				Where:     &Expression{Type: OrExpression, Left: cond("a", Eq, "1"), Right: cond("b", Eq, "2")},
+			},
+			Err: nil,
+		},
+		{
+			Name: "WHERE AND binds tighter than OR",
+			SQL:  "SELECT a FROM 'b' WHERE a = '1' OR b > '2' AND c = 'x'",
+			Expected: Query{
+				Type:      Select,
+				TableName: "b",
+				Fields:    []string{"a"},
+				Where: &Expression{Type: OrExpression, Left: cond("a", Eq, "1"),
+					Right: &Expression{Type: AndExpression, Left: cond("b", Gt, "2"), Right: cond("c", Eq, "x")}},
+			},
+			Err: nil,
+		},
+		{
+			Name: "WHERE with parens and NOT works",
+			SQL:  "SELECT a FROM 'b' WHERE a = '1' OR (b > '2' AND NOT c = 'x')",
+			Expected: Query{
+				Type:      Select,
+				TableName: "b",
+				Fields:    []string{"a"},
+				Where: &Expression{Type: OrExpression, Left: cond("a", Eq, "1"),
+					Right: &Expression{Type: AndExpression, Left: cond("b", Gt, "2"),
+						Right: &Expression{Type: NotExpression, Left: cond("c", Eq, "x")}}},
+			},
+			Err: nil,
+		},
+		{
+			Name: "WHERE with parens overriding precedence works",
+			SQL:  "DELETE FROM 'b' WHERE (a = '1' or b = '2') and not (c = '3')",
+			Expected: Query{
+				Type:      Delete,
+				TableName: "b",
+				Where: &Expression{Type: AndExpression,
+					Left:  &Expression{Type: OrExpression, Left: cond("a", Eq, "1"), Right: cond("b", Eq, "2")},
+					Right: &Expression{Type: NotExpression, Left: cond("c", Eq, "3")}},
+			},
+			Err: nil,
+		},
+		{
+			Name: "WHERE fields starting with reserved words work",
+			SQL:  "SELECT order_id FROM 'b' WHERE order_id = '1' AND notes = android",
+			Expected: Query{
+				Type:      Select,
+				TableName: "b",
+				Fields:    []string{"order_id"},
+				Where: &Expression{Type: AndExpression, Left: cond("order_id", Eq, "1"),
+					Right: &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "notes", Operand1IsField: true, Operator: Eq, Operand2: "android", Operand2IsField: true}}},
+			},
+			Err: nil,
+		},
+		{
+			Name: "WHERE with IS NULL, IS NOT NULL and NULL works",
+			SQL:  "SELECT a FROM 'b' WHERE a IS NULL OR b IS NOT NULL AND c = NULL",
+			Expected: Query{
+				Type:      Select,
+				TableName: "b",
+				Fields:    []string{"a"},
+				Where: &Expression{Type: OrExpression, Left: cond("a", IsNull, ""),
+					Right: &Expression{Type: AndExpression, Left: cond("b", IsNotNull, ""),
+						Right: &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "c", Operand1IsField: true, Operator: Eq, Operand2Kind: NullValue}}}},
+			},
+			Err: nil,
+		},
+		{
+			Name:     "WHERE with unclosed parens fails",
+			SQL:      "SELECT a FROM 'b' WHERE (a = '1' OR b = '2'",
+			Expected: Query{},
+			Err:      fmt.Errorf("at WHERE: expected closing parens"),
+		},
+		{
+			Name:     "WHERE with dangling OR fails",
+			SQL:      "SELECT a FROM 'b' WHERE a = '1' OR",
+			Expected: Query{},
+			Err:      fmt.Errorf("at WHERE: expected field"),
+		},
+		{
+			Name:     "WHERE with operator and no value fails",
+			SQL:      "SELECT a FROM 'b' WHERE a =",
+			Expected: Query{},
+			Err:      fmt.Errorf("at WHERE: expected value"),
+		},
+		{
+			Name:     "WHERE with conditions not joined fails",
+			SQL:      "SELECT a FROM 'b' WHERE a = '1' b = '2'",
+			Expected: Query{},
+			Err:      fmt.Errorf("at WHERE: unexpected token after condition"),
+		},
 	}
 
 	for _, tc := range ts {
@@ -263,7 +598,7 @@ func TestUpdateSQL(t *testing.T) {
 			Name:     "Incomplete UPDATE with table name, SET with a field and = but no value and WHERE fails",
 			SQL:      "UPDATE 'a' SET b = WHERE",
 			Expected: Query{},
-			Err:      fmt.Errorf("at UPDATE: expected quoted value"),
+			Err:      fmt.Errorf("at UPDATE: expected value"),
 		},
 		{
 			Name:     "Incomplete UPDATE due to no WHERE clause fails",
@@ -283,23 +618,36 @@ func TestUpdateSQL(t *testing.T) {
 			Expected: Query{
 				Type:      Update,
 				TableName: "a",
-				Updates:   map[string]string{"b": "hello"},
-				Conditions: []Condition{
-					{Operand1: "a", Operand1IsField: true, Operator: Eq, Operand2: "1", Operand2IsField: false},
-				},
+				Updates:   map[string]Value{"b": {Text: "hello"}},
+				Where:     &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "a", Operand1IsField: true, Operator: Eq, Operand2: "1", Operand2IsField: false}},
 			},
 			Err: nil,
 		},
 		{
-			Name: "UPDATE works with simple quote inside",
-			SQL:  "UPDATE 'a' SET b = 'hello\\'world' WHERE a = '1'",
+			Name:     "UPDATE works with simple quote inside",
+			SQL:      "UPDATE 'a' SET b = 'hello\\'world' WHERE a = '1'",
+			Expected: Query{},
+			Err:      fmt.Errorf("quotes inside strings are written twice, a backslash does not escape them"),
+		},
+		{
+			Name: "UPDATE works with doubled quote inside",
+			SQL:  "UPDATE 'a' SET b = 'hello''world' WHERE a = '1'",
 			Expected: Query{
 				Type:      Update,
 				TableName: "a",
-				Updates:   map[string]string{"b": "hello\\'world"},
-				Conditions: []Condition{
-					{Operand1: "a", Operand1IsField: true, Operator: Eq, Operand2: "1", Operand2IsField: false},
-				},
+				Updates:   map[string]Value{"b": {Text: "hello'world"}},
+				Where:     &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "a", Operand1IsField: true, Operator: Eq, Operand2: "1", Operand2IsField: false}},
+			},
+			Err: nil,
+		},
+		{
+			Name: "UPDATE with NULL works",
+			SQL:  "UPDATE 'a' SET b = NULL WHERE a = '1'",
+			Expected: Query{
+				Type:      Update,
+				TableName: "a",
+				Updates:   map[string]Value{"b": {Kind: NullValue}},
+				Where:     &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "a", Operand1IsField: true, Operator: Eq, Operand2: "1", Operand2IsField: false}},
 			},
 			Err: nil,
 		},
@@ -309,10 +657,8 @@ func TestUpdateSQL(t *testing.T) {
 			Expected: Query{
 				Type:      Update,
 				TableName: "a",
-				Updates:   map[string]string{"b": "hello", "c": "bye"},
-				Conditions: []Condition{
-					{Operand1: "a", Operand1IsField: true, Operator: Eq, Operand2: "1", Operand2IsField: false},
-				},
+				Updates:   map[string]Value{"b": {Text: "hello"}, "c": {Text: "bye"}},
+				Where:     &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "a", Operand1IsField: true, Operator: Eq, Operand2: "1", Operand2IsField: false}},
 			},
 			Err: nil,
 		},
@@ -322,10 +668,11 @@ func TestUpdateSQL(t *testing.T) {
 			Expected: Query{
 				Type:      Update,
 				TableName: "a",
-				Updates:   map[string]string{"b": "hello", "c": "bye"},
-				Conditions: []Condition{
-					{Operand1: "a", Operand1IsField: true, Operator: Eq, Operand2: "1", Operand2IsField: false},
-					{Operand1: "b", Operand1IsField: true, Operator: Eq, Operand2: "789", Operand2IsField: false},
+				Updates:   map[string]Value{"b": {Text: "hello"}, "c": {Text: "bye"}},
+				Where: &Expression{
+					Type:  AndExpression,
+					Left:  &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "a", Operand1IsField: true, Operator: Eq, Operand2: "1", Operand2IsField: false}},
+					Right: &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "b", Operand1IsField: true, Operator: Eq, Operand2: "789", Operand2IsField: false}},
 				},
 			},
 			Err: nil,
@@ -383,9 +730,7 @@ func TestDeleteSQL(t *testing.T) {
 			Expected: Query{
 				Type:      Delete,
 				TableName: "a",
-				Conditions: []Condition{
-					{Operand1: "b", Operand1IsField: true, Operator: Eq, Operand2: "1", Operand2IsField: false},
-				},
+				Where:     &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "b", Operand1IsField: true, Operator: Eq, Operand2: "1", Operand2IsField: false}},
 			},
 			Err: nil,
 		},
@@ -461,7 +806,29 @@ func TestInsertSQL(t *testing.T) {
 				Type:      Insert,
 				TableName: "a",
 				Fields:    []string{"b"},
-				Inserts:   [][]string{{"1"}},
+				Inserts:   [][]Value{{{Text: "1"}}},
+			},
+			Err: nil,
+		},
+		{
+			Name: "INSERT with NULL works",
+			SQL:  "INSERT INTO 'a' (b, c) VALUES (NULL, '1'), ('2', null)",
+			Expected: Query{
+				Type:      Insert,
+				TableName: "a",
+				Fields:    []string{"b", "c"},
+				Inserts:   [][]Value{{{Kind: NullValue}, {Text: "1"}}, {{Text: "2"}, {Kind: NullValue}}},
+			},
+			Err: nil,
+		},
+		{
+			Name: "INSERT with unquoted literals works",
+			SQL:  "INSERT INTO 'a' (b, c, d, e) VALUES (1, -2.5, true, 'it''s')",
+			Expected: Query{
+				Type:      Insert,
+				TableName: "a",
+				Fields:    []string{"b", "c", "d", "e"},
+				Inserts:   [][]Value{{{Kind: IntValue, Text: "1"}, {Kind: FloatValue, Text: "-2.5"}, {Kind: BoolValue, Text: "true"}, {Text: "it's"}}},
 			},
 			Err: nil,
 		},
@@ -478,7 +845,7 @@ func TestInsertSQL(t *testing.T) {
 				Type:      Insert,
 				TableName: "a",
 				Fields:    []string{"b", "c", "d"},
-				Inserts:   [][]string{{"1", "2", "3"}},
+				Inserts:   [][]Value{{{Text: "1"}, {Text: "2"}, {Text: "3"}}},
 			},
 			Err: nil,
 		},
@@ -489,10 +856,88 @@ func TestInsertSQL(t *testing.T) {
 				Type:      Insert,
 				TableName: "a",
 				Fields:    []string{"b", "c", "d"},
-				Inserts:   [][]string{{"1", "2", "3"}, {"4", "5", "6"}},
+				Inserts:   [][]Value{{{Text: "1"}, {Text: "2"}, {Text: "3"}}, {{Text: "4"}, {Text: "5"}, {Text: "6"}}},
+			},
+			Err: nil,
+		},
+	}
+
+	for _, tc := range ts {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual, err := ParseMany([]string{tc.SQL})
+			if tc.Err != nil && err == nil {
+				t.Errorf("Error should have been %v", tc.Err)
+			}
+			if tc.Err == nil && err != nil {
+				t.Errorf("Error should have been nil but was %v", err)
+			}
+			if tc.Err != nil && err != nil {
+				require.Equal(t, tc.Err, err, "Unexpected error")
+			}
+			if len(actual) > 0 {
+				require.Equal(t, tc.Expected, actual[0], "Query didn't match expectation")
+			}
+		})
+	}
+}
+
+func TestPlaceholderSQL(t *testing.T) {
+	ts := []testCase{
+		{
+			Name: "INSERT with ? placeholders works",
+			SQL:  "INSERT INTO 'a' (b,c) VALUES (?, '2'),('3', ?)",
+			Expected: Query{
+				Type:      Insert,
+				TableName: "a",
+				Fields:    []string{"b", "c"},
+				Inserts:   [][]Value{{{Text: ""}, {Text: "2"}}, {{Text: "3"}, {Text: ""}}},
+				Params: []Param{
+					{Number: 1, Kind: ParamInsert, Row: 0, Column: 0},
+					{Number: 2, Kind: ParamInsert, Row: 1, Column: 1},
+				},
+			},
+			Err: nil,
+		},
+		{
+			Name: "UPDATE with $N placeholders works",
+			SQL:  "UPDATE 'a' SET b = $2 WHERE a = $1 AND c = '?'",
+			Expected: Query{
+				Type:      Update,
+				TableName: "a",
+				Updates:   map[string]Value{"b": {Text: ""}},
+				Where: &Expression{Type: AndExpression,
+					Left:  &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "a", Operand1IsField: true, Operator: Eq}},
+					Right: &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "c", Operand1IsField: true, Operator: Eq, Operand2: "?"}}},
+				Params: []Param{
+					{Number: 2, Kind: ParamUpdate, Field: "b"},
+					{Number: 1, Kind: ParamWhere, Condition: 0},
+				},
+			},
+			Err: nil,
+		},
+		{
+			Name: "? after $N takes the next number",
+			SQL:  "SELECT a FROM 'b' WHERE a = $2 OR b = ?",
+			Expected: Query{
+				Type:      Select,
+				TableName: "b",
+				Fields:    []string{"a"},
+				Where: &Expression{Type: OrExpression,
+					Left:  &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "a", Operand1IsField: true, Operator: Eq}},
+					Right: &Expression{Type: ConditionExpression, Condition: Condition{Operand1: "b", Operand1IsField: true, Operator: Eq}}},
+				Params: []Param{
+					{Number: 2, Kind: ParamWhere, Condition: 0},
+					{Number: 3, Kind: ParamWhere, Condition: 1},
+				},
 			},
 			Err: nil,
 		},
+		{
+			Name:     "$ without number fails",
+			SQL:      "INSERT INTO 'a' (b) VALUES ($)",
+			Expected: Query{},
+			Err:      fmt.Errorf("at INSERT INTO: expected value"),
+		},
 	}
 
 	for _, tc := range ts {
@@ -560,6 +1005,16 @@ func TestCreateSQL(t *testing.T) {
 			},
 			Err: nil,
 		},
+		{
+			Name: "CREATE with fields named like types and clauses",
+			SQL:  "CREATE TABLE 'b' (date date, text Text, limit integer, on decimal(4, 2))",
+			Expected: Query{
+				Type:              Create,
+				TableName:         "b",
+				TableConstruction: [][]string{{"date", "DATE"}, {"text", "TEXT"}, {"limit", "INTEGER"}, {"on", "DECIMAL", "4", "2"}},
+			},
+			Err: nil,
+		},
 		{
 			Name: "CREATE with valid field and datatype with constraints",
 			SQL:  "CREATE TABLE 'b' (ID int Primary Key)",
@@ -590,6 +1045,32 @@ func TestCreateSQL(t *testing.T) {
 			},
 			Err: nil,
 		},
+		{
+			Name: "CREATE DECIMAL with and without scale",
+			SQL:  "CREATE TABLE 'money' (amount decimal(10, 2) Primary Key, whole decimal(5))",
+			Expected: Query{
+				Type:              Create,
+				TableName:         "money",
+				TableConstruction: [][]string{{"amount", "DECIMAL", "10", "2", "PRIMARY KEY"}, {"whole", "DECIMAL", "5", "0"}},
+			},
+			Err: nil,
+		},
+		{
+			Name: "CREATE integer widths, unsigned and aliases",
+			SQL:  "CREATE TABLE 'c' (a bigint Primary Key, b tinyint unsigned, c integer)",
+			Expected: Query{
+				Type:              Create,
+				TableName:         "c",
+				TableConstruction: [][]string{{"a", "INT", "PRIMARY KEY"}, {"b", "TINYINT UNSIGNED"}, {"c", "INTEGER"}},
+			},
+			Err: nil,
+		},
+		{
+			Name:     "CREATE scale on a type other than DECIMAL fails",
+			SQL:      "CREATE TABLE 'money' (name char(10, 2))",
+			Expected: Query{Type: Create, TableName: "money", TableConstruction: [][]string{{"name", "CHAR", "10"}}},
+			Err:      fmt.Errorf("at CREATE TABLE: expected closing parens for size value"),
+		},
 	}
 
 	for _, tc := range ts {
@@ -637,6 +1118,111 @@ func TestDropSQL(t *testing.T) {
 			},
 			Err: nil,
 		},
+		{
+			Name: "DROP TABLE IF EXISTS",
+			SQL:  "DROP TABLE if exists 'mytable'",
+			Expected: Query{
+				Type:      Drop,
+				TableName: "mytable",
+				IfExists:  true,
+			},
+			Err: nil,
+		},
+		{
+			Name:     "DROP TABLE IF EXISTS without table fails",
+			SQL:      "DROP TABLE IF EXISTS",
+			Expected: Query{},
+			Err:      fmt.Errorf("table name cannot be empty"),
+		},
+	}
+
+	for _, tc := range ts {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual, err := ParseMany([]string{tc.SQL})
+			if tc.Err != nil && err == nil {
+				t.Errorf("Error should have been %v", tc.Err)
+			}
+			if tc.Err == nil && err != nil {
+				t.Errorf("Error should have been nil but was %v", err)
+			}
+			if tc.Err != nil && err != nil {
+				require.Equal(t, tc.Err, err, "Unexpected error")
+			}
+			if len(actual) > 0 {
+				require.Equal(t, tc.Expected, actual[0], "Query didn't match expectation")
+			}
+		})
+	}
+}
+
+func TestIndexSQL(t *testing.T) {
+	ts := []testCase{
+		{
+			Name: "CREATE INDEX on one field",
+			SQL:  "CREATE INDEX by_name ON 'users' (name)",
+			Expected: Query{
+				Type:      CreateIndex,
+				TableName: "users",
+				IndexName: "by_name",
+				Fields:    []string{"name"},
+			},
+			Err: nil,
+		},
+		{
+			Name: "CREATE UNIQUE INDEX on many fields",
+			SQL:  "create unique index by_name_age ON 'users' (name, age)",
+			Expected: Query{
+				Type:      CreateIndex,
+				TableName: "users",
+				IndexName: "by_name_age",
+				Fields:    []string{"name", "age"},
+				Unique:    true,
+			},
+			Err: nil,
+		},
+		{
+			Name:     "CREATE INDEX without ON fails",
+			SQL:      "CREATE INDEX by_name 'users' (name)",
+			Expected: Query{Type: CreateIndex, IndexName: "by_name"},
+			Err:      fmt.Errorf("at CREATE INDEX: expected ON"),
+		},
+		{
+			Name:     "CREATE INDEX without fields fails",
+			SQL:      "CREATE INDEX by_name ON 'users' ()",
+			Expected: Query{Type: CreateIndex, IndexName: "by_name", TableName: "users"},
+			Err:      fmt.Errorf("at CREATE INDEX: expected field to index"),
+		},
+		{
+			Name:     "CREATE INDEX without closing parens fails",
+			SQL:      "CREATE INDEX by_name ON 'users' (name",
+			Expected: Query{Type: CreateIndex, IndexName: "by_name", TableName: "users", Fields: []string{"name"}},
+			Err:      fmt.Errorf("at CREATE INDEX: expected closing parens"),
+		},
+		{
+			Name: "DROP INDEX",
+			SQL:  "DROP INDEX by_name",
+			Expected: Query{
+				Type:      DropIndex,
+				IndexName: "by_name",
+			},
+			Err: nil,
+		},
+		{
+			Name: "DROP INDEX IF EXISTS",
+			SQL:  "DROP INDEX IF EXISTS by_name",
+			Expected: Query{
+				Type:      DropIndex,
+				IndexName: "by_name",
+				IfExists:  true,
+			},
+			Err: nil,
+		},
+		{
+			Name:     "DROP INDEX without name fails",
+			SQL:      "DROP INDEX",
+			Expected: Query{Type: DropIndex},
+			Err:      fmt.Errorf("index name cannot be empty"),
+		},
 	}
 
 	for _, tc := range ts {
@@ -4,12 +4,198 @@ package internal
 type Query struct {
 	Type              Type
 	TableName         string
-	Conditions        []Condition
-	Updates           map[string]string
-	Inserts           [][]string
+	Where             *Expression // Used for SELECT, UPDATE and DELETE, nil without WHERE clause
+	Updates           map[string]Value
+	Inserts           [][]Value
 	Fields            []string // Used for SELECT (i.e. SELECTed field names) and INSERT (INSERTEDed field names)
 	Aliases           map[string]string
 	TableConstruction [][]string //Used for CREATE
+	IfExists          bool       //Used for DROP TABLE IF EXISTS and DROP INDEX IF EXISTS
+	IndexName         string     //Used for CREATE INDEX and DROP INDEX, indexed columns are in Fields
+	Unique            bool       //Used for CREATE UNIQUE INDEX
+	Params            []Param    // ? and $N placeholders to bind before execution
+	// TableAlias is used for SELECT, the name given to TableName by AS
+	TableAlias string
+	// Joins is used for SELECT, the tables joined to TableName in order
+	Joins []Join
+	// Aggregates is used for SELECT, the aggregate functions used by its fields, HAVING and ORDER BY keyed by field name like COUNT(*)
+	Aggregates map[string]Aggregate
+	// GroupBy is used for SELECT, empty without GROUP BY clause
+	GroupBy []string
+	// Having is used for SELECT, nil without HAVING clause
+	Having *Expression
+	// OrderBy is used for SELECT, empty without ORDER BY clause
+	OrderBy []OrderField
+	// Limit is the most rows a SELECT returns, nil without LIMIT clause
+	Limit *uint64
+	// Offset is the number of rows a SELECT skips before the ones it returns
+	Offset uint64
+}
+
+// OrderField is a field of an ORDER BY clause
+type OrderField struct {
+	Field string
+	// Desc sorts from the largest value to the smallest
+	Desc bool
+	// NullsFirst puts nulls before every value, the parser defaults it to Desc so nulls sort as the largest values
+	NullsFirst bool
+}
+
+// JoinType is the kind of JOIN between tables
+type JoinType int
+
+const (
+	// InnerJoin keeps the combined rows satisfying the ON condition
+	InnerJoin JoinType = iota + 1
+	// LeftJoin also keeps the rows of the tables on its left without a match, with null columns for the joined table
+	LeftJoin
+)
+
+// Join is a table joined to the tables before it in a SELECT
+type Join struct {
+	Type      JoinType
+	TableName string
+	// Alias is the name given to the table by AS, empty without alias
+	Alias string
+	// On is the condition combined rows must satisfy
+	On *Expression
+}
+
+// AggregateFunc is an aggregate function computing one value from the rows of a group
+type AggregateFunc int
+
+const (
+	// Count counts the rows of a group or, given a field, its non null values
+	Count AggregateFunc = iota + 1
+	// Sum adds the non null values of a numeric field
+	Sum
+	// Avg is the mean of the non null values of a numeric field
+	Avg
+	// Min is the smallest non null value of a field
+	Min
+	// Max is the largest non null value of a field
+	Max
+)
+
+func (f AggregateFunc) String() string {
+	switch f {
+	case Count:
+		return "COUNT"
+	case Sum:
+		return "SUM"
+	case Avg:
+		return "AVG"
+	case Min:
+		return "MIN"
+	case Max:
+		return "MAX"
+	}
+	return "UNKNOWN"
+}
+
+// Aggregate is an aggregate function applied to a field
+type Aggregate struct {
+	Func AggregateFunc
+	// Field is the aggregated column, * for COUNT(*)
+	Field string
+}
+
+// ValueKind is the kind of a literal value
+type ValueKind int
+
+const (
+	// StringValue is a quoted literal converted to the type of the column it is used with
+	StringValue ValueKind = iota
+	// NullValue is the NULL literal
+	NullValue
+	// IntValue is an unquoted integer like 42 or -7
+	IntValue
+	// FloatValue is an unquoted number with a fraction or exponent like 2.5 or 1e-3
+	FloatValue
+	// BoolValue is TRUE or FALSE, Text is "true" or "false"
+	BoolValue
+)
+
+func (k ValueKind) String() string {
+	switch k {
+	case StringValue:
+		return "string"
+	case NullValue:
+		return "NULL"
+	case IntValue:
+		return "integer"
+	case FloatValue:
+		return "float"
+	case BoolValue:
+		return "boolean"
+	}
+	return "unknown"
+}
+
+// Value is a literal value of an INSERT row or UPDATE SET field
+type Value struct {
+	Kind ValueKind
+	// Text is the literal as written without quotes, empty for NULL
+	Text string
+}
+
+// ParamKind is the part of a query a placeholder appears in
+type ParamKind int
+
+const (
+	// ParamInsert is a value in an INSERT row
+	ParamInsert ParamKind = iota + 1
+	// ParamUpdate is the value of an UPDATE SET field
+	ParamUpdate
+	// ParamWhere is the right hand side operand of a WHERE condition
+	ParamWhere
+)
+
+// Param is the location of a placeholder whose argument is bound on execution
+type Param struct {
+	// Number is the 1-based position of the argument
+	Number int
+	Kind   ParamKind
+	// Row and Column locate a ParamInsert value in Inserts
+	Row    int
+	Column int
+	// Field is the column set by a ParamUpdate
+	Field string
+	// Condition is the index of a ParamWhere condition in Where.Conditions()
+	Condition int
+}
+
+// NumParams returns the number of arguments needed to execute the query
+func (q *Query) NumParams() int {
+	n := 0
+	for _, param := range q.Params {
+		if param.Number > n {
+			n = param.Number
+		}
+	}
+	return n
+}
+
+// clone copies everything a bound query may modify so the parsed query can be executed again
+func (q *Query) clone() Query {
+	c := *q
+	c.Inserts = make([][]Value, len(q.Inserts))
+	for i := range q.Inserts {
+		c.Inserts[i] = append([]Value{}, q.Inserts[i]...)
+	}
+	if q.Updates != nil {
+		c.Updates = make(map[string]Value, len(q.Updates))
+		for k, v := range q.Updates {
+			c.Updates[k] = v
+		}
+	}
+	c.Where = q.Where.clone()
+	c.Having = q.Having.clone()
+	c.Joins = append([]Join(nil), q.Joins...)
+	for i := range c.Joins {
+		c.Joins[i].On = q.Joins[i].On.clone()
+	}
+	return c
 }
 
 // Type is the type of SQL query, e.g. SELECT/UPDATE
@@ -30,6 +216,10 @@ const (
 	Create
 	//Drop represents a DROP query
 	Drop
+	// CreateIndex represents a CREATE [UNIQUE] INDEX query
+	CreateIndex
+	// DropIndex represents a DROP INDEX query
+	DropIndex
 )
 
 // Operator is between operands in a condition
@@ -50,6 +240,10 @@ const (
 	Gte
 	// Lte -> "<="
 	Lte
+	// IsNull -> "IS NULL", there is no right hand side operand
+	IsNull
+	// IsNotNull -> "IS NOT NULL", there is no right hand side operand
+	IsNotNull
 )
 
 // Condition is a single boolean condition in a WHERE clause
@@ -64,4 +258,65 @@ type Condition struct {
 	Operand2 string
 	// Operand2IsField determines if Operand2 is a literal or a field name
 	Operand2IsField bool
+	// Operand2Kind is the kind of a literal Operand2
+	Operand2Kind ValueKind
+}
+
+// ExpressionType is the kind of node in a WHERE expression tree
+type ExpressionType int
+
+const (
+	// UnknownExpression is the zero value for an ExpressionType
+	UnknownExpression ExpressionType = iota
+	// ConditionExpression is a leaf holding a single Condition
+	ConditionExpression
+	// AndExpression -> "AND"
+	AndExpression
+	// OrExpression -> "OR"
+	OrExpression
+	// NotExpression -> "NOT"
+	NotExpression
+)
+
+// Expression is a node of the boolean expression tree parsed from a WHERE clause
+type Expression struct {
+	Type ExpressionType
+	// Condition is the comparison of a ConditionExpression leaf
+	Condition Condition
+	// Left is the first operand of AND and OR and the only operand of NOT
+	Left *Expression
+	// Right is the second operand of AND and OR
+	Right *Expression
+}
+
+func (e *Expression) clone() *Expression {
+	if e == nil {
+		return nil
+	}
+	c := *e
+	c.Left = e.Left.clone()
+	c.Right = e.Right.clone()
+	return &c
+}
+
+// leaves returns every ConditionExpression node from left to right
+func (e *Expression) leaves() []*Expression {
+	if e == nil {
+		return nil
+	}
+	if e.Type == ConditionExpression {
+		return []*Expression{e}
+	}
+	return append(e.Left.leaves(), e.Right.leaves()...)
+}
+
+// Conditions returns every leaf condition in the tree from left to right
+func (e *Expression) Conditions() []Condition {
+	if e == nil {
+		return nil
+	}
+	if e.Type == ConditionExpression {
+		return []Condition{e.Condition}
+	}
+	return append(e.Left.Conditions(), e.Right.Conditions()...)
 }
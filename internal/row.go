@@ -3,17 +3,26 @@ package internal
 import (
 	"database/sql/driver"
 	"io"
+	"math"
+	"strconv"
 )
 
 /*
 Result from sql select statement in driver query
 Must use pointer for interface to be properly implements and allow pointer to struct
+rows are pulled from the operator tree of the query one at a time by Next, Close releases it early
 Implements driver.Rows
 */
 type Rows struct {
-	columns []ResultColumn //should be result column holding name and type
-	index   uint64
-	rows    [][]Cell //holds all the values returned from the queries which is slice of array of bytes
+	columns  []ResultColumn //should be result column holding name and type
+	source   resultIterator //root of the operator tree, rows may have hidden columns after the result ones
+	b        *Backend       //read locked while pulling rows of committed pages, nil for rows of a transaction
+	tx       *Transaction   //transaction writing the pages the rows are read from, nil for rows of committed pages
+	tables   []string       //tables the rows are read from
+	detached bool           //the rest of the rows were read into buffered before a commit changed their tables
+	buffered [][]Cell
+	err      error //error reading the buffered rows, returned after them
+	closed   bool
 }
 
 func (r *Rows) Columns() []string {
@@ -25,44 +34,141 @@ func (r *Rows) Columns() []string {
 }
 
 func (r *Rows) Close() error {
-	r.index = uint64(len(r.rows))
-	return nil
+	if r.b != nil {
+		r.b.mu.RLock()
+		defer r.b.mu.RUnlock()
+		r.b.readersMu.Lock()
+		delete(r.b.readers, r)
+		r.b.readersMu.Unlock()
+	}
+	if r.tx != nil {
+		delete(r.tx.readers, r)
+	}
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	r.buffered = nil
+	if r.detached {
+		return nil
+	}
+	return r.source.close()
 }
 
 func (r *Rows) Next(dest []driver.Value) error {
-	if r.index >= uint64(len(r.rows)) {
+	if r.closed {
 		return io.EOF
 	}
+	row, err := r.pull()
+	if err == io.EOF {
+		//the tree is released as soon as the last row was read
+		if err := r.Close(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	if err != nil {
+		return err
+	}
 
-	row := r.rows[r.index]
-
-	for idx, cell := range row {
+	for idx, cell := range row[:len(r.columns)] {
+		if cell == nil { //null column, scans into sql.Null* types or pointers
+			dest[idx] = nil
+			continue
+		}
 		typ := r.columns[idx].ColumnType
 		switch typ {
 		case INT:
-			if cell == nil {
-				dest[idx] = nil
-			}
 			dest[idx] = cell.AsInt()
-		case CHAR:
-			if cell == nil {
-				dest[idx] = nil
-			}
+		case CHAR, VARCHAR, TEXT:
 			dest[idx] = cell.AsString()
 		case FLOAT:
-			if cell == nil {
-				dest[idx] = nil
-			}
 			dest[idx] = cell.AsFloat()
 		case BOOL:
-			if cell == nil {
-				dest[idx] = nil
-			}
 			dest[idx] = cell.AsBool()
+		case BLOB:
+			dest[idx] = append([]byte{}, cell...)
+		case DATE:
+			dest[idx] = cell.AsDate()
+		case TIMESTAMP:
+			dest[idx] = cell.AsTimestamp()
+		case INTERVAL:
+			dest[idx] = int64(cell.AsInterval()) //scans into a time.Duration
+		case TINYINT, SMALLINT, INTEGER:
+			dest[idx] = cell.AsSigned()
+		case UTINYINT, USMALLINT, UINTEGER:
+			dest[idx] = int64(cell.AsUnsigned())
+		case UBIGINT:
+			//values above the int64 range are not valid driver values, their digits scan into a uint64 or string
+			if n := cell.AsUnsigned(); n <= math.MaxInt64 {
+				dest[idx] = int64(n)
+			} else {
+				dest[idx] = strconv.FormatUint(n, 10)
+			}
+		case DECIMAL:
+			dest[idx] = cell.AsDecimalString() //exact digits, scans into a string or float64
 		}
 	}
 
-	r.index++
-
 	return nil
 }
+
+func (r *Rows) pull() ([]Cell, error) {
+	if r.b != nil {
+		r.b.mu.RLock()
+		defer r.b.mu.RUnlock()
+	}
+	if !r.detached {
+		return r.source.next()
+	}
+	if len(r.buffered) == 0 {
+		if r.err != nil {
+			return nil, r.err
+		}
+		return nil, io.EOF
+	}
+	row := r.buffered[0]
+	r.buffered = r.buffered[1:]
+	return row, nil
+}
+
+// reads the rest of the rows into buffered and releases the tree before the pages they are read from change
+// rows of committed pages are detached holding the lock of the backend for writing
+func (r *Rows) detach() {
+	if r.closed || r.detached {
+		return
+	}
+	r.detached = true
+	for {
+		row, err := r.source.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			r.err = err
+			break
+		}
+		r.buffered = append(r.buffered, row)
+	}
+	if err := r.source.close(); err != nil && r.err == nil {
+		r.err = err
+	}
+}
+
+/*
+Result from sql insert statement in driver exec
+Implements driver.Result
+*/
+type Result struct {
+	lastInsertId int64
+	rowsAffected int64
+}
+
+// rowid of the last row inserted by the statement
+func (r Result) LastInsertId() (int64, error) {
+	return r.lastInsertId, nil
+}
+
+func (r Result) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
@@ -0,0 +1,308 @@
+package internal
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sort"
+)
+
+/*
+ORDER BY sorts result rows in memory while they take less than the sort memory of the database
+larger results are cut into sorted runs spilled to temporary files in the database directory
+which are merged back while the rows are read
+a run is a sequence of rows, each row is for every cell null flag (1 byte) | length (4 bytes) | cell
+*/
+type sortKey struct {
+	column     int //index of the cell in the rows being sorted
+	colType    uint8
+	desc       bool
+	nullsFirst bool
+}
+
+// cell overhead counted against the sort memory on top of the cell bytes
+const sortCellOverhead = 24
+
+// most runs merged at once, more runs are first merged in groups into longer runs so few files are open together
+const sortMergeFanIn = 64
+
+func compareRows(keys []sortKey, a, b []Cell) int {
+	for _, key := range keys {
+		l, r := a[key.column], b[key.column]
+		if l == nil || r == nil {
+			if l == nil && r == nil {
+				continue
+			}
+			if (l == nil) == key.nullsFirst {
+				return -1
+			}
+			return 1
+		}
+		cmp := compareCells(key.colType, l, key.colType, r)
+		if key.desc {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+type rowSorter struct {
+	dir    string
+	memory int
+	keys   []sortKey
+	rows   [][]Cell
+	size   int      //bytes taken by rows
+	runs   []string //files of the runs spilled so far
+}
+
+func newRowSorter(dir string, memory int, keys []sortKey) *rowSorter {
+	return &rowSorter{dir: dir, memory: memory, keys: keys, rows: make([][]Cell, 0)}
+}
+
+func (s *rowSorter) add(row []Cell) error {
+	s.rows = append(s.rows, row)
+	for _, cell := range row {
+		s.size += len(cell) + sortCellOverhead
+	}
+	if s.size > s.memory {
+		return s.spill()
+	}
+	return nil
+}
+
+func (s *rowSorter) sortRows() {
+	sort.SliceStable(s.rows, func(i, j int) bool {
+		return compareRows(s.keys, s.rows[i], s.rows[j]) < 0
+	})
+}
+
+// writes the rows held in memory to a new run
+func (s *rowSorter) spill() error {
+	s.sortRows()
+	f, err := os.CreateTemp(s.dir, "sort-*.run")
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, f.Name())
+	w := bufio.NewWriter(f)
+	for _, row := range s.rows {
+		writeRunRow(w, row)
+	}
+	if err := errors.Join(w.Flush(), f.Close()); err != nil {
+		return err
+	}
+	s.rows, s.size = make([][]Cell, 0), 0
+	return nil
+}
+
+func writeRunRow(w *bufio.Writer, row []Cell) {
+	for _, cell := range row {
+		flag := byte(1)
+		if cell == nil {
+			flag = 0
+		}
+		w.WriteByte(flag)
+		w.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(cell))))
+		w.Write(cell)
+	}
+}
+
+// mergeRuns merges runs into one new run and removes them
+func (s *rowSorter) mergeRuns(runs []string, columns int) (string, error) {
+	merged, err := openRuns(s.keys, runs, columns)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(s.dir, "sort-*.run")
+	if err != nil {
+		return "", errors.Join(err, merged.close())
+	}
+	w := bufio.NewWriter(f)
+	for {
+		row, err := merged.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", errors.Join(err, f.Close(), os.Remove(f.Name()), merged.close())
+		}
+		writeRunRow(w, row)
+	}
+	if err := errors.Join(w.Flush(), f.Close()); err != nil {
+		return "", errors.Join(err, os.Remove(f.Name()), merged.close())
+	}
+	return f.Name(), merged.close()
+}
+
+// discard removes the runs spilled when the rows are not read
+func (s *rowSorter) discard() error {
+	var err error
+	for _, name := range s.runs {
+		err = errors.Join(err, os.Remove(name))
+	}
+	s.runs, s.rows = nil, nil
+	return err
+}
+
+// sorted returns the rows added in order, rows still in memory become the last run when others were spilled
+func (s *rowSorter) sorted(columns int) (*sortedRows, error) {
+	if len(s.runs) == 0 {
+		s.sortRows()
+		return &sortedRows{keys: s.keys, rows: s.rows}, nil
+	}
+	if len(s.rows) > 0 {
+		if err := s.spill(); err != nil {
+			return nil, errors.Join(err, s.discard())
+		}
+	}
+	//runs are merged in consecutive groups so rows comparing equal keep the order they were added in
+	for len(s.runs) > sortMergeFanIn {
+		runs := make([]string, 0, len(s.runs)/sortMergeFanIn+1)
+		for i := 0; i < len(s.runs); i += sortMergeFanIn {
+			group := s.runs[i:min(i+sortMergeFanIn, len(s.runs))]
+			if len(group) == 1 {
+				runs = append(runs, group[0])
+				continue
+			}
+			name, err := s.mergeRuns(group, columns)
+			if err != nil {
+				//the group was removed while merging
+				s.runs = append(runs, s.runs[i+len(group):]...)
+				return nil, errors.Join(err, s.discard())
+			}
+			runs = append(runs, name)
+		}
+		s.runs = runs
+	}
+	sorted, err := openRuns(s.keys, s.runs, columns)
+	if err != nil {
+		s.runs = nil
+	}
+	return sorted, err
+}
+
+// openRuns opens runs to be merged, they are removed when the rows are closed or opening them fails
+func openRuns(keys []sortKey, runs []string, columns int) (*sortedRows, error) {
+	sorted := &sortedRows{keys: keys, runs: runs}
+	for i, name := range sorted.runs {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, errors.Join(err, sorted.close())
+		}
+		r := &runReader{order: i, columns: columns, file: f, reader: bufio.NewReader(f)}
+		sorted.readers = append(sorted.readers, r)
+		if err := r.advance(); err != nil {
+			return nil, errors.Join(err, sorted.close())
+		}
+		if r.row != nil {
+			sorted.merge = append(sorted.merge, r)
+		}
+	}
+	heap.Init(sorted)
+	return sorted, nil
+}
+
+// sortedRows hands out sorted rows one at a time, merging the runs through a heap of their next rows
+type sortedRows struct {
+	keys    []sortKey
+	rows    [][]Cell //rows sorted in memory when nothing was spilled
+	runs    []string
+	readers []*runReader
+	merge   []*runReader //readers which still have rows
+}
+
+func (s *sortedRows) Len() int { return len(s.merge) }
+func (s *sortedRows) Less(i, j int) bool {
+	cmp := compareRows(s.keys, s.merge[i].row, s.merge[j].row)
+	if cmp == 0 {
+		return s.merge[i].order < s.merge[j].order
+	}
+	return cmp < 0
+}
+func (s *sortedRows) Swap(i, j int) { s.merge[i], s.merge[j] = s.merge[j], s.merge[i] }
+func (s *sortedRows) Push(x any)    { s.merge = append(s.merge, x.(*runReader)) }
+func (s *sortedRows) Pop() any {
+	r := s.merge[len(s.merge)-1]
+	s.merge = s.merge[:len(s.merge)-1]
+	return r
+}
+
+// next returns the next row in order or io.EOF once every row was returned
+func (s *sortedRows) next() ([]Cell, error) {
+	if s.readers == nil {
+		if len(s.rows) == 0 {
+			return nil, io.EOF
+		}
+		row := s.rows[0]
+		s.rows = s.rows[1:]
+		return row, nil
+	}
+	if len(s.merge) == 0 {
+		return nil, io.EOF
+	}
+	r := s.merge[0]
+	row := r.row
+	if err := r.advance(); err != nil {
+		return nil, err
+	}
+	if r.row == nil {
+		heap.Pop(s)
+	} else {
+		heap.Fix(s, 0)
+	}
+	return row, nil
+}
+
+// close removes the spilled runs
+func (s *sortedRows) close() error {
+	var err error
+	for _, r := range s.readers {
+		err = errors.Join(err, r.file.Close())
+	}
+	for _, name := range s.runs {
+		err = errors.Join(err, os.Remove(name))
+	}
+	s.readers, s.runs, s.merge, s.rows = nil, nil, nil, nil
+	return err
+}
+
+// reads rows back from a run, row holds the next row of the run and is nil once the run is done
+type runReader struct {
+	order   int //rows comparing equal are merged in the order their runs were spilled to keep the sort stable
+	columns int
+	file    *os.File
+	reader  *bufio.Reader
+	row     []Cell
+}
+
+func (r *runReader) advance() error {
+	r.row = make([]Cell, r.columns)
+	for i := range r.row {
+		flag, err := r.reader.ReadByte()
+		if err == io.EOF && i == 0 {
+			r.row = nil
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(r.reader, header); err != nil {
+			return err
+		}
+		if flag == 0 {
+			continue
+		}
+		r.row[i] = make(Cell, binary.LittleEndian.Uint32(header))
+		if _, err := io.ReadFull(r.reader, r.row[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -10,13 +10,17 @@ import (
 TableName must be checked to be within 2 bytes range
 ColumnNames must have length within 1 byte range
 Columns slice must preserve order
+a row is the null bitset, the fixed part holding every column at its offset and the VARCHAR, TEXT and BLOB values
+a VARCHAR, TEXT or BLOB column holds offset (4 bytes) | length (4 bytes) of its value from the start of the row
+in a stored row the top bit of the length marks a value moved to overflow pages (see overflow.go)
 */
 type Table struct {
 	Columns       []Column
 	Name          string
 	lastRowId     int64
-	rowEmptyBytes uint64 //dynamic at runtime
-	lastPage      uint64 //dynamic at runtime
+	rowEmptyBytes uint64  //dynamic at runtime
+	treePages             //dynamic at runtime
+	indexes       []Index //secondary indexes, saved in the catalog after the tables
 }
 
 func (t *Table) toBytes() []byte {
@@ -31,10 +35,14 @@ func (t *Table) toBytes() []byte {
 	for i := 0; i < len(t.Columns); i++ {
 		buf = append(buf, t.Columns[i].columnConstraint)  //one byte for type of column it is
 		buf = append(buf, uint8(t.Columns[i].columnType)) //will be one byte since values between 0-255
-		buf = append(buf, t.Columns[i].columnSize)        //one byte for column size field
-		tempbytes := []byte(t.Columns[i].columnName)      //column name converted to bytes
-		buf = append(buf, byte(len(tempbytes)))           //1 byte for column name length
-		buf = append(buf, tempbytes...)                   //column name in bytes appended
+		//two bytes for column size field
+		buf = binary.LittleEndian.AppendUint16(buf, t.Columns[i].columnSize)
+		if t.Columns[i].columnType == DECIMAL {
+			buf = append(buf, t.Columns[i].precision, t.Columns[i].scale)
+		}
+		tempbytes := []byte(t.Columns[i].columnName) //column name converted to bytes
+		buf = append(buf, byte(len(tempbytes)))      //1 byte for column name length
+		buf = append(buf, tempbytes...)              //column name in bytes appended
 	}
 	return buf
 }
@@ -57,8 +65,12 @@ func fromBytes(buf []byte) Table {
 		newColumn.columnType = buf[byteIndex]
 		byteIndex += 1
 
-		columnSize := buf[byteIndex] //size of column in database in bytes
-		byteIndex += 1
+		columnSize := binary.LittleEndian.Uint16(buf[byteIndex : byteIndex+2]) //size of column in database in bytes
+		byteIndex += 2
+		if newColumn.columnType == DECIMAL {
+			newColumn.precision, newColumn.scale = buf[byteIndex], buf[byteIndex+1]
+			byteIndex += 2
+		}
 
 		columnNameSize := buf[byteIndex]
 		byteIndex += 1
@@ -70,7 +82,7 @@ func fromBytes(buf []byte) Table {
 		newColumn.columnSize = columnSize
 		newColumn.columnOffset = offset
 		newColumn.columnIndex = index
-		offset += int(newColumn.columnSize)
+		offset += newColumn.width()
 		index += 1
 		t.Columns = append(t.Columns, newColumn)
 	}
@@ -81,7 +93,7 @@ func (t *Table) GenerateRowBytes() uint64 {
 	if t.rowEmptyBytes == 0 {
 		bytelength := 0
 		for _, val := range t.Columns {
-			bytelength += int(val.columnSize)
+			bytelength += val.width()
 		}
 		t.rowEmptyBytes = uint64(bytelength)
 	}
@@ -93,7 +105,7 @@ func (t *Table) GenerateFields() {
 	for i := range t.Columns {
 		t.Columns[i].columnIndex = i
 		t.Columns[i].columnOffset = offset
-		offset += int(t.Columns[i].columnSize)
+		offset += t.Columns[i].width()
 	}
 }
 
@@ -108,3 +120,103 @@ func (t *Table) ToString() string {
 	}
 	return sb.String()
 }
+
+func (t *Table) getColumn(name string) (Column, bool) {
+	for _, col := range t.Columns {
+		if col.columnName == name {
+			return col, true
+		}
+	}
+	return Column{}, false
+}
+
+// bitset stored at the start of every row marking null columns and whether the row exists
+// bit len(Columns)+1 is the exists bit so len(Columns)+2 bits are needed
+func (t *Table) newRowBitSet() BitSet {
+	return InitializeBitSet(uint64(len(t.Columns) + 2))
+}
+
+// position of the bit marking that a row slot holds a row
+func (t *Table) existsBit() int {
+	return len(t.Columns) + 1
+}
+
+// the primary key column which doubles as the rowid of the table
+func (t *Table) primaryColumn() (Column, bool) {
+	for _, col := range t.Columns {
+		if col.columnConstraint == COL_PRIMARY || col.columnConstraint == COL_ROWID {
+			return col, true
+		}
+	}
+	return Column{}, false
+}
+
+// number of bytes a row takes in a page including its bitset when every VARCHAR and TEXT value is empty
+func (t *Table) rowWidth() int {
+	rowbitset := t.newRowBitSet()
+	return int(t.GenerateRowBytes()) + int(rowbitset.Size())
+}
+
+// returns the bytes of a column inside a row read from a page
+func (t *Table) cellAt(row []byte, col Column) Cell {
+	rowbitset := t.newRowBitSet()
+	celloffset := int(rowbitset.Size()) + col.columnOffset
+	if col.isVariable() {
+		offset, length, _ := t.varSlot(row, col)
+		return Cell(row[offset : offset+length])
+	}
+	return Cell(row[celloffset : celloffset+int(col.columnSize)])
+}
+
+// where the value of a VARCHAR, TEXT or BLOB column is in the row, an overflowed value holds its first overflow page
+func (t *Table) varSlot(row []byte, col Column) (offset int, length int, overflowed bool) {
+	rowbitset := t.newRowBitSet()
+	celloffset := int(rowbitset.Size()) + col.columnOffset
+	offset = int(binary.LittleEndian.Uint32(row[celloffset : celloffset+4]))
+	slotLength := binary.LittleEndian.Uint32(row[celloffset+4 : celloffset+8])
+	if slotLength&overflowFlag != 0 {
+		return offset, overflowRefSize, true
+	}
+	return offset, int(slotLength), false
+}
+
+// builds a row from a cell for every column, cells of null columns are ignored
+func (t *Table) buildRow(rowbitset BitSet, cells []Cell) []byte {
+	row := make([]byte, t.rowWidth())
+	copy(row, rowbitset.bytes)
+	for i, col := range t.Columns {
+		if rowbitset.hasBit(i) {
+			continue
+		}
+		celloffset := int(rowbitset.Size()) + col.columnOffset
+		if !col.isVariable() {
+			copy(row[celloffset:celloffset+col.width()], cells[i])
+			continue
+		}
+		binary.LittleEndian.PutUint32(row[celloffset:celloffset+4], uint32(len(row)))
+		binary.LittleEndian.PutUint32(row[celloffset+4:celloffset+8], uint32(len(cells[i])))
+		row = append(row, cells[i]...)
+	}
+	return row
+}
+
+// copy of row with the cells of columns replaced, replaced columns are no longer null
+func (t *Table) withCells(row []byte, columns []Column, cells []Cell) []byte {
+	rowbitset := t.newRowBitSet()
+	rowbitset.fromBytes(row[:rowbitset.Size()])
+	rowCells := make([]Cell, len(t.Columns))
+	for i, col := range t.Columns {
+		if !rowbitset.hasBit(i) {
+			rowCells[i] = t.cellAt(row, col)
+		}
+	}
+	for i, col := range columns {
+		rowCells[col.columnIndex] = cells[i]
+		if cells[i] == nil {
+			rowbitset.setBit(col.columnIndex)
+		} else {
+			rowbitset.clearBit(col.columnIndex)
+		}
+	}
+	return t.buildRow(rowbitset, rowCells)
+}
@@ -0,0 +1,337 @@
+package internal
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+/*
+Transaction following the shadow page design in specs.md
+pages are copied on first write and the copies are only swapped into the table files on Commit
+table metadata (last page, rowid, free pages) is copied the same way so Rollback only has to forget the copies
+*/
+type Transaction struct {
+	b        *Backend
+	pages    map[string]map[PageID]*[PAGESIZE]byte
+	tables   map[string]*Table
+	readers  map[*Rows]bool //rows of the transaction still streaming its pages
+	readonly bool
+	done     bool
+}
+
+// ErrBusy is returned by writes still waiting for the transaction writing once the busy timeout is over
+var ErrBusy = errors.New("database is busy, another transaction is writing")
+
+// Begin starts a write transaction, waiting while another one is in progress
+func (b *Backend) Begin() (*Transaction, error) {
+	return b.BeginContext(context.Background())
+}
+
+// BeginContext starts a write transaction, waiting while another one is in progress until ctx is done
+func (b *Backend) BeginContext(ctx context.Context) (*Transaction, error) {
+	if err := b.lockWriter(ctx); err != nil {
+		return nil, err
+	}
+	return &Transaction{
+		b:       b,
+		pages:   make(map[string]map[PageID]*[PAGESIZE]byte),
+		tables:  make(map[string]*Table),
+		readers: make(map[*Rows]bool),
+	}, nil
+}
+
+// waits until no other transaction writes, for at most the busy timeout
+func (b *Backend) lockWriter(ctx context.Context) error {
+	timer := time.NewTimer(b.busyTimeout)
+	defer timer.Stop()
+	select {
+	case b.writer <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return ErrBusy
+	}
+}
+
+func (b *Backend) unlockWriter() {
+	<-b.writer
+}
+
+// read only view of committed data used by statements outside a transaction
+func (b *Backend) reader() *Transaction {
+	return &Transaction{b: b, readonly: true}
+}
+
+// runs fn in its own transaction committing only if it succeeds
+func (b *Backend) autocommit(fn func(tx *Transaction) error) error {
+	tx, err := b.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	return tx.Commit()
+}
+
+func (b *Backend) Insert(q Query) (Result, error) {
+	var result Result
+	err := b.autocommit(func(tx *Transaction) (err error) {
+		result, err = tx.Insert(q)
+		return err
+	})
+	return result, err
+}
+
+func (b *Backend) Update(q Query) (int64, error) {
+	var n int64
+	err := b.autocommit(func(tx *Transaction) (err error) {
+		n, err = tx.Update(q)
+		return err
+	})
+	return n, err
+}
+
+func (b *Backend) Delete(q Query) (int64, error) {
+	var n int64
+	err := b.autocommit(func(tx *Transaction) (err error) {
+		n, err = tx.Delete(q)
+		return err
+	})
+	return n, err
+}
+
+// Select plans the query against the committed tables, its rows are then read under the lock one at a time
+// so commits can happen while they are read, a commit changing one of its tables first reads the rest of them
+func (b *Backend) Select(q Query) (driver.Rows, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	result, err := b.reader().Select(q)
+	if err != nil {
+		return nil, err
+	}
+	rows := result.(*Rows)
+	rows.b = b
+	b.readersMu.Lock()
+	defer b.readersMu.Unlock()
+	if b.readers == nil {
+		b.readers = make(map[*Rows]bool)
+	}
+	b.readers[rows] = true
+	return rows, nil
+}
+
+// reads the rest of the rows still reading one of the tables so they keep the committed data they started from
+// called holding the lock for writing before the pages of the tables change
+func (b *Backend) detachReaders(tables map[string]bool) {
+	b.readersMu.Lock()
+	defer b.readersMu.Unlock()
+	for rows := range b.readers {
+		for _, name := range rows.tables {
+			if tables[name] {
+				rows.detach()
+				delete(b.readers, rows)
+				break
+			}
+		}
+	}
+}
+
+// Commit logs every modified page to the write-ahead log, then writes them to the table files and publishes the table metadata
+func (tx *Transaction) Commit() error {
+	if tx.done {
+		return errors.New("transaction already finished")
+	}
+	tx.done = true
+	defer tx.b.unlockWriter()
+	return tx.publish(false)
+}
+
+// writes the pages of the transaction and publishes its tables, through the catalog on disk first when saveCatalog
+// is set so tables changing their definition are only published once it is written, called holding the writer token
+func (tx *Transaction) publish(saveCatalog bool) error {
+	tx.b.mu.Lock()
+	defer tx.b.mu.Unlock()
+	changed := make(map[string]bool, len(tx.tables))
+	for name := range tx.tables {
+		changed[name] = true
+	}
+	tx.b.detachReaders(changed)
+	pages := tx.dirtyPages()
+	if len(pages) > 0 {
+		if err := tx.b.wal.logCommit(pages); err != nil {
+			return err
+		}
+	}
+	for _, page := range pages {
+		if err := tx.b.bufferPool.WritePage(page.table, page.pageid, page.buf); err != nil {
+			return err
+		}
+	}
+	for tablename := range tx.pages {
+		if err := tx.b.bufferPool.Sync(tablename); err != nil {
+			return err
+		}
+	}
+	if len(pages) > 0 {
+		if err := tx.b.wal.checkpoint(); err != nil {
+			return err
+		}
+	}
+	tables := append([]Table{}, tx.b.tables...)
+	for i := range tables {
+		if t, ok := tx.tables[tables[i].Name]; ok {
+			tables[i] = *t
+		}
+	}
+	if saveCatalog {
+		return tx.b.saveCatalog(tables)
+	}
+	tx.b.tables = tables
+	return nil
+}
+
+// modified pages ordered by table and page id with page numbers and checksums set
+func (tx *Transaction) dirtyPages() []walPage {
+	names := make([]string, 0, len(tx.pages))
+	for name := range tx.pages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	dirty := make([]walPage, 0)
+	for _, tablename := range names {
+		pages := tx.pages[tablename]
+		ids := make([]PageID, 0, len(pages))
+		for id := range pages {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+		for _, id := range ids {
+			buf := pages[id]
+			binary.LittleEndian.PutUint64(buf[0:8], uint64(id))
+			updateChecksum(buf)
+			dirty = append(dirty, walPage{table: tablename, pageid: id, buf: buf})
+		}
+	}
+	return dirty
+}
+
+// Rollback forgets every page and table copy made by the transaction
+func (tx *Transaction) Rollback() error {
+	if tx.done {
+		return errors.New("transaction already finished")
+	}
+	tx.done = true
+	tx.pages = nil
+	tx.tables = nil
+	tx.b.unlockWriter()
+	return nil
+}
+
+// table as seen by the transaction
+func (tx *Transaction) table(name string) (Table, bool) {
+	if t, ok := tx.tables[name]; ok {
+		return *t, true
+	}
+	return tx.b.checkTableExist(Query{TableName: name})
+}
+
+// copy of the table metadata owned by the transaction and published on Commit
+func (tx *Transaction) writableTable(name string) (*Table, error) {
+	if tx.readonly {
+		return nil, errors.New("cannot write in a read only transaction")
+	}
+	for rows := range tx.readers {
+		for _, table := range rows.tables {
+			if table == name {
+				rows.detach()
+				delete(tx.readers, rows)
+				break
+			}
+		}
+	}
+	if t, ok := tx.tables[name]; ok {
+		return t, nil
+	}
+	t, ok := tx.b.checkTableExist(Query{TableName: name})
+	if !ok {
+		return nil, errors.New("Table does not exist")
+	}
+	t.freePages = append([]PageID{}, t.freePages...)
+	t.indexes = append([]Index{}, t.indexes...)
+	for i := range t.indexes {
+		t.indexes[i].freePages = append([]PageID{}, t.indexes[i].freePages...)
+	}
+	tx.tables[name] = &t
+	return &t, nil
+}
+
+// page as seen by the transaction, callers must not modify it
+func (tx *Transaction) readPage(tablename string, pageid PageID) (*[PAGESIZE]byte, error) {
+	if buf, ok := tx.pages[tablename][pageid]; ok {
+		return buf, nil
+	}
+	page, err := tx.b.bufferPool.FetchPage(tablename, pageid)
+	if err != nil {
+		return nil, err
+	}
+	buf := page.buf
+	tx.b.bufferPool.UnpinPage(tablename, page.slotid)
+	if !validChecksum(&buf) {
+		return nil, fmt.Errorf("page %d has been corrupted", pageid)
+	}
+	return &buf, nil
+}
+
+// private copy of the page which is written to the table file on Commit
+func (tx *Transaction) writablePage(tablename string, pageid PageID) (*[PAGESIZE]byte, error) {
+	if tx.readonly {
+		return nil, errors.New("cannot write in a read only transaction")
+	}
+	if buf, ok := tx.pages[tablename][pageid]; ok {
+		return buf, nil
+	}
+	buf, err := tx.readPage(tablename, pageid)
+	if err != nil {
+		return nil, err
+	}
+	tx.setPage(tablename, pageid, buf)
+	return buf, nil
+}
+
+// empty page appended after the last page of the table
+func (tx *Transaction) newPage(tablename string, pageid PageID) *[PAGESIZE]byte {
+	buf := &[PAGESIZE]byte{}
+	binary.LittleEndian.PutUint64(buf[0:8], uint64(pageid))
+	tx.setPage(tablename, pageid, buf)
+	return buf
+}
+
+func (tx *Transaction) setPage(tablename string, pageid PageID, buf *[PAGESIZE]byte) {
+	pages, ok := tx.pages[tablename]
+	if !ok {
+		pages = make(map[PageID]*[PAGESIZE]byte)
+		tx.pages[tablename] = pages
+	}
+	pages[pageid] = buf
+}
+
+// copies of the rows satisfying the filter
+func (tx *Transaction) matchingRows(t *Table, filter *rowFilter) ([][]byte, error) {
+	matched := make([][]byte, 0)
+	err := tx.scanRows(t, filter, func(row []byte) error {
+		if filter.match(row) {
+			matched = append(matched, append([]byte{}, row...))
+		}
+		return nil
+	})
+	return matched, err
+}
@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func begin(t *testing.T, b *Backend) *Transaction {
+	tx, err := b.Begin()
+	require.NoError(t, err)
+	return tx
+}
+
+func TestTransactionRollback(t *testing.T) {
+	b := newTestDatabase(t,
+		"CREATE TABLE 'items' (id int Primary Key, name char(8))",
+		"INSERT INTO 'items' (id,name) VALUES ('1','a'),('2','b'),('3','c')",
+	)
+	before := selectAll(t, b, "SELECT * FROM 'items'")
+
+	tx := begin(t, b)
+	_, err := tx.Insert(mustParse(t, "INSERT INTO 'items' (id,name) VALUES ('4','d')"))
+	require.NoError(t, err)
+	n, err := tx.Update(mustParse(t, "UPDATE 'items' SET name = 'z' WHERE id = '1'"))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+	n, err = tx.Delete(mustParse(t, "DELETE FROM 'items' WHERE id = '2'"))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+
+	//the transaction reads its own writes while others still read committed pages
+	rows, err := tx.Select(mustParse(t, "SELECT * FROM 'items'"))
+	require.NoError(t, err)
+	require.Len(t, resultCells(t, rows), 3)
+	require.Equal(t, before, selectAll(t, b, "SELECT * FROM 'items'"))
+
+	require.NoError(t, tx.Rollback())
+	require.Error(t, tx.Commit())
+	require.Equal(t, before, selectAll(t, b, "SELECT * FROM 'items'"))
+	require.Empty(t, b.tables[0].freePages)
+	require.Equal(t, int64(3), b.tables[0].lastRowId)
+
+	//the writer lock was released
+	_, err = b.Insert(mustParse(t, "INSERT INTO 'items' (name) VALUES ('d')"))
+	require.NoError(t, err)
+	require.Len(t, selectAll(t, b, "SELECT * FROM 'items'"), 4)
+}
+
+func TestTransactionCommit(t *testing.T) {
+	b := newTestDatabase(t, "CREATE TABLE 'big' (id int Primary Key, filler char(255))")
+
+	tx := begin(t, b)
+	for i := 1; i <= 40; i++ {
+		_, err := tx.Insert(mustParse(t, fmt.Sprintf("INSERT INTO 'big' (id,filler) VALUES ('%d','row%d')", i, i)))
+		require.NoError(t, err)
+	}
+	n, err := tx.Delete(mustParse(t, "DELETE FROM 'big' WHERE id <= '5'"))
+	require.NoError(t, err)
+	require.Equal(t, int64(5), n)
+	require.Equal(t, uint64(0), b.tables[0].lastPage, "metadata is published only on commit")
+	require.NoError(t, tx.Commit())
+	require.Equal(t, uint64(5), b.tables[0].lastPage)
+
+	reopened, err := OpenExistingDatabase(b.dir)
+	require.NoError(t, err)
+	rows := selectAll(t, reopened, "SELECT id, filler FROM 'big'")
+	require.Len(t, rows, 35)
+	require.Equal(t, []driver.Value{int64(6), "row6"}, rows[0])
+	require.True(t, strings.HasPrefix(rows[34][1].(string), "row40"))
+}
+
+func TestAutocommitRollsBackFailedStatement(t *testing.T) {
+	b := newTestDatabase(t, "CREATE TABLE 'items' (id int Primary Key, score float)")
+
+	//second row fails to convert so the first must not be stored either
+	_, err := b.Insert(mustParse(t, "INSERT INTO 'items' (id,score) VALUES ('1','1.5'),('2','abc')"))
+	require.Error(t, err)
+	require.Empty(t, selectAll(t, b, "SELECT * FROM 'items'"))
+}
+
+func TestBusyWriter(t *testing.T) {
+	b := newTestDatabase(t, "CREATE TABLE 'items' (id int Primary Key, name char(8))")
+	b.SetBusyTimeout(20 * time.Millisecond)
+
+	//writes outside the open transaction give up instead of waiting for it forever
+	tx := begin(t, b)
+	_, err := b.Insert(mustParse(t, "INSERT INTO 'items' (id,name) VALUES ('1','a')"))
+	require.ErrorIs(t, err, ErrBusy)
+	require.ErrorIs(t, b.DropTable(mustParse(t, "DROP TABLE 'items'")), ErrBusy)
+	require.ErrorIs(t, b.CreateIndex(mustParse(t, "CREATE INDEX by_name ON 'items' (name)")), ErrBusy)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = b.BeginContext(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Empty(t, selectAll(t, b, "SELECT * FROM 'items'"), "reads do not wait")
+
+	require.NoError(t, tx.Rollback())
+	_, err = b.Insert(mustParse(t, "INSERT INTO 'items' (id,name) VALUES ('1','a')"))
+	require.NoError(t, err)
+}
+
+func TestReadsDuringCommits(t *testing.T) {
+	b := newTestDatabase(t, "CREATE TABLE 'nums' (id int Primary Key, n int, label char(200))")
+	values := []string{}
+	for i := 1; i <= 200; i++ {
+		values = append(values, fmt.Sprintf("(%d,0,'l%d')", i, i))
+	}
+	_, err := b.Insert(mustParse(t, "INSERT INTO 'nums' (id,n,label) VALUES "+strings.Join(values, ",")))
+	require.NoError(t, err)
+
+	//every reader sees the rows committed when it selected them whatever commits while it reads
+	read := func() error {
+		rows, err := b.Select(mustParse(t, "SELECT n FROM 'nums'"))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		dest := make([]driver.Value, 1)
+		count, first := 0, driver.Value(nil)
+		for err = rows.Next(dest); err == nil; err = rows.Next(dest) {
+			if count == 0 {
+				first = dest[0]
+			}
+			if dest[0] != first {
+				return fmt.Errorf("rows mix values %v and %v of different commits", first, dest[0])
+			}
+			count++
+		}
+		if err != io.EOF {
+			return err
+		}
+		if count != 200 {
+			return fmt.Errorf("read %d rows of 200", count)
+		}
+		return nil
+	}
+	done := make(chan error)
+	for r := 0; r < 4; r++ {
+		go func() {
+			for k := 0; k < 10; k++ {
+				if err := read(); err != nil {
+					done <- err
+					return
+				}
+			}
+			done <- nil
+		}()
+	}
+	for i := 1; i <= 20; i++ {
+		_, err := b.Update(mustParse(t, fmt.Sprintf("UPDATE 'nums' SET n = %d WHERE id > 0", i)))
+		require.NoError(t, err)
+		if i == 10 {
+			require.NoError(t, b.CreateIndex(mustParse(t, "CREATE INDEX by_n ON 'nums' (n)")))
+		}
+	}
+	for r := 0; r < 4; r++ {
+		require.NoError(t, <-done)
+	}
+}
@@ -0,0 +1,204 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+/*
+Write-ahead log of page images kept in wal.log of the database directory
+every record is framed as length (4 bytes) | payload | md5 of payload (16 bytes)
+payload of a page record: type | table name length (2 bytes) | table name | page id (8 bytes) | page image
+payload of a commit record: type | number of page records in the transaction (4 bytes)
+a transaction is durable once its commit record is synced, table files are written afterwards
+and the log is truncated when they are synced so at most one transaction is waiting in it
+*/
+const (
+	walPageRecord byte = iota + 1
+	walCommitRecord
+)
+
+const WALFILE = "wal.log"
+
+type writeAheadLog struct {
+	file *os.File
+	mx   sync.Mutex
+}
+
+type walPage struct {
+	table  string
+	pageid PageID
+	buf    *[PAGESIZE]byte
+}
+
+func openWAL(dir string) (*writeAheadLog, error) {
+	f, err := os.OpenFile(filepath.Join(dir, WALFILE), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &writeAheadLog{file: f}, nil
+}
+
+// writes the page images followed by a commit record and syncs the log
+func (w *writeAheadLog) logCommit(pages []walPage) error {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+
+	buf := make([]byte, 0, len(pages)*(PAGESIZE+64)+32)
+	for _, page := range pages {
+		payload := make([]byte, 0, PAGESIZE+16+len(page.table))
+		payload = append(payload, walPageRecord)
+		payload = binary.LittleEndian.AppendUint16(payload, uint16(len(page.table)))
+		payload = append(payload, page.table...)
+		payload = binary.LittleEndian.AppendUint64(payload, uint64(page.pageid))
+		payload = append(payload, page.buf[:]...)
+		buf = appendWALRecord(buf, payload)
+	}
+	commit := []byte{walCommitRecord}
+	commit = binary.LittleEndian.AppendUint32(commit, uint32(len(pages)))
+	buf = appendWALRecord(buf, commit)
+
+	if _, err := w.file.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+	if _, err := w.file.Write(buf); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+// empties the log once every logged page is synced to the table files
+func (w *writeAheadLog) checkpoint() error {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+func appendWALRecord(buf []byte, payload []byte) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(payload)))
+	buf = append(buf, payload...)
+	checksum := md5.Sum(payload)
+	return append(buf, checksum[:]...)
+}
+
+// returns io.EOF at the end of the log and for a record torn by a crash
+func readWALRecord(r *bufio.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, io.EOF
+	}
+	payload := make([]byte, binary.LittleEndian.Uint32(header))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, io.EOF
+	}
+	checksum := make([]byte, md5.Size)
+	if _, err := io.ReadFull(r, checksum); err != nil {
+		return nil, io.EOF
+	}
+	expected := md5.Sum(payload)
+	if !bytes.Equal(checksum, expected[:]) || len(payload) == 0 {
+		return nil, io.EOF
+	}
+	return payload, nil
+}
+
+// recoverWAL copies the pages of every committed transaction in the log into the table files
+// pages of a transaction without a commit record never reached the table files and are dropped
+func recoverWAL(dir string) error {
+	f, err := os.OpenFile(filepath.Join(dir, WALFILE), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	pending := make([]walPage, 0)
+	for {
+		payload, err := readWALRecord(r)
+		if err == io.EOF {
+			break
+		}
+		switch payload[0] {
+		case walPageRecord:
+			page, err := decodeWALPage(payload)
+			if err != nil {
+				return err
+			}
+			pending = append(pending, page)
+		case walCommitRecord:
+			if len(payload) < 5 || int(binary.LittleEndian.Uint32(payload[1:5])) != len(pending) {
+				return errors.New("write-ahead log commit record does not match its pages")
+			}
+			if err := applyWALPages(dir, pending); err != nil {
+				return err
+			}
+			pending = pending[:0]
+		default:
+			return fmt.Errorf("unknown write-ahead log record type %d", payload[0])
+		}
+	}
+
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func decodeWALPage(payload []byte) (walPage, error) {
+	if len(payload) < 3 {
+		return walPage{}, errors.New("write-ahead log page record too short")
+	}
+	nameLen := int(binary.LittleEndian.Uint16(payload[1:3]))
+	if len(payload) != 3+nameLen+8+PAGESIZE {
+		return walPage{}, errors.New("write-ahead log page record has wrong size")
+	}
+	page := walPage{table: string(payload[3 : 3+nameLen]), buf: &[PAGESIZE]byte{}}
+	page.pageid = PageID(binary.LittleEndian.Uint64(payload[3+nameLen : 11+nameLen]))
+	copy(page.buf[:], payload[11+nameLen:])
+	return page, nil
+}
+
+func applyWALPages(dir string, pages []walPage) error {
+	byTable := make(map[string][]walPage)
+	for _, page := range pages {
+		byTable[page.table] = append(byTable[page.table], page)
+	}
+	names := make([]string, 0, len(byTable))
+	for name := range byTable {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf("%s.db", name)), os.O_WRONLY, 0644)
+		if os.IsNotExist(err) {
+			continue //table dropped after the transaction committed
+		} else if err != nil {
+			return err
+		}
+		for _, page := range byTable[name] {
+			if _, err := f.WriteAt(page.buf[:], int64(page.pageid)*PAGESIZE); err != nil {
+				f.Close()
+				return err
+			}
+		}
+		err = f.Sync()
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package databasego
+
+import (
+	"database/sql/driver"
+	"errors"
+
+	. "github.com/kd993595/fusedb/internal"
+)
+
+// statements run either against the backend directly or inside a transaction
+type executor interface {
+	Select(q Query) (driver.Rows, error)
+	Insert(q Query) (Result, error)
+	Update(q Query) (int64, error)
+	Delete(q Query) (int64, error)
+}
+
+// Prepared statement parsed once and bound to new arguments on every execution
+type Stmt struct {
+	conn *Conn
+	ast  Query
+}
+
+func (s *Stmt) Close() error {
+	return nil
+}
+
+func (s *Stmt) NumInput() int {
+	return s.ast.NumParams()
+}
+
+func (s *Stmt) Query(args []driver.Value) (driver.Rows, error) {
+	ast, err := s.conn.db.Bind(s.ast, args)
+	if err != nil {
+		return nil, err
+	}
+	return s.query(ast)
+}
+
+func (s *Stmt) executor() executor {
+	if s.conn.tx != nil {
+		return s.conn.tx.tx
+	}
+	return s.conn.db
+}
+
+func (s *Stmt) query(ast Query) (driver.Rows, error) {
+	if s.conn.tx != nil && (ast.Type == Create || ast.Type == Drop || ast.Type == CreateIndex || ast.Type == DropIndex) {
+		return nil, errors.New("CREATE and DROP are not supported inside a transaction")
+	}
+
+	// NOTE: ignorning all but the first statement
+	stmt := ast.Type
+	switch stmt {
+	case Create:
+		err := s.conn.db.CreateTable(ast)
+		return nil, err
+	case Select:
+		rows, err := s.executor().Select(ast)
+		if err != nil {
+			return nil, err
+		}
+		return rows, nil
+	case Insert:
+		_, err := s.executor().Insert(ast)
+		return nil, err
+	case Update:
+		_, err := s.executor().Update(ast)
+		return nil, err
+	case Delete:
+		_, err := s.executor().Delete(ast)
+		return nil, err
+	case Drop:
+		err := s.conn.db.DropTable(ast)
+		return nil, err
+	case CreateIndex:
+		err := s.conn.db.CreateIndex(ast)
+		return nil, err
+	case DropIndex:
+		err := s.conn.db.DropIndex(ast)
+		return nil, err
+	default:
+		return nil, errors.ErrUnsupported
+	}
+}
+
+func (s *Stmt) Exec(args []driver.Value) (driver.Result, error) {
+	ast, err := s.conn.db.Bind(s.ast, args)
+	if err != nil {
+		return nil, err
+	}
+
+	switch ast.Type {
+	case Insert:
+		result, err := s.executor().Insert(ast)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	case Update:
+		n, err := s.executor().Update(ast)
+		if err != nil {
+			return nil, err
+		}
+		return driver.RowsAffected(n), nil
+	case Delete:
+		n, err := s.executor().Delete(ast)
+		if err != nil {
+			return nil, err
+		}
+		return driver.RowsAffected(n), nil
+	default:
+		rows, err := s.query(ast)
+		if err != nil {
+			return nil, err
+		}
+		if rows != nil {
+			rows.Close()
+		}
+		return driver.ResultNoRows, nil
+	}
+}
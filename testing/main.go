@@ -26,26 +26,31 @@ func main() {
 		log.Fatal(err)
 	}
 
-	_, err = db.Query("CREATE TABLE 'MyTable10' (column1 int Primary Key, name char(10),column30 bool, column400 float)")
+	_, err = db.Exec("CREATE TABLE 'MyTable10' (column1 int Primary Key, name char(10),column30 bool, column400 float)")
 	if err != nil {
 		log.Fatal(err)
 	}
 	fmt.Println("Create Query passed")
 
-	_, err = db.Query("INSERT INTO 'MyTable10' (column1,name,column30,column400) VALUES ('1','somecharss', 'true','1.23')")
+	_, err = db.Exec("INSERT INTO 'MyTable10' (column1,name,column30,column400) VALUES ('1','somecharss', 'true','1.23')")
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	_, err = db.Query("INSERT INTO 'MyTable10' (column1,name,column30,column400) VALUES ('2','10letters', 'false','4.69')")
+	_, err = db.Exec("INSERT INTO 'MyTable10' (column1,name,column30,column400) VALUES ('2','10letters', 'false','4.69')")
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	_, err = db.Query("INSERT INTO 'MyTable10' (column1,name,column30,column400) VALUES ('3','Kevin', 't','.567')")
+	result, err := db.Exec("INSERT INTO 'MyTable10' (column1,name,column30,column400) VALUES (?, ?, ?, ?)", 3, "Kevin", true, .567)
 	if err != nil {
 		log.Fatal(err)
 	}
+	lastId, err := result.LastInsertId()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("last insert id", lastId)
 	fmt.Println("Insert Queries passed")
 
 	rows, err := db.Query("SELECT * FROM 'MyTable10'")
@@ -0,0 +1,21 @@
+package databasego
+
+import (
+	. "github.com/kd993595/fusedb/internal"
+)
+
+// Implements driver.Tx, statements on the connection run inside the transaction until it ends
+type Tx struct {
+	conn *Conn
+	tx   *Transaction
+}
+
+func (t *Tx) Commit() error {
+	t.conn.tx = nil
+	return t.tx.Commit()
+}
+
+func (t *Tx) Rollback() error {
+	t.conn.tx = nil
+	return t.tx.Rollback()
+}